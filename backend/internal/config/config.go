@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -24,9 +25,11 @@ type Config struct {
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Host string
-	Port string
-	Mode string // debug, release, test
+	Host        string
+	Port        string
+	Mode        string // debug, release, test
+	TLSCertFile string // 配置后直接以HTTPS监听，并请求客户端证书（RFC 8705）
+	TLSKeyFile  string
 }
 
 // DatabaseConfig 数据库配置
@@ -54,13 +57,30 @@ type JWTConfig struct {
 	Secret            string
 	AccessTokenExpire time.Duration
 	RefreshTokenExpire time.Duration
+	SigningAlg          string        // 令牌签名算法：RS256、ES256 或 EdDSA
+	KeyRotationInterval time.Duration // 签名密钥轮换周期
+	KeyRotationOverlap  time.Duration // 新密钥提前发布及旧密钥保留验签的时长
 }
 
 // OAuth2Config OAuth2配置
 type OAuth2Config struct {
 	AuthorizationCodeExpire time.Duration
 	AccessTokenExpire       time.Duration
-	RefreshTokenExpire      time.Duration
+	RefreshTokenExpire      time.Duration // 刷新令牌闲置过期时间，每次轮换重新计算
+	RefreshTokenAbsoluteExpire time.Duration // 刷新令牌自首次签发起的绝对有效期，0表示不限制
+	IDTokenExpire           time.Duration // ID Token有效期
+	DeviceCodeExpire        time.Duration // 设备码有效期（RFC 8628）
+	DeviceCodeInterval      time.Duration // 设备轮询令牌端点的最小间隔
+	PARExpire               time.Duration // 推送授权请求request_uri有效期（RFC 9126）
+	DPoPProofMaxAge         time.Duration // DPoP证明的最长有效时间（RFC 9449）
+	DPoPNonceRequired       bool          // 是否要求DPoP证明携带服务端签发的nonce
+	DPoPNonceLifetime       time.Duration // DPoP nonce有效期
+	MTLSClientCAFile        string        // 校验tls_client_auth客户端证书链的CA证书（PEM），为空时使用系统根证书
+	MTLSCertHeader          string        // 反向代理转发客户端证书的请求头，为空表示不信任代理转发的证书
+	MTLSTrustedProxies      []string      // 允许转发客户端证书的代理地址（IP或CIDR）
+	ClientSecretLifetime    time.Duration // 客户端密钥有效期，0表示不过期
+	ClientSecretRotationGrace time.Duration // 轮换客户端密钥后旧密钥继续有效的时长
+	Issuers                 []string      // APP_URL之外的签发者标识（RFC 8414），按域名或路径区分租户
 }
 
 // MFAConfig MFA配置
@@ -107,9 +127,11 @@ func Load() {
 
 	Cfg = &Config{
 		Server: ServerConfig{
-			Host: getEnv("SERVER_HOST", "0.0.0.0"),
-			Port: getEnv("SERVER_PORT", "8080"),
-			Mode: getEnv("SERVER_MODE", "debug"),
+			Host:        getEnv("SERVER_HOST", "0.0.0.0"),
+			Port:        getEnv("SERVER_PORT", "8080"),
+			Mode:        getEnv("SERVER_MODE", "debug"),
+			TLSCertFile: getEnv("SERVER_TLS_CERT_FILE", ""),
+			TLSKeyFile:  getEnv("SERVER_TLS_KEY_FILE", ""),
 		},
 		Database: DatabaseConfig{
 			Host:      getEnv("DB_HOST", "localhost"),
@@ -131,11 +153,28 @@ func Load() {
 			Secret:            getEnv("JWT_SECRET", "your-secret-key-change-in-production-min-32-chars"),
 			AccessTokenExpire: getEnvDuration("JWT_ACCESS_TOKEN_EXPIRE", 15*time.Minute),
 			RefreshTokenExpire: getEnvDuration("JWT_REFRESH_TOKEN_EXPIRE", 168*time.Hour),
+			SigningAlg:          getEnv("JWT_SIGNING_ALG", "RS256"),
+			KeyRotationInterval: getEnvDuration("JWT_KEY_ROTATION_INTERVAL", 720*time.Hour),
+			KeyRotationOverlap:  getEnvDuration("JWT_KEY_ROTATION_OVERLAP", 24*time.Hour),
 		},
 		OAuth2: OAuth2Config{
 			AuthorizationCodeExpire: getEnvDuration("OAUTH2_AUTHORIZATION_CODE_EXPIRE", 10*time.Minute),
 			AccessTokenExpire:       getEnvDuration("OAUTH2_ACCESS_TOKEN_EXPIRE", 15*time.Minute),
 			RefreshTokenExpire:      getEnvDuration("OAUTH2_REFRESH_TOKEN_EXPIRE", 168*time.Hour),
+			RefreshTokenAbsoluteExpire: getEnvDuration("OAUTH2_REFRESH_TOKEN_ABSOLUTE_EXPIRE", 0),
+			IDTokenExpire:           getEnvDuration("OAUTH2_ID_TOKEN_EXPIRE", 15*time.Minute),
+			DeviceCodeExpire:        getEnvDuration("OAUTH2_DEVICE_CODE_EXPIRE", 10*time.Minute),
+			DeviceCodeInterval:      getEnvDuration("OAUTH2_DEVICE_CODE_INTERVAL", 5*time.Second),
+			PARExpire:               getEnvDuration("OAUTH2_PAR_EXPIRE", 90*time.Second),
+			DPoPProofMaxAge:         getEnvDuration("OAUTH2_DPOP_PROOF_MAX_AGE", 5*time.Minute),
+			DPoPNonceRequired:       getEnvBool("OAUTH2_DPOP_NONCE_REQUIRED", true),
+			DPoPNonceLifetime:       getEnvDuration("OAUTH2_DPOP_NONCE_LIFETIME", 5*time.Minute),
+			MTLSClientCAFile:        getEnv("OAUTH2_MTLS_CLIENT_CA_FILE", ""),
+			MTLSCertHeader:          getEnv("OAUTH2_MTLS_CERT_HEADER", ""),
+			MTLSTrustedProxies:      getEnvList("OAUTH2_MTLS_TRUSTED_PROXIES", nil),
+			ClientSecretLifetime:    getEnvDuration("OAUTH2_CLIENT_SECRET_LIFETIME", 0),
+			ClientSecretRotationGrace: getEnvDuration("OAUTH2_CLIENT_SECRET_ROTATION_GRACE", 24*time.Hour),
+			Issuers:                 getEnvList("OAUTH2_ISSUERS", nil),
 		},
 		MFA: MFAConfig{
 			Issuer: getEnv("MFA_ISSUER", "Astro-Pass"),
@@ -193,6 +232,21 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvList 获取逗号分隔的列表类型环境变量
+func getEnvList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // getEnvDuration 获取时间间隔类型环境变量
 func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
@@ -34,6 +34,39 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("刷新令牌过期时间必须大于访问令牌过期时间")
 	}
 
+	switch c.JWT.SigningAlg {
+	case "RS256", "ES256", "EdDSA":
+	default:
+		return fmt.Errorf("不支持的令牌签名算法: %s", c.JWT.SigningAlg)
+	}
+
+	// 旧密钥需保留到用它签发的访问令牌全部过期
+	if c.JWT.KeyRotationOverlap < c.JWT.AccessTokenExpire {
+		return fmt.Errorf("签名密钥轮换重叠期不能短于访问令牌过期时间")
+	}
+
+	if c.OAuth2.AccessTokenExpire <= 0 || c.OAuth2.IDTokenExpire <= 0 || c.OAuth2.RefreshTokenExpire <= 0 {
+		return fmt.Errorf("OAuth2令牌过期时间必须大于0")
+	}
+	if c.OAuth2.AccessTokenExpire > c.JWT.KeyRotationOverlap || c.OAuth2.IDTokenExpire > c.JWT.KeyRotationOverlap {
+		return fmt.Errorf("OAuth2访问令牌和ID Token过期时间不能超过签名密钥轮换重叠期")
+	}
+	if c.OAuth2.RefreshTokenAbsoluteExpire < 0 {
+		return fmt.Errorf("刷新令牌绝对有效期不能为负数")
+	}
+
+	if c.JWT.KeyRotationInterval <= c.JWT.KeyRotationOverlap {
+		return fmt.Errorf("签名密钥轮换周期必须大于重叠期")
+	}
+
+	if c.OAuth2.ClientSecretLifetime < 0 || c.OAuth2.ClientSecretRotationGrace < 0 {
+		return fmt.Errorf("客户端密钥有效期和轮换宽限期不能为负数")
+	}
+
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		return fmt.Errorf("TLS证书和私钥必须同时配置")
+	}
+
 	return nil
 }
 
@@ -1,6 +1,10 @@
 package controllers
 
 import (
+	"errors"
+	"net/http"
+	"strings"
+
 	"astro-pass/internal/database"
 	"astro-pass/internal/models"
 	"astro-pass/internal/services"
@@ -30,6 +34,9 @@ type RegisterRequest struct {
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	MFACode  string `json:"mfa_code"` // 已启用MFA的用户可提供TOTP验证码
+	// ACRValues 从授权请求跳转登录时携带的acr_values，要求MFA时已启用MFA的用户必须提供验证码
+	ACRValues string `json:"acr_values"`
 }
 
 // RefreshTokenRequest 刷新令牌请求
@@ -90,8 +97,17 @@ func (c *AuthController) Login(ctx *gin.Context) {
 	ip := ctx.ClientIP()
 	userAgent := ctx.GetHeader("User-Agent")
 
-	user, accessToken, refreshToken, err := c.authService.Login(req.Username, req.Password, ip, userAgent)
+	requireMFA := services.ACRValuesRequireMFA(strings.Fields(req.ACRValues))
+	user, accessToken, refreshToken, err := c.authService.Login(req.Username, req.Password, req.MFACode, requireMFA, ip, userAgent)
 	if err != nil {
+		if errors.Is(err, services.ErrMFARequired) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"code":         401,
+				"message":      err.Error(),
+				"mfa_required": true,
+			})
+			return
+		}
 		utils.Unauthorized(ctx, err.Error())
 		return
 	}
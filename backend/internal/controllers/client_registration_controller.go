@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"astro-pass/internal/services"
+	"astro-pass/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type ClientRegistrationController struct {
+	registrationService *services.ClientRegistrationService
+}
+
+func NewClientRegistrationController() *ClientRegistrationController {
+	return &ClientRegistrationController{
+		registrationService: services.NewClientRegistrationService(),
+	}
+}
+
+// bearerToken 从Authorization头中提取Bearer令牌
+func bearerToken(ctx *gin.Context) string {
+	parts := strings.SplitN(ctx.GetHeader("Authorization"), " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+// registrationErrorResponse 按RFC 7591 3.2.2节 / RFC 6750 输出错误
+func registrationErrorResponse(ctx *gin.Context, err error) {
+	var regErr *services.RegistrationError
+	if errors.As(err, &regErr) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":             regErr.Code,
+			"error_description": regErr.Description,
+		})
+		return
+	}
+
+	if errors.Is(err, services.ErrInvalidRegistrationToken) {
+		ctx.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"error":             "invalid_token",
+			"error_description": "访问令牌无效或已过期",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusInternalServerError, gin.H{
+		"error":             "server_error",
+		"error_description": err.Error(),
+	})
+}
+
+// Register 动态客户端注册端点（RFC 7591），需携带管理员签发的初始访问令牌
+func (c *ClientRegistrationController) Register(ctx *gin.Context) {
+	var metadata services.ClientMetadata
+	if err := ctx.ShouldBindJSON(&metadata); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":             services.RegistrationErrInvalidClientMetadata,
+			"error_description": err.Error(),
+		})
+		return
+	}
+
+	response, err := c.registrationService.RegisterClient(bearerToken(ctx), &metadata, ctx.ClientIP(), ctx.GetHeader("User-Agent"))
+	if err != nil {
+		registrationErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// authenticateConfigurationRequest 校验客户端配置端点的注册访问令牌
+func (c *ClientRegistrationController) authenticateConfigurationRequest(ctx *gin.Context) (*services.ClientInformationResponse, bool) {
+	client, err := c.registrationService.AuthenticateRegistrationAccess(ctx.Param("client_id"), bearerToken(ctx))
+	if err != nil {
+		registrationErrorResponse(ctx, err)
+		return nil, false
+	}
+	return c.registrationService.GetClientConfiguration(client), true
+}
+
+// GetClientConfiguration 读取客户端配置（RFC 7592 2.1节）
+func (c *ClientRegistrationController) GetClientConfiguration(ctx *gin.Context) {
+	response, ok := c.authenticateConfigurationRequest(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, response)
+}
+
+// ClientConfigurationUpdateRequest 客户端配置更新请求（RFC 7592 2.2节）
+type ClientConfigurationUpdateRequest struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	services.ClientMetadata
+}
+
+// UpdateClientConfiguration 更新客户端配置（RFC 7592 2.2节）
+func (c *ClientRegistrationController) UpdateClientConfiguration(ctx *gin.Context) {
+	client, err := c.registrationService.AuthenticateRegistrationAccess(ctx.Param("client_id"), bearerToken(ctx))
+	if err != nil {
+		registrationErrorResponse(ctx, err)
+		return
+	}
+
+	var req ClientConfigurationUpdateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":             services.RegistrationErrInvalidClientMetadata,
+			"error_description": err.Error(),
+		})
+		return
+	}
+
+	response, err := c.registrationService.UpdateClientConfiguration(client, req.ClientID, req.ClientSecret, &req.ClientMetadata, ctx.ClientIP(), ctx.GetHeader("User-Agent"))
+	if err != nil {
+		registrationErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, response)
+}
+
+// DeleteClientConfiguration 注销客户端（RFC 7592 2.3节）
+func (c *ClientRegistrationController) DeleteClientConfiguration(ctx *gin.Context) {
+	client, err := c.registrationService.AuthenticateRegistrationAccess(ctx.Param("client_id"), bearerToken(ctx))
+	if err != nil {
+		registrationErrorResponse(ctx, err)
+		return
+	}
+
+	if err := c.registrationService.DeleteClientConfiguration(client, ctx.ClientIP(), ctx.GetHeader("User-Agent")); err != nil {
+		registrationErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// CreateInitialAccessTokenRequest 创建初始访问令牌请求
+type CreateInitialAccessTokenRequest struct {
+	Description string `json:"description"`
+	MaxUses     int    `json:"max_uses"`   // 0 表示不限次数
+	ExpiresIn   int64  `json:"expires_in"` // 有效期（秒），0 表示永不过期
+}
+
+// CreateInitialAccessToken 管理员创建初始访问令牌，令牌明文仅返回一次
+func (c *ClientRegistrationController) CreateInitialAccessToken(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	var req CreateInitialAccessTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+	if req.MaxUses < 0 || req.ExpiresIn < 0 {
+		utils.BadRequest(ctx, "max_uses和expires_in不能为负数")
+		return
+	}
+
+	iat, token, err := c.registrationService.CreateInitialAccessToken(userID.(uint), req.Description, req.MaxUses, time.Duration(req.ExpiresIn)*time.Second)
+	if err != nil {
+		utils.InternalError(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "初始访问令牌创建成功，请妥善保存，令牌仅显示一次", gin.H{
+		"id":          iat.ID,
+		"token":       token,
+		"description": iat.Description,
+		"max_uses":    iat.MaxUses,
+		"expires_at":  iat.ExpiresAt,
+	})
+}
+
+// ListInitialAccessTokens 列出初始访问令牌
+func (c *ClientRegistrationController) ListInitialAccessTokens(ctx *gin.Context) {
+	tokens, err := c.registrationService.ListInitialAccessTokens()
+	if err != nil {
+		utils.InternalError(ctx, err.Error())
+		return
+	}
+
+	utils.Success(ctx, tokens)
+}
+
+// RevokeInitialAccessToken 撤销初始访问令牌
+func (c *ClientRegistrationController) RevokeInitialAccessToken(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		utils.BadRequest(ctx, "无效的令牌ID")
+		return
+	}
+
+	if err := c.registrationService.RevokeInitialAccessToken(uint(id)); err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "初始访问令牌已撤销", nil)
+}
@@ -8,14 +8,20 @@ import (
 )
 
 type ConsentController struct {
-	consentService *services.ConsentService
-	oauth2Service  *services.OAuth2Service
+	consentService       *services.ConsentService
+	oauth2Service        *services.OAuth2Service
+	parService           *services.PushedAuthorizationService
+	requestObjectService *services.RequestObjectService
+	scopeService         *services.ScopeService
 }
 
 func NewConsentController() *ConsentController {
 	return &ConsentController{
-		consentService: services.NewConsentService(),
-		oauth2Service:  services.NewOAuth2Service(),
+		consentService:       services.NewConsentService(),
+		oauth2Service:        services.NewOAuth2Service(),
+		parService:           services.NewPushedAuthorizationService(),
+		requestObjectService: services.NewRequestObjectService(),
+		scopeService:         services.NewScopeService(),
 	}
 }
 
@@ -23,6 +29,9 @@ func NewConsentController() *ConsentController {
 func (cc *ConsentController) GetConsentInfo(c *gin.Context) {
 	clientID := c.Query("client_id")
 	scope := c.Query("scope")
+	redirectURI := c.Query("redirect_uri")
+	state := c.Query("state")
+	claims := c.Query("claims")
 
 	if clientID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -32,40 +41,78 @@ func (cc *ConsentController) GetConsentInfo(c *gin.Context) {
 		return
 	}
 
-	// 获取客户端信息
-	var client struct {
-		ClientName string
-		ClientURI  string
-		LogoURI    string
+	// 推送授权请求（RFC 9126）和请求对象（RFC 9101）的参数由服务端解析
+	if request, requestURI := c.Query("request"), c.Query("request_uri"); request != "" || requestURI != "" {
+		params, err := cc.resolveRequestParams(clientID, request, requestURI)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": err.Error(),
+			})
+			return
+		}
+		scope, redirectURI, state, claims = params.Scope, params.RedirectURI, params.State, params.Claims
 	}
 
-	// 这里应该从数据库查询客户端信息
-	// 简化处理，返回模拟数据
-	client.ClientName = "示例应用"
-	client.ClientURI = "https://example.com"
-	client.LogoURI = "https://example.com/logo.png"
+	client, err := cc.oauth2Service.GetClientByClientID(clientID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
 
-	// 解析scope
-	scopes := parseScopeDescriptions(scope)
+	// scope的展示信息来自授权范围定义
+	scopes := cc.scopeService.DescribeScopes(scope)
+
+	// 通过claims参数请求的声明（如department、employee_id）单独展示
+	claimsRequest, err := services.ParseClaimsRequest(claims, scope)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": err.Error(),
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"data": gin.H{
-			"client_name": client.ClientName,
-			"client_uri":  client.ClientURI,
-			"logo_uri":    client.LogoURI,
-			"scopes":      scopes,
+			"client_name":  client.ClientName,
+			"client_uri":   client.ClientURI,
+			"logo_uri":     client.LogoURI,
+			"scopes":       scopes,
+			"scope":        scope,
+			"claims":       cc.scopeService.RequestedClaims(claimsRequest),
+			"redirect_uri": redirectURI,
+			"state":        state,
 		},
 	})
 }
 
+// resolveRequestParams 解析同意页面携带的request或request_uri
+func (cc *ConsentController) resolveRequestParams(clientID, request, requestURI string) (*services.AuthorizationRequestParams, error) {
+	if requestURI != "" && services.IsPushedRequestURI(requestURI) {
+		return cc.parService.ResolveAuthorizationRequest(clientID, requestURI)
+	}
+
+	client, err := cc.oauth2Service.GetClientByClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	return cc.requestObjectService.ResolveRequestObject(client, request, requestURI)
+}
+
 // ApproveConsent 批准授权
 func (cc *ConsentController) ApproveConsent(c *gin.Context) {
 	userID := c.GetUint("user_id")
-	
+
 	var req struct {
-		ClientID string `json:"client_id" binding:"required"`
-		Scope    string `json:"scope" binding:"required"`
+		ClientID    string   `json:"client_id" binding:"required"`
+		RedirectURI string   `json:"redirect_uri" binding:"required"`
+		Scope       string   `json:"scope" binding:"required"`
+		Claims      []string `json:"claims"` // 同意释放的通过claims参数请求的声明
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -77,7 +124,7 @@ func (cc *ConsentController) ApproveConsent(c *gin.Context) {
 	}
 
 	// 保存授权
-	err := cc.consentService.SaveConsent(userID, req.ClientID, req.Scope)
+	err := cc.consentService.SaveConsent(userID, req.ClientID, req.Scope, req.Claims)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -86,9 +133,22 @@ func (cc *ConsentController) ApproveConsent(c *gin.Context) {
 		return
 	}
 
+	// 一次性批准凭据，返回授权端点时凭此确认本次请求已获用户批准
+	ticket, err := cc.consentService.CreateApproval(userID, req.ClientID, req.RedirectURI, req.Scope, req.Claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "授权成功",
+		"data": gin.H{
+			"consent_ticket": ticket,
+		},
 	})
 }
 
@@ -138,55 +198,3 @@ func (cc *ConsentController) RevokeConsent(c *gin.Context) {
 		"message": "撤销授权成功",
 	})
 }
-
-// parseScopeDescriptions 解析scope并返回描述
-func parseScopeDescriptions(scopeString string) []map[string]string {
-	scopeDescriptions := map[string]string{
-		"openid":  "访问您的基本身份信息",
-		"profile": "访问您的个人资料（昵称、头像等）",
-		"email":   "访问您的邮箱地址",
-		"phone":   "访问您的手机号码",
-		"address": "访问您的地址信息",
-	}
-
-	var result []map[string]string
-	if scopeString == "" {
-		return result
-	}
-
-	scopes := splitBySpace(scopeString)
-	for _, scope := range scopes {
-		if scope != "" {
-			description := scopeDescriptions[scope]
-			if description == "" {
-				description = "访问 " + scope + " 权限"
-			}
-			result = append(result, map[string]string{
-				"scope":       scope,
-				"description": description,
-			})
-		}
-	}
-
-	return result
-}
-
-// splitBySpace 按空格分割字符串
-func splitBySpace(s string) []string {
-	var result []string
-	current := ""
-	for _, c := range s {
-		if c == ' ' {
-			if current != "" {
-				result = append(result, current)
-				current = ""
-			}
-		} else {
-			current += string(c)
-		}
-	}
-	if current != "" {
-		result = append(result, current)
-	}
-	return result
-}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"net/http"
+
+	"astro-pass/internal/services"
+	"astro-pass/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type DeviceAuthorizationController struct {
+	deviceService *services.DeviceAuthorizationService
+	scopeService  *services.ScopeService
+}
+
+func NewDeviceAuthorizationController() *DeviceAuthorizationController {
+	return &DeviceAuthorizationController{
+		deviceService: services.NewDeviceAuthorizationService(),
+		scopeService:  services.NewScopeService(),
+	}
+}
+
+// DeviceAuthorizationRequest 设备授权请求（RFC 8628 3.1节）
+type DeviceAuthorizationRequest struct {
+	// 客户端认证参数由 clientAuthFromRequest 读取
+	Scope string `form:"scope"`
+}
+
+// DeviceAuthorization 设备授权端点，签发device_code和user_code
+func (c *DeviceAuthorizationController) DeviceAuthorization(ctx *gin.Context) {
+	var req DeviceAuthorizationRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_request",
+			"error_description": err.Error(),
+		})
+		return
+	}
+
+	clientAuth := clientAuthFromRequest(ctx)
+	if clientAuth.ClientID == "" {
+		invalidClientError(ctx, "缺少client_id参数")
+		return
+	}
+
+	response, err := c.deviceService.RequestDeviceAuthorization(clientAuth, req.Scope)
+	if err != nil {
+		tokenEndpointError(ctx, err, "invalid_request")
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, response)
+}
+
+// GetDeviceVerification 根据用户码获取待确认的设备授权信息
+func (c *DeviceAuthorizationController) GetDeviceVerification(ctx *gin.Context) {
+	userCode := ctx.Query("user_code")
+	if userCode == "" {
+		utils.BadRequest(ctx, "缺少user_code参数")
+		return
+	}
+
+	info, err := c.deviceService.GetPendingAuthorization(userCode)
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	utils.Success(ctx, gin.H{
+		"user_code":   info.UserCode,
+		"client_id":   info.ClientID,
+		"client_name": info.ClientName,
+		"client_uri":  info.ClientURI,
+		"logo_uri":    info.LogoURI,
+		"scopes":      c.scopeService.DescribeScopes(info.Scope),
+		"expires_at":  info.ExpiresAt,
+	})
+}
+
+// VerifyDeviceRequest 用户确认设备授权请求
+type VerifyDeviceRequest struct {
+	UserCode string `json:"user_code" binding:"required"`
+	Approve  bool   `json:"approve"`
+}
+
+// VerifyDevice 用户输入用户码后批准或拒绝设备授权
+func (c *DeviceAuthorizationController) VerifyDevice(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	var req VerifyDeviceRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	if err := c.deviceService.ApproveDeviceAuthorization(req.UserCode, userID.(uint), req.Approve, authContextFromRequest(ctx)); err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	if req.Approve {
+		utils.SuccessWithMessage(ctx, "设备已授权，请返回设备继续操作", nil)
+	} else {
+		utils.SuccessWithMessage(ctx, "已拒绝设备授权", nil)
+	}
+}
@@ -1,6 +1,10 @@
 package controllers
 
 import (
+	"encoding/json"
+	"strconv"
+
+	"astro-pass/internal/models"
 	"astro-pass/internal/services"
 	"astro-pass/internal/utils"
 	"github.com/gin-gonic/gin"
@@ -8,20 +12,102 @@ import (
 
 type OAuth2ClientController struct {
 	oauth2Service *services.OAuth2Service
+	adminService  *services.ClientAdminService
 }
 
 func NewOAuth2ClientController() *OAuth2ClientController {
 	return &OAuth2ClientController{
 		oauth2Service: services.NewOAuth2Service(),
+		adminService:  services.NewClientAdminService(),
 	}
 }
 
 // CreateClientRequest 创建客户端请求
 type CreateClientRequest struct {
-	ClientName   string   `json:"client_name" binding:"required"`
-	ClientURI    string   `json:"client_uri"`
-	LogoURI      string   `json:"logo_uri"`
-	RedirectURIs []string `json:"redirect_uris" binding:"required"`
+	ClientName                        string          `json:"client_name" binding:"required"`
+	ClientURI                         string          `json:"client_uri"`
+	LogoURI                           string          `json:"logo_uri"`
+	RedirectURIs                      []string        `json:"redirect_uris" binding:"required"`
+	RequestURIs                       []string        `json:"request_uris"`                         // 请求对象（JAR）地址，需使用HTTPS
+	BackchannelLogoutURI              string          `json:"backchannel_logout_uri"`               // 用户登出时接收登出令牌的地址
+	BackchannelLogoutSessionRequired  bool            `json:"backchannel_logout_session_required"`  // 要求登出令牌包含sid
+	FrontchannelLogoutURI             string          `json:"frontchannel_logout_uri"`              // 登出页面以iframe加载的地址
+	FrontchannelLogoutSessionRequired bool            `json:"frontchannel_logout_session_required"` // 要求登出地址携带iss和sid
+	RequirePKCE                       bool            `json:"require_pkce"`
+	RequirePAR                        bool            `json:"require_pushed_authorization_requests"`                     // 强制通过PAR发起授权请求
+	RequireDPoP                       bool            `json:"dpop_bound_access_tokens"`                                  // 强制令牌绑定DPoP密钥
+	RequireMTLSBinding                bool            `json:"tls_client_certificate_bound_access_tokens"`                // 令牌绑定双向TLS的客户端证书
+	ClientType                        string          `json:"client_type" binding:"omitempty,oneof=confidential public"` // 浏览器和原生应用应注册为public
+	TokenEndpointAuthMethod           string          `json:"token_endpoint_auth_method" binding:"omitempty,oneof=client_secret_basic client_secret_post client_secret_jwt private_key_jwt tls_client_auth self_signed_tls_client_auth none"`
+	GrantTypes                        []string        `json:"grant_types"` // 默认为 authorization_code 和 refresh_token
+	JWKS                              json.RawMessage `json:"jwks"`        // private_key_jwt、self_signed_tls_client_auth 的内联公钥集
+	JWKSURI                           string          `json:"jwks_uri"`    // 公钥集地址，与jwks二选一
+	Scope                             string          `json:"scope"`       // 客户端可申请的scope，空格分隔
+	services.TLSClientAuthIdentity                    // tls_client_auth 的证书身份，只能设置一项
+	services.ClientTokenLifetimes                     // 覆盖全局配置的令牌有效期（秒）
+}
+
+// registration 转换为客户端注册参数
+func (req *CreateClientRequest) registration() *services.ClientRegistration {
+	return &services.ClientRegistration{
+		ClientName:                        req.ClientName,
+		ClientURI:                         req.ClientURI,
+		LogoURI:                           req.LogoURI,
+		RedirectURIs:                      req.RedirectURIs,
+		RequestURIs:                       req.RequestURIs,
+		BackchannelLogoutURI:              req.BackchannelLogoutURI,
+		BackchannelLogoutSessionRequired:  req.BackchannelLogoutSessionRequired,
+		FrontchannelLogoutURI:             req.FrontchannelLogoutURI,
+		FrontchannelLogoutSessionRequired: req.FrontchannelLogoutSessionRequired,
+		ClientType:                        req.ClientType,
+		TokenEndpointAuthMethod:           req.TokenEndpointAuthMethod,
+		RequirePKCE:                       req.RequirePKCE,
+		RequirePAR:                        req.RequirePAR,
+		RequireDPoP:                       req.RequireDPoP,
+		RequireMTLSBinding:                req.RequireMTLSBinding,
+		GrantTypes:                        req.GrantTypes,
+		JWKS:                              rawJSONString(req.JWKS),
+		JWKSURI:                           req.JWKSURI,
+		Scope:                             req.Scope,
+		TLSClientAuth:                     req.TLSClientAuthIdentity,
+		TokenLifetimes:                    req.ClientTokenLifetimes,
+	}
+}
+
+// clientDetails 客户端信息（不含密钥等敏感信息）
+func clientDetails(client *models.OAuth2Client) gin.H {
+	return gin.H{
+		"id":                                    client.ID,
+		"client_id":                             client.ClientID,
+		"client_name":                           client.ClientName,
+		"client_uri":                            client.ClientURI,
+		"logo_uri":                              client.LogoURI,
+		"client_type":                           client.ClientType,
+		"token_endpoint_auth_method":            client.TokenEndpointAuthMethod,
+		"redirect_uris":                         services.ClientRedirectURIs(client),
+		"request_uris":                          services.ClientRequestURIs(client),
+		"backchannel_logout_uri":                client.BackchannelLogoutURI,
+		"backchannel_logout_session_required":   client.BackchannelLogoutSessionRequired,
+		"frontchannel_logout_uri":               client.FrontchannelLogoutURI,
+		"frontchannel_logout_session_required":  client.FrontchannelLogoutSessionRequired,
+		"grant_types":                           services.ClientGrantTypes(client),
+		"scope":                                 client.Scope,
+		"require_pkce":                          client.RequirePKCE,
+		"require_pushed_authorization_requests": client.RequirePAR,
+		"dpop_bound_access_tokens":              client.RequireDPoP,
+		"tls_client_certificate_bound_access_tokens": client.RequireMTLSBinding,
+		"jwks_uri":                        client.JWKSURI,
+		"status":                          client.Status,
+		"created_at":                      client.CreatedAt,
+		"updated_at":                      client.UpdatedAt,
+		"client_secret_issued_at":         client.ClientSecretIssuedAt,
+		"client_secret_expires_at":        client.ClientSecretExpiresAt,
+		"previous_secret_expires_at":      client.PreviousSecretExpiresAt,
+		"access_token_lifetime":           client.AccessTokenLifetime,
+		"id_token_lifetime":               client.IDTokenLifetime,
+		"refresh_token_idle_timeout":      client.RefreshTokenIdleTimeout,
+		"refresh_token_absolute_lifetime": client.RefreshTokenAbsoluteLifetime,
+	}
 }
 
 // CreateClient 创建OAuth2客户端
@@ -38,26 +124,18 @@ func (c *OAuth2ClientController) CreateClient(ctx *gin.Context) {
 		return
 	}
 
-	client, err := c.oauth2Service.CreateClient(
-		userID.(uint),
-		req.ClientName,
-		req.ClientURI,
-		req.LogoURI,
-		req.RedirectURIs,
-	)
+	client, clientSecret, err := c.oauth2Service.CreateClient(userID.(uint), req.registration())
 	if err != nil {
 		utils.BadRequest(ctx, err.Error())
 		return
 	}
 
-	utils.SuccessWithMessage(ctx, "客户端创建成功", gin.H{
-		"client_id":    client.ClientID,
-		"client_name":  client.ClientName,
-		"client_uri":   client.ClientURI,
-		"logo_uri":     client.LogoURI,
-		"status":       client.Status,
-		"client_secret": client.ClientSecret, // 只在创建时返回一次
-	})
+	data := clientDetails(client)
+	if clientSecret != "" {
+		data["client_secret"] = clientSecret // 只在创建时返回一次，服务端仅保存摘要
+	}
+
+	utils.SuccessWithMessage(ctx, "客户端创建成功", data)
 }
 
 // GetUserClients 获取用户的OAuth2客户端列表
@@ -76,21 +154,42 @@ func (c *OAuth2ClientController) GetUserClients(ctx *gin.Context) {
 
 	// 隐藏敏感信息
 	clientList := make([]gin.H, 0, len(clients))
-	for _, client := range clients {
-		clientList = append(clientList, gin.H{
-			"id":          client.ID,
-			"client_id":   client.ClientID,
-			"client_name": client.ClientName,
-			"client_uri":  client.ClientURI,
-			"logo_uri":    client.LogoURI,
-			"status":      client.Status,
-			"created_at":  client.CreatedAt,
-		})
+	for i := range clients {
+		clientList = append(clientList, clientDetails(&clients[i]))
 	}
 
 	utils.Success(ctx, clientList)
 }
 
+// UpdateClient 客户端所有者以请求中的配置整体替换客户端配置
+// 认证方式变更后需要新密钥时，新密钥仅在响应中返回一次
+func (c *OAuth2ClientController) UpdateClient(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	var req CreateClientRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	client, newSecret, err := c.oauth2Service.UpdateClient(ctx.Param("id"), userID.(uint), req.registration(), ctx.ClientIP(), ctx.GetHeader("User-Agent"))
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	data := clientDetails(client)
+	if newSecret != "" {
+		data["client_secret"] = newSecret
+	}
+
+	utils.SuccessWithMessage(ctx, "客户端已更新", data)
+}
+
 // RevokeClient 撤销客户端
 func (c *OAuth2ClientController) RevokeClient(ctx *gin.Context) {
 	userID, exists := ctx.Get("user_id")
@@ -108,3 +207,193 @@ func (c *OAuth2ClientController) RevokeClient(ctx *gin.Context) {
 	utils.SuccessWithMessage(ctx, "客户端已撤销", nil)
 }
 
+// RotateClientSecret 轮换客户端密钥，新密钥仅返回一次，旧密钥在宽限期内仍可使用
+func (c *OAuth2ClientController) RotateClientSecret(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	clientID := ctx.Param("id")
+	rotation, err := c.oauth2Service.RotateClientSecret(clientID, userID.(uint), ctx.ClientIP(), ctx.GetHeader("User-Agent"))
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "客户端密钥已轮换，请妥善保存，新密钥仅显示一次", rotation)
+}
+
+// pagination 解析分页参数，page_size最大为100
+func pagination(ctx *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(ctx.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
+
+// adminClientDetails 管理员视图的客户端信息，附带所有者
+func adminClientDetails(client *models.OAuth2Client) gin.H {
+	data := clientDetails(client)
+	data["owner"] = gin.H{
+		"id":       client.User.ID,
+		"username": client.User.Username,
+		"email":    client.User.Email,
+	}
+	return data
+}
+
+// AdminListClients 管理员检索全部客户端
+func (c *OAuth2ClientController) AdminListClients(ctx *gin.Context) {
+	page, pageSize := pagination(ctx)
+	query := &services.ClientSearchQuery{
+		Search:   ctx.Query("search"),
+		Status:   ctx.Query("status"),
+		Page:     page,
+		PageSize: pageSize,
+	}
+	if ownerID := ctx.Query("owner_id"); ownerID != "" {
+		id, err := strconv.ParseUint(ownerID, 10, 32)
+		if err != nil {
+			utils.BadRequest(ctx, "无效的owner_id")
+			return
+		}
+		query.OwnerID = uint(id)
+	}
+
+	clients, total, err := c.adminService.SearchClients(query)
+	if err != nil {
+		utils.InternalError(ctx, "获取客户端列表失败")
+		return
+	}
+
+	clientList := make([]gin.H, 0, len(clients))
+	for i := range clients {
+		clientList = append(clientList, adminClientDetails(&clients[i]))
+	}
+
+	utils.Success(ctx, gin.H{
+		"clients": clientList,
+		"pagination": gin.H{
+			"page":        page,
+			"page_size":   pageSize,
+			"total":       total,
+			"total_pages": (int(total) + pageSize - 1) / pageSize,
+		},
+	})
+}
+
+// AdminGetClient 管理员查看客户端详情
+func (c *OAuth2ClientController) AdminGetClient(ctx *gin.Context) {
+	client, err := c.adminService.GetClient(ctx.Param("client_id"))
+	if err != nil {
+		utils.NotFound(ctx, err.Error())
+		return
+	}
+
+	utils.Success(ctx, adminClientDetails(client))
+}
+
+// SuspendClientRequest 暂停客户端请求
+type SuspendClientRequest struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// AdminSuspendClient 管理员暂停客户端
+func (c *OAuth2ClientController) AdminSuspendClient(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	var req SuspendClientRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && ctx.Request.ContentLength > 0 {
+		utils.BadRequest(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	client, err := c.adminService.SuspendClient(ctx.Param("client_id"), req.Reason, userID.(uint), ctx.ClientIP(), ctx.GetHeader("User-Agent"))
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "客户端已暂停", adminClientDetails(client))
+}
+
+// AdminReactivateClient 管理员恢复已暂停的客户端
+func (c *OAuth2ClientController) AdminReactivateClient(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	client, err := c.adminService.ReactivateClient(ctx.Param("client_id"), userID.(uint), ctx.ClientIP(), ctx.GetHeader("User-Agent"))
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "客户端已恢复", adminClientDetails(client))
+}
+
+// TransferClientRequest 转移客户端所有权请求
+type TransferClientRequest struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+// AdminTransferClient 管理员将客户端转移给其他用户
+func (c *OAuth2ClientController) AdminTransferClient(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	var req TransferClientRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	client, err := c.adminService.TransferClient(ctx.Param("client_id"), req.UserID, userID.(uint), ctx.ClientIP(), ctx.GetHeader("User-Agent"))
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "客户端所有权已转移", adminClientDetails(client))
+}
+
+// AdminGetClientAuditLogs 管理员查看客户端相关的审计日志
+func (c *OAuth2ClientController) AdminGetClientAuditLogs(ctx *gin.Context) {
+	page, pageSize := pagination(ctx)
+	logs, total, err := c.adminService.GetClientAuditLogs(ctx.Param("client_id"), page, pageSize)
+	if err != nil {
+		utils.InternalError(ctx, "获取审计日志失败")
+		return
+	}
+
+	utils.Success(ctx, gin.H{
+		"logs":      logs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// rawJSONString 将可选的JSON字段转换为字符串，未提供或为null时返回空串
+func rawJSONString(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
@@ -1,171 +1,697 @@
 package controllers
 
 import (
+	"errors"
+	"html/template"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"astro-pass/internal/config"
+	"astro-pass/internal/models"
 	"astro-pass/internal/services"
+	"astro-pass/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
 type OAuth2Controller struct {
-	oauth2Service *services.OAuth2Service
+	oauth2Service        *services.OAuth2Service
+	deviceService        *services.DeviceAuthorizationService
+	parService           *services.PushedAuthorizationService
+	requestObjectService *services.RequestObjectService
+	dpopService          *services.DPoPService
+	mtlsService          *services.MTLSService
+	sloService           *services.SLOService
 }
 
 func NewOAuth2Controller() *OAuth2Controller {
 	return &OAuth2Controller{
-		oauth2Service: services.NewOAuth2Service(),
+		oauth2Service:        services.NewOAuth2Service(),
+		deviceService:        services.NewDeviceAuthorizationService(),
+		parService:           services.NewPushedAuthorizationService(),
+		requestObjectService: services.NewRequestObjectService(),
+		dpopService:          services.NewDPoPService(),
+		mtlsService:          services.NewMTLSService(),
+		sloService:           services.NewSLOService(),
 	}
 }
 
 // AuthorizeRequest 授权请求
+// 使用request（RFC 9101）或request_uri（RFC 9101、RFC 9126）时只需client_id，其余参数取自请求对象或推送的授权请求
 type AuthorizeRequest struct {
-	ResponseType        string `form:"response_type" binding:"required"`
-	ClientID            string `form:"client_id" binding:"required"`
-	RedirectURI         string `form:"redirect_uri" binding:"required"`
-	Scope               string `form:"scope"`
-	State               string `form:"state"`
-	CodeChallenge       string `form:"code_challenge"`
-	CodeChallengeMethod string `form:"code_challenge_method"`
+	ResponseType        string   `form:"response_type"`
+	ClientID            string   `form:"client_id" binding:"required"`
+	RedirectURI         string   `form:"redirect_uri"`
+	Scope               string   `form:"scope"`
+	State               string   `form:"state"`
+	Nonce               string   `form:"nonce"`
+	CodeChallenge       string   `form:"code_challenge"`
+	CodeChallengeMethod string   `form:"code_challenge_method"`
+	ResponseMode        string   `form:"response_mode"`
+	Resource            []string `form:"resource"` // 资源指示（RFC 8707），可出现多次
+	Claims              string   `form:"claims"`   // OIDC claims请求参数（OIDC Core 5.5节），JSON对象
+	Prompt              string   `form:"prompt"`   // none、login、consent、select_account，空格分隔
+	MaxAge              string   `form:"max_age"`  // 允许的最长认证时长（秒）
+	LoginHint           string   `form:"login_hint"`
+	ACRValues           string   `form:"acr_values"`
+	Request             string   `form:"request"`
+	RequestURI          string   `form:"request_uri"`
+	// LoginRequest 授权端点要求重新登录时签发的凭据，登录页面完成登录后携带它返回授权端点
+	LoginRequest string `form:"login_request"`
+}
+
+// applyRequestParams 用请求对象或推送授权请求中的参数替换查询参数（RFC 9101 6.3节、RFC 9126 4节）
+func (req *AuthorizeRequest) applyRequestParams(params *services.AuthorizationRequestParams) {
+	req.ResponseType = params.ResponseType
+	req.ResponseMode = params.ResponseMode
+	req.RedirectURI = params.RedirectURI
+	req.Scope = params.Scope
+	req.State = params.State
+	req.Nonce = params.Nonce
+	req.CodeChallenge = params.CodeChallenge
+	req.CodeChallengeMethod = params.CodeChallengeMethod
+	req.Resource = params.Resource
+	req.Claims = params.Claims
+	req.Prompt = params.Prompt
+	req.MaxAge = params.MaxAge
+	req.LoginHint = params.LoginHint
+	req.ACRValues = params.ACRValues
+}
+
+// consentQuery 构建同意页面的查询参数
+// 请求对象和推送授权请求只传递client_id和request/request_uri，同意页面再从服务端解析其余参数
+func (req *AuthorizeRequest) consentQuery() url.Values {
+	query := url.Values{}
+	query.Set("client_id", req.ClientID)
+	if req.LoginRequest != "" {
+		query.Set("login_request", req.LoginRequest)
+	}
+	if req.RequestURI != "" {
+		query.Set("request_uri", req.RequestURI)
+		return query
+	}
+	if req.Request != "" {
+		query.Set("request", req.Request)
+		return query
+	}
+
+	query.Set("response_type", req.ResponseType)
+	query.Set("redirect_uri", req.RedirectURI)
+	query.Set("scope", req.Scope)
+	query.Set("state", req.State)
+	if req.CodeChallenge != "" {
+		query.Set("code_challenge", req.CodeChallenge)
+		query.Set("code_challenge_method", req.CodeChallengeMethod)
+	}
+	if req.Nonce != "" {
+		query.Set("nonce", req.Nonce)
+	}
+	if req.ResponseMode != "" {
+		query.Set("response_mode", req.ResponseMode)
+	}
+	for _, resource := range req.Resource {
+		query.Add("resource", resource)
+	}
+	if req.Claims != "" {
+		query.Set("claims", req.Claims)
+	}
+	for name, value := range map[string]string{
+		"prompt":     req.Prompt,
+		"max_age":    req.MaxAge,
+		"login_hint": req.LoginHint,
+		"acr_values": req.ACRValues,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	return query
+}
+
+// loginURL 构建要求用户（重新）登录时的登录页面地址，登录后携带服务端签发的login_request返回当前授权请求
+func (req *AuthorizeRequest) loginURL(ctx *gin.Context, auth *services.AuthenticationRequirements) (string, error) {
+	loginRequest, err := utils.GenerateLoginRequestToken(req.ClientID, req.RedirectURI)
+	if err != nil {
+		return "", err
+	}
+	returnQuery := ctx.Request.URL.Query()
+	returnQuery.Set("login_request", loginRequest)
+
+	query := url.Values{}
+	query.Set("return_to", ctx.Request.URL.Path+"?"+returnQuery.Encode())
+	if auth.LoginHint != "" {
+		query.Set("login_hint", auth.LoginHint)
+	}
+	if len(auth.ACRValues) > 0 {
+		query.Set("acr_values", strings.Join(auth.ACRValues, " "))
+	}
+	return "/login?" + query.Encode(), nil
+}
+
+// authorizationError 授权请求的错误响应：redirect_uri已注册时将错误重定向回客户端（OIDC Core 3.1.2.6节），否则直接返回
+func authorizationError(ctx *gin.Context, client *models.OAuth2Client, req *AuthorizeRequest, code, description string) {
+	if !services.IsRegisteredRedirectURI(client, req.RedirectURI) {
+		utils.OAuthError(ctx, http.StatusBadRequest, code, description)
+		return
+	}
+	sendAuthorizationResponse(ctx, client.ClientID, req.RedirectURI, req.ResponseMode, map[string]string{
+		"error":             code,
+		"error_description": description,
+		"state":             req.State,
+	})
 }
 
 // TokenRequest 令牌请求
 type TokenRequest struct {
-	GrantType    string `form:"grant_type" binding:"required"`
-	Code         string `form:"code"`
-	RedirectURI  string `form:"redirect_uri"`
-	ClientID     string `form:"client_id" binding:"required"`
-	ClientSecret string `form:"client_secret" binding:"required"`
-	CodeVerifier string `form:"code_verifier"`
+	GrantType   string `form:"grant_type" binding:"required"`
+	Code        string `form:"code"`
+	RedirectURI string `form:"redirect_uri"`
+	// 客户端认证参数（client_id、client_secret、client_assertion等）由 clientAuthFromRequest 读取
+	CodeVerifier string   `form:"code_verifier"`
+	DeviceCode   string   `form:"device_code"` // 设备授权模式
+	Resource     []string `form:"resource"`    // 资源指示（RFC 8707），决定访问令牌的受众
+
+	// 令牌交换参数（RFC 8693）
+	SubjectToken       string   `form:"subject_token"`
+	SubjectTokenType   string   `form:"subject_token_type"`
+	ActorToken         string   `form:"actor_token"`
+	ActorTokenType     string   `form:"actor_token_type"`
+	RequestedTokenType string   `form:"requested_token_type"`
+	RequestedSubject   string   `form:"requested_subject"`
+	Audience           []string `form:"audience"`
+}
+
+// clientAuthFromRequest 获取客户端认证信息
+// 优先使用HTTP Basic认证（client_secret_basic），否则使用表单中的client_secret或client_assertion（RFC 7523），
+// 同时附带双向TLS连接中的客户端证书（RFC 8705）
+func clientAuthFromRequest(ctx *gin.Context) *services.ClientAuthentication {
+	auth := &services.ClientAuthentication{
+		ClientID:            ctx.PostForm("client_id"),
+		ClientSecret:        ctx.PostForm("client_secret"),
+		ClientAssertionType: ctx.PostForm("client_assertion_type"),
+		ClientAssertion:     ctx.PostForm("client_assertion"),
+		ClientCertificates:  services.ClientCertificatesFromRequest(ctx.Request),
+		Issuer:              ctx.GetString("issuer"),
+	}
+
+	if username, password, ok := ctx.Request.BasicAuth(); ok {
+		// RFC 6749 2.3.1：Basic认证中的凭证需先进行表单URL编码
+		if clientID, err := url.QueryUnescape(username); err == nil {
+			username = clientID
+		}
+		if clientSecret, err := url.QueryUnescape(password); err == nil {
+			password = clientSecret
+		}
+		auth.ClientID, auth.ClientSecret = username, password
+	}
+
+	// 使用断言认证时client_id可省略，取断言的iss
+	if auth.ClientID == "" && auth.ClientAssertion != "" {
+		auth.ClientID = services.ClientIDFromAssertion(auth.ClientAssertion)
+	}
+
+	return auth
+}
+
+// tokenErrorCode 令牌端点的错误码：资源指示无效时为invalid_target（RFC 8707 2节），
+// scope超出允许范围时为invalid_scope，客户端未注册该授权类型时为unauthorized_client，
+// 客户端认证失败时为invalid_client，服务端内部错误时为server_error（RFC 6749 5.2节），否则为defaultCode
+func tokenErrorCode(err error, defaultCode string) string {
+	var targetErr *services.InvalidTargetError
+	if errors.As(err, &targetErr) {
+		return "invalid_target"
+	}
+	var scopeErr *services.InvalidScopeError
+	if errors.As(err, &scopeErr) {
+		return "invalid_scope"
+	}
+	var clientErr *services.UnauthorizedClientError
+	if errors.As(err, &clientErr) {
+		return "unauthorized_client"
+	}
+	var authErr *services.InvalidClientError
+	if errors.As(err, &authErr) {
+		return "invalid_client"
+	}
+	var serverErr *services.ServerError
+	if errors.As(err, &serverErr) {
+		return "server_error"
+	}
+	return defaultCode
+}
+
+// tokenEndpointError 令牌端点及其他客户端认证端点的错误响应（RFC 6749 5.2节）
+// invalid_client返回401，server_error返回500，其余错误返回400
+func tokenEndpointError(ctx *gin.Context, err error, defaultCode string) {
+	switch code := tokenErrorCode(err, defaultCode); code {
+	case "invalid_client":
+		invalidClientError(ctx, err.Error())
+	case "server_error":
+		utils.OAuthError(ctx, http.StatusInternalServerError, code, err.Error())
+	default:
+		utils.OAuthError(ctx, http.StatusBadRequest, code, err.Error())
+	}
+}
+
+// invalidClientError 客户端认证失败响应，客户端通过Authorization头认证时须附带WWW-Authenticate头（RFC 6749 5.2节）
+func invalidClientError(ctx *gin.Context, description string) {
+	if _, _, ok := ctx.Request.BasicAuth(); ok {
+		ctx.Header("WWW-Authenticate", `Basic realm="`+config.Cfg.App.URL+`"`)
+	}
+	utils.OAuthError(ctx, http.StatusUnauthorized, "invalid_client", description)
+}
+
+// dpopProofFromRequest 读取DPoP请求头；出现多个DPoP头时合并返回，由校验逻辑拒绝
+func dpopProofFromRequest(ctx *gin.Context) (string, bool) {
+	values := ctx.Request.Header.Values("DPoP")
+	if len(values) == 0 {
+		return "", false
+	}
+	return strings.Join(values, ","), true
+}
+
+// splitAuthorizationHeader 拆分Authorization头中的认证方案和令牌
+func splitAuthorizationHeader(authHeader string) (string, string) {
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], strings.TrimSpace(parts[1])
+}
+
+// dpopTokenEndpointError 令牌端点的DPoP错误响应（RFC 9449 5节、8节）
+func dpopTokenEndpointError(ctx *gin.Context, err error) {
+	code, description := utils.DPoPErrorInvalidProof, err.Error()
+	var dpopErr *utils.DPoPError
+	if errors.As(err, &dpopErr) {
+		code = dpopErr.Code
+	}
+	if code == utils.DPoPErrorUseNonce {
+		ctx.Header("DPoP-Nonce", utils.GenerateDPoPNonce())
+	}
+	ctx.JSON(http.StatusBadRequest, gin.H{
+		"error":             code,
+		"error_description": description,
+	})
 }
 
 // Authorize OAuth2授权端点
+// redirect_uri校验通过前的错误直接返回给用户代理，之后的错误按RFC 6749 4.1.2.1节重定向回客户端
 func (c *OAuth2Controller) Authorize(ctx *gin.Context) {
 	var req AuthorizeRequest
 	if err := ctx.ShouldBindQuery(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "请求参数错误",
-			"error":   err.Error(),
-		})
+		utils.OAuthError(ctx, http.StatusBadRequest, "invalid_request", "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 验证客户端
+	client, err := c.oauth2Service.GetClientByClientID(req.ClientID)
+	if err != nil {
+		utils.OAuthError(ctx, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	// 解析推送的授权请求（RFC 9126）或请求对象（RFC 9101）
+	pushed := req.RequestURI != "" && services.IsPushedRequestURI(req.RequestURI)
+	if pushed {
+		params, err := c.parService.ResolveAuthorizationRequest(client.ClientID, req.RequestURI)
+		if err != nil {
+			utils.OAuthError(ctx, http.StatusBadRequest, "invalid_request_uri", err.Error())
+			return
+		}
+		req.applyRequestParams(params)
+	} else if client.RequirePAR {
+		utils.OAuthError(ctx, http.StatusBadRequest, "invalid_request", "该客户端要求通过推送授权请求（PAR）发起授权")
+		return
+	} else if req.Request != "" || req.RequestURI != "" {
+		params, err := c.requestObjectService.ResolveRequestObject(client, req.Request, req.RequestURI)
+		if err != nil {
+			code := "invalid_request_object"
+			if req.Request == "" {
+				code = "invalid_request_uri"
+			}
+			utils.OAuthError(ctx, http.StatusBadRequest, code, err.Error())
+			return
+		}
+		req.applyRequestParams(params)
+	}
+
+	// redirect_uri缺失或未注册时不能重定向（RFC 6749 4.1.2.1节）
+	if req.RedirectURI == "" {
+		utils.OAuthError(ctx, http.StatusBadRequest, "invalid_request", "缺少redirect_uri参数")
+		return
+	}
+	if !services.IsRegisteredRedirectURI(client, req.RedirectURI) {
+		utils.OAuthError(ctx, http.StatusBadRequest, "invalid_request", "redirect_uri未注册")
+		return
+	}
+
+	// 不支持的response_mode按默认模式返回错误
+	if !services.IsSupportedResponseMode(req.ResponseMode) {
+		req.ResponseMode = ""
+		authorizationError(ctx, client, &req, "invalid_request", "不支持的response_mode")
 		return
 	}
 
 	// 验证response_type
 	if req.ResponseType != "code" {
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "不支持的response_type",
-		})
+		authorizationError(ctx, client, &req, "unsupported_response_type", "不支持的response_type")
+		return
+	}
+	if err := services.CheckClientGrantType(client, "authorization_code"); err != nil {
+		authorizationError(ctx, client, &req, "unauthorized_client", err.Error())
+		return
+	}
+
+	// 验证scope在客户端允许的范围内，未指定时使用客户端的默认scope
+	scope, err := services.ResolveClientScope(client, req.Scope)
+	if err != nil {
+		authorizationError(ctx, client, &req, "invalid_scope", err.Error())
+		return
+	}
+	req.Scope = scope
+
+	// 解析OIDC claims请求参数
+	claimsRequest, err := services.ParseClaimsRequest(req.Claims, req.Scope)
+	if err != nil {
+		authorizationError(ctx, client, &req, "invalid_request", err.Error())
+		return
+	}
+
+	// 解析prompt、max_age、login_hint和acr_values（OIDC Core 3.1.2.1节）
+	authRequirements, err := services.ParseAuthenticationRequirements(req.Prompt, req.MaxAge, req.LoginHint, req.ACRValues)
+	if err != nil {
+		authorizationError(ctx, client, &req, "invalid_request", err.Error())
+		return
+	}
+
+	// 验证PKCE参数（RFC 7636）
+	codeChallengeMethod, err := c.oauth2Service.ValidatePKCEChallenge(client, req.CodeChallenge, req.CodeChallengeMethod)
+	if err != nil {
+		authorizationError(ctx, client, &req, "invalid_request", err.Error())
+		return
+	}
+	req.CodeChallengeMethod = codeChallengeMethod
+
+	// 验证资源指示（RFC 8707）
+	if err := services.ValidateResourceIndicators(req.Resource); err != nil {
+		authorizationError(ctx, client, &req, "invalid_target", err.Error())
+		return
+	}
+
+	// 用户在同意页面拒绝授权
+	if ctx.Query("consent") == "denied" {
+		authorizationError(ctx, client, &req, "access_denied", "用户拒绝授权")
 		return
 	}
 
-	// 检查用户是否已登录
-	userID, exists := ctx.Get("user_id")
-	if !exists {
-		// 重定向到登录页面
+	// 检查用户是否已登录，以及当前登录能否满足prompt=login、max_age、login_hint和acr_values的要求
+	var user *models.User
+	reason := "请先登录"
+	if userID, exists := ctx.Get("user_id"); exists {
+		if user, err = services.NewUserService().GetUserByID(userID.(uint)); err == nil {
+			loginRequestedAt := services.LoginRequestedAt(req.LoginRequest, req.ClientID, req.RedirectURI)
+			reason = authRequirements.ReauthenticationReason(user, authContextFromRequest(ctx), loginRequestedAt, time.Now())
+		}
+	}
+	if reason != "" {
+		// prompt=none时不能与用户交互（OIDC Core 3.1.2.6节）
+		if authRequirements.HasPrompt(services.PromptNone) {
+			authorizationError(ctx, client, &req, "login_required", reason)
+			return
+		}
+		// 由登录页面完成（重新）登录或MFA验证后返回授权端点
+		loginURL, err := req.loginURL(ctx, authRequirements)
+		if err != nil {
+			authorizationError(ctx, client, &req, "server_error", "生成登录请求失败")
+			return
+		}
 		ctx.JSON(http.StatusUnauthorized, gin.H{
-			"code":    401,
-			"message": "请先登录",
-			"login_url": "/api/auth/login",
+			"error":             "login_required",
+			"error_description": reason,
+			"login_url":         loginURL,
+			"login_hint":        authRequirements.LoginHint,
+			"acr_values":        strings.Join(authRequirements.ACRValues, " "),
 		})
 		return
 	}
 
-	// 检查是否已经批准过授权
+	// claims参数指定了sub时只能为该用户签发令牌（OIDC Core 5.5.1节）
+	if err := claimsRequest.CheckSubject(user.UUID); err != nil {
+		authorizationError(ctx, client, &req, "access_denied", err.Error())
+		return
+	}
+
+	// 检查是否已经批准过授权，通过claims参数请求的声明同样需要用户同意；prompt=consent时总是重新征求同意
 	consentService := services.NewConsentService()
-	hasConsent, err := consentService.CheckConsent(userID.(uint), req.ClientID, req.Scope)
+	requestedClaims := services.NewScopeService().RequestedClaimNames(claimsRequest)
+	hasConsent, err := consentService.CheckConsent(user.ID, req.ClientID, req.Scope, requestedClaims)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "检查授权失败",
-		})
+		authorizationError(ctx, client, &req, "server_error", "检查授权失败")
 		return
 	}
 
-	// 检查是否是从同意页面返回的
-	consentApproved := ctx.Query("consent")
-	
-	// 如果没有授权且不是从同意页面返回，重定向到同意页面
-	if !hasConsent && consentApproved != "approved" {
-		// 构建同意页面URL
-		consentURL := "/oauth2/consent?response_type=" + req.ResponseType +
-			"&client_id=" + req.ClientID +
-			"&redirect_uri=" + req.RedirectURI +
-			"&scope=" + req.Scope +
-			"&state=" + req.State
-		
-		if req.CodeChallenge != "" {
-			consentURL += "&code_challenge=" + req.CodeChallenge +
-				"&code_challenge_method=" + req.CodeChallengeMethod
+	// 需要征求同意时，只接受同意页面为本次请求签发的一次性批准凭据
+	if (!hasConsent || authRequirements.HasPrompt(services.PromptConsent)) &&
+		!consentService.ConsumeApproval(ctx.Query("consent_ticket"), user.ID, req.ClientID, req.RedirectURI, req.Scope, requestedClaims) {
+		if authRequirements.HasPrompt(services.PromptNone) {
+			authorizationError(ctx, client, &req, "consent_required", "需要用户同意授权")
+			return
 		}
-
-		ctx.Redirect(http.StatusFound, consentURL)
+		ctx.Redirect(http.StatusFound, "/oauth2/consent?"+req.consentQuery().Encode())
 		return
 	}
 
+	// 推送授权请求的request_uri仅能使用一次
+	if pushed {
+		if err := c.parService.ConsumeRequestURI(req.RequestURI); err != nil {
+			authorizationError(ctx, client, &req, "invalid_request_uri", err.Error())
+			return
+		}
+	}
+
 	// 生成授权码
-	code, err := c.oauth2Service.GenerateAuthorizationCode(
-		req.ClientID,
-		userID.(uint),
-		req.RedirectURI,
-		req.Scope,
-		req.CodeChallenge,
-		req.CodeChallengeMethod,
-	)
+	code, err := c.oauth2Service.GenerateAuthorizationCode(&services.AuthorizationCodeRequest{
+		ClientID:            req.ClientID,
+		UserID:              user.ID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		Claims:              claimsRequest,
+		Resources:           req.Resource,
+		Auth:                authContextFromRequest(ctx),
+	})
+	if err != nil {
+		authorizationError(ctx, client, &req, tokenErrorCode(err, "invalid_request"), err.Error())
+		return
+	}
+
+	params := map[string]string{
+		"code":  code,
+		"state": req.State,
+	}
+	// OIDC会话管理：返回session_state，并写入check_session_iframe比对所用的浏览器状态
+	sid := ctx.GetString("sid")
+	if sessionState := c.sloService.SessionState(req.ClientID, req.RedirectURI, req.Scope, sid); sessionState != "" {
+		setBrowserStateCookie(ctx, sid, 0)
+		params["session_state"] = sessionState
+	}
+
+	sendAuthorizationResponse(ctx, req.ClientID, req.RedirectURI, req.ResponseMode, params)
+}
+
+// formPostTemplate form_post.jwt 响应页面，自动将授权响应POST到客户端
+var formPostTemplate = template.Must(template.New("form_post").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Submit This Form</title></head>
+<body onload="javascript:document.forms[0].submit()">
+<form method="post" action="{{.Action}}">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}"/>
+{{end}}<noscript><button type="submit">继续</button></noscript>
+</form>
+</body>
+</html>`))
+
+// sendAuthorizationResponse 按response_mode将授权响应返回给客户端
+// jwt、query.jwt、form_post.jwt 模式下响应参数被封装为签名的JWT（JARM），iss为请求所属的签发者
+func sendAuthorizationResponse(ctx *gin.Context, clientID, redirectURI, responseMode string, params map[string]string) {
+	switch responseMode {
+	case services.ResponseModeJWT, services.ResponseModeQueryJWT, services.ResponseModeFormPostJWT:
+		issuer := ctx.GetString("issuer")
+		if issuer == "" {
+			issuer = utils.PrimaryIssuer()
+		}
+		response, err := utils.GenerateAuthorizationResponseJWT(issuer, clientID, params)
+		if err != nil {
+			utils.OAuthError(ctx, http.StatusInternalServerError, "server_error", "生成授权响应失败")
+			return
+		}
+		params = map[string]string{"response": response}
+	}
+
+	if responseMode == services.ResponseModeFormPostJWT {
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Header("Content-Type", "text/html; charset=utf-8")
+		ctx.Status(http.StatusOK)
+		if err := formPostTemplate.Execute(ctx.Writer, gin.H{
+			"Action": redirectURI,
+			"Params": params,
+		}); err != nil {
+			utils.Error("渲染form_post响应失败: %v", err)
+		}
+		return
+	}
+
+	// 授权码响应默认使用query模式（jwt模式对授权码响应等同于query.jwt）
+	redirectURL, err := url.Parse(redirectURI)
+	if err != nil {
+		utils.OAuthError(ctx, http.StatusBadRequest, "invalid_request", "无效的redirect_uri")
+		return
+	}
+	query := redirectURL.Query()
+	for key, value := range params {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	redirectURL.RawQuery = query.Encode()
+
+	ctx.Redirect(http.StatusFound, redirectURL.String())
+}
+
+// PushAuthorizationRequest 推送授权请求端点（RFC 9126），客户端预先提交授权参数并获得request_uri
+func (c *OAuth2Controller) PushAuthorizationRequest(ctx *gin.Context) {
+	clientAuth := clientAuthFromRequest(ctx)
+	if clientAuth.ClientID == "" {
+		invalidClientError(ctx, "缺少client_id参数")
+		return
+	}
+
+	client, err := c.oauth2Service.AuthenticateClient(clientAuth)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": err.Error(),
+		invalidClientError(ctx, err.Error())
+		return
+	}
+
+	// 推送的请求中不允许再嵌套request_uri（RFC 9126 2.1节）
+	if ctx.PostForm("request_uri") != "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_request",
+			"error_description": "推送授权请求中不允许携带request_uri参数",
 		})
 		return
 	}
 
-	// 构建重定向URI
-	redirectURL := req.RedirectURI + "?code=" + code
-	if req.State != "" {
-		redirectURL += "&state=" + req.State
+	params := &services.AuthorizationRequestParams{
+		ResponseType:        ctx.PostForm("response_type"),
+		ClientID:            ctx.PostForm("client_id"),
+		RedirectURI:         ctx.PostForm("redirect_uri"),
+		Scope:               ctx.PostForm("scope"),
+		State:               ctx.PostForm("state"),
+		Nonce:               ctx.PostForm("nonce"),
+		CodeChallenge:       ctx.PostForm("code_challenge"),
+		CodeChallengeMethod: ctx.PostForm("code_challenge_method"),
+		ResponseMode:        ctx.PostForm("response_mode"),
+		Resource:            ctx.PostFormArray("resource"),
+		Claims:              ctx.PostForm("claims"),
+		Prompt:              ctx.PostForm("prompt"),
+		MaxAge:              ctx.PostForm("max_age"),
+		LoginHint:           ctx.PostForm("login_hint"),
+		ACRValues:           ctx.PostForm("acr_values"),
+	}
+
+	// 以请求对象（RFC 9101）推送时，授权参数只取自请求对象
+	if request := ctx.PostForm("request"); request != "" {
+		params, err = c.requestObjectService.ParseRequestObject(client, request)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error":             "invalid_request_object",
+				"error_description": err.Error(),
+			})
+			return
+		}
 	}
 
-	ctx.Redirect(http.StatusFound, redirectURL)
+	response, err := c.parService.PushAuthorizationRequest(client, params)
+	if err != nil {
+		tokenEndpointError(ctx, err, "invalid_request")
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// authContextFromRequest 从认证中间件写入的上下文中取出用户的认证时间、认证方式和登录会话标识
+func authContextFromRequest(ctx *gin.Context) *utils.AuthContext {
+	authTime := ctx.GetInt64("auth_time")
+	if authTime == 0 {
+		return nil
+	}
+	return &utils.AuthContext{
+		AuthTime:  time.Unix(authTime, 0),
+		AMR:       ctx.GetStringSlice("amr"),
+		SessionID: ctx.GetString("sid"),
+	}
 }
 
 // Token OAuth2令牌端点
 func (c *OAuth2Controller) Token(ctx *gin.Context) {
+	// 令牌响应和错误响应均不可缓存（RFC 6749 5.1节）
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Pragma", "no-cache")
+
 	var req TokenRequest
 	if err := ctx.ShouldBind(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "请求参数错误",
-			"error":   err.Error(),
-		})
+		utils.OAuthError(ctx, http.StatusBadRequest, "invalid_request", "请求参数错误: "+err.Error())
+		return
+	}
+
+	clientAuth := clientAuthFromRequest(ctx)
+	if clientAuth.ClientID == "" {
+		invalidClientError(ctx, "缺少client_id参数")
 		return
 	}
 
+	// 携带DPoP证明时验证证明，签发的令牌绑定证明公钥（RFC 9449）
+	if proof, present := dpopProofFromRequest(ctx); present {
+		jkt, err := c.dpopService.ValidateProof(proof, ctx.Request.Method, services.DPoPRequestURI(ctx.GetString("issuer"), ctx.Request.URL.Path), "")
+		if err != nil {
+			dpopTokenEndpointError(ctx, err)
+			return
+		}
+		clientAuth.DPoPKeyThumbprint = jkt
+		// 下发新的nonce供客户端后续请求使用
+		ctx.Header("DPoP-Nonce", utils.GenerateDPoPNonce())
+	}
+
 	// 验证grant_type
-	if req.GrantType != "authorization_code" && req.GrantType != "refresh_token" && req.GrantType != "client_credentials" {
-		ctx.JSON(http.StatusBadRequest, gin.H{
-			"code":    400,
-			"message": "不支持的grant_type",
-		})
+	if req.GrantType != "authorization_code" && req.GrantType != "refresh_token" && req.GrantType != "client_credentials" &&
+		req.GrantType != services.GrantTypeDeviceCode && req.GrantType != services.GrantTypeTokenExchange {
+		utils.OAuthError(ctx, http.StatusBadRequest, "unsupported_grant_type", "不支持的grant_type")
 		return
 	}
 
 	if req.GrantType == "client_credentials" {
 		// 客户端凭证模式
 		scope := ctx.PostForm("scope")
-		accessToken, err := c.oauth2Service.ClientCredentialsGrant(req.ClientID, req.ClientSecret, scope)
+		accessToken, err := c.oauth2Service.ClientCredentialsGrant(clientAuth, scope, req.Resource)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"code":    400,
-				"message": err.Error(),
-			})
+			tokenEndpointError(ctx, err, "invalid_request")
 			return
 		}
 
+		tokenType := "Bearer"
+		if accessToken.JKT != "" {
+			tokenType = "DPoP"
+		}
 		ctx.JSON(http.StatusOK, gin.H{
 			"access_token": accessToken.Token,
-			"token_type":   "Bearer",
-			"expires_in":   900, // 15分钟
+			"token_type":   tokenType,
+			"expires_in":   int(accessToken.ExpiresAt.Sub(accessToken.CreatedAt).Round(time.Second).Seconds()),
 			"scope":        accessToken.Scope,
 		})
 		return
@@ -174,17 +700,14 @@ func (c *OAuth2Controller) Token(ctx *gin.Context) {
 	if req.GrantType == "authorization_code" {
 		// 交换授权码
 		tokenResponse, err := c.oauth2Service.ExchangeAuthorizationCode(
+			clientAuth,
 			req.Code,
-			req.ClientID,
-			req.ClientSecret,
 			req.RedirectURI,
 			req.CodeVerifier,
+			req.Resource,
 		)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error":             "invalid_grant",
-				"error_description": err.Error(),
-			})
+			tokenEndpointError(ctx, err, "invalid_grant")
 			return
 		}
 
@@ -193,63 +716,109 @@ func (c *OAuth2Controller) Token(ctx *gin.Context) {
 		// 刷新令牌
 		refreshToken := ctx.PostForm("refresh_token")
 		if refreshToken == "" {
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error":             "invalid_request",
-				"error_description": "refresh_token is required",
-			})
+			utils.OAuthError(ctx, http.StatusBadRequest, "invalid_request", "缺少refresh_token参数")
 			return
 		}
 
-		tokenService := services.NewTokenService()
-		newAccessToken, newRefreshToken, err := tokenService.RefreshAccessToken(refreshToken)
+		tokenResponse, err := c.oauth2Service.RefreshTokenGrant(
+			clientAuth,
+			refreshToken,
+			ctx.PostForm("scope"),
+			req.Resource,
+		)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error":             "invalid_grant",
-				"error_description": err.Error(),
-			})
+			tokenEndpointError(ctx, err, "invalid_grant")
 			return
 		}
 
-		ctx.JSON(http.StatusOK, gin.H{
-			"access_token":  newAccessToken,
-			"token_type":    "Bearer",
-			"expires_in":    900,
-			"refresh_token": newRefreshToken,
+		ctx.JSON(http.StatusOK, tokenResponse)
+	} else if req.GrantType == services.GrantTypeDeviceCode {
+		// 设备授权模式轮询
+		if req.DeviceCode == "" {
+			utils.OAuthError(ctx, http.StatusBadRequest, "invalid_request", "缺少device_code参数")
+			return
+		}
+
+		tokenResponse, err := c.deviceService.DeviceCodeGrant(clientAuth, req.DeviceCode, req.Resource)
+		if err != nil {
+			switch err {
+			case services.ErrAuthorizationPending, services.ErrSlowDown, services.ErrAccessDenied, services.ErrExpiredToken:
+				utils.OAuthError(ctx, http.StatusBadRequest, err.Error(), err.Error())
+			default:
+				tokenEndpointError(ctx, err, "invalid_grant")
+			}
+			return
+		}
+
+		ctx.JSON(http.StatusOK, tokenResponse)
+	} else if req.GrantType == services.GrantTypeTokenExchange {
+		// 令牌交换
+		if req.SubjectToken == "" || req.SubjectTokenType == "" {
+			utils.OAuthError(ctx, http.StatusBadRequest, "invalid_request", "缺少subject_token或subject_token_type参数")
+			return
+		}
+
+		tokenResponse, err := c.oauth2Service.ExchangeToken(&services.TokenExchangeRequest{
+			Client:             clientAuth,
+			SubjectToken:       req.SubjectToken,
+			SubjectTokenType:   req.SubjectTokenType,
+			ActorToken:         req.ActorToken,
+			ActorTokenType:     req.ActorTokenType,
+			RequestedTokenType: req.RequestedTokenType,
+			RequestedSubject:   req.RequestedSubject,
+			Audience:           req.Audience,
+			Resource:           req.Resource,
+			Scope:              ctx.PostForm("scope"),
+			IP:                 ctx.ClientIP(),
+			UserAgent:          ctx.GetHeader("User-Agent"),
 		})
+		if err != nil {
+			tokenEndpointError(ctx, err, "invalid_request")
+			return
+		}
+
+		ctx.JSON(http.StatusOK, tokenResponse)
 	}
 }
 
-// UserInfo OIDC用户信息端点
+// UserInfo OIDC用户信息端点，认证失败时按RFC 6750 3节返回WWW-Authenticate头
 func (c *OAuth2Controller) UserInfo(ctx *gin.Context) {
 	authHeader := ctx.GetHeader("Authorization")
 	if authHeader == "" {
-		ctx.JSON(http.StatusUnauthorized, gin.H{
-			"code":    401,
-			"message": "未提供访问令牌",
-		})
+		utils.BearerUnauthorized(ctx, "", "未提供访问令牌")
+		return
+	}
+
+	// 提取访问令牌，支持Bearer和DPoP认证方案
+	scheme, tokenString := splitAuthorizationHeader(authHeader)
+	if tokenString == "" || (scheme != "Bearer" && scheme != "DPoP") {
+		utils.BearerUnauthorized(ctx, "invalid_token", "访问令牌格式错误")
 		return
 	}
 
-	// 提取Bearer token
-	tokenString := authHeader[7:] // 跳过"Bearer "
+	// 校验DPoP或证书绑定令牌的持有证明
+	if claims, err := utils.ParseToken(tokenString); err == nil {
+		if err := c.mtlsService.VerifyBoundToken(ctx.Request, claims.Cnf); err != nil {
+			utils.BearerUnauthorized(ctx, "invalid_token", err.Error())
+			return
+		}
+		proof, _ := dpopProofFromRequest(ctx)
+		if err := c.dpopService.VerifyBoundToken(scheme, tokenString, proof, ctx.Request.Method, services.DPoPRequestURI(ctx.GetString("issuer"), ctx.Request.URL.Path), claims.Cnf); err != nil {
+			var dpopErr *utils.DPoPError
+			if errors.As(err, &dpopErr) {
+				utils.DPoPUnauthorized(ctx, dpopErr)
+				return
+			}
+			utils.BearerUnauthorized(ctx, "invalid_token", err.Error())
+			return
+		}
+	}
+
 	userInfo, err := c.oauth2Service.GetUserInfo(tokenString)
 	if err != nil {
-		ctx.JSON(http.StatusUnauthorized, gin.H{
-			"code":    401,
-			"message": err.Error(),
-		})
+		utils.BearerUnauthorized(ctx, "invalid_token", err.Error())
 		return
 	}
 
 	ctx.JSON(http.StatusOK, userInfo)
 }
-
-// JWKS JWKS端点（简化实现）
-func (c *OAuth2Controller) JWKS(ctx *gin.Context) {
-	// 这里应该返回实际的公钥，简化处理
-	ctx.JSON(http.StatusOK, gin.H{
-		"keys": []gin.H{},
-	})
-}
-
-
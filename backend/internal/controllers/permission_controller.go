@@ -310,3 +310,47 @@ func (c *PermissionController) DeletePermission(ctx *gin.Context) {
 	utils.SuccessWithMessage(ctx, "删除成功", nil)
 }
 
+
+// GetClientPermissions 获取OAuth2客户端的策略（如令牌交换策略）
+func (c *PermissionController) GetClientPermissions(ctx *gin.Context) {
+	clientID := ctx.Param("client_id")
+	utils.Success(ctx, c.permissionService.GetClientPermissions(clientID))
+}
+
+// GrantClientPermission 为OAuth2客户端授予策略
+// 令牌交换策略：resource 为 token_exchange:<主体令牌的client_id>（或 token_exchange:*），action 为 delegate；
+// 模拟登录策略：resource 为 token_exchange，action 为 impersonate
+func (c *PermissionController) GrantClientPermission(ctx *gin.Context) {
+	clientID := ctx.Param("client_id")
+
+	var req AssignPermissionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(ctx, "请求参数错误")
+		return
+	}
+
+	if err := c.permissionService.GrantClientPermission(clientID, req.Resource, req.Action); err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "客户端策略添加成功", nil)
+}
+
+// RevokeClientPermission 撤销OAuth2客户端的策略
+func (c *PermissionController) RevokeClientPermission(ctx *gin.Context) {
+	clientID := ctx.Param("client_id")
+
+	var req AssignPermissionRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(ctx, "请求参数错误")
+		return
+	}
+
+	if err := c.permissionService.RevokeClientPermission(clientID, req.Resource, req.Action); err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "客户端策略已删除", nil)
+}
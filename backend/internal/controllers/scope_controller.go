@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"astro-pass/internal/services"
+	"astro-pass/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScopeController struct {
+	scopeService *services.ScopeService
+}
+
+func NewScopeController() *ScopeController {
+	return &ScopeController{
+		scopeService: services.NewScopeService(),
+	}
+}
+
+// ScopeRequest 创建或更新scope的请求
+type ScopeRequest struct {
+	Name        string   `json:"name" binding:"max=100"` // 仅创建时使用，更新时以路径为准
+	DisplayName string   `json:"display_name" binding:"required,max=100"`
+	Description string   `json:"description" binding:"max=255"`
+	Sensitivity string   `json:"sensitivity" binding:"omitempty,oneof=low medium high"`
+	Claims      []string `json:"claims"` // 该scope释放的用户声明
+}
+
+// definition 转换为scope定义
+func (req *ScopeRequest) definition() *services.ScopeDefinition {
+	return &services.ScopeDefinition{
+		Name:        req.Name,
+		DisplayName: req.DisplayName,
+		Description: req.Description,
+		Sensitivity: req.Sensitivity,
+		Claims:      req.Claims,
+	}
+}
+
+// ListScopes 列出全部scope定义及可释放的用户声明
+func (c *ScopeController) ListScopes(ctx *gin.Context) {
+	scopes, err := c.scopeService.ListScopes()
+	if err != nil {
+		utils.InternalError(ctx, "获取scope列表失败")
+		return
+	}
+
+	utils.Success(ctx, gin.H{
+		"scopes":           scopes,
+		"supported_claims": c.scopeService.SupportedClaims(),
+	})
+}
+
+// GetScope 获取scope定义
+func (c *ScopeController) GetScope(ctx *gin.Context) {
+	scope, err := c.scopeService.GetScope(ctx.Param("name"))
+	if err != nil {
+		utils.NotFound(ctx, err.Error())
+		return
+	}
+
+	utils.Success(ctx, scope)
+}
+
+// CreateScope 创建自定义scope
+func (c *ScopeController) CreateScope(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	var req ScopeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	scope, err := c.scopeService.CreateScope(req.definition(), userID.(uint), ctx.ClientIP(), ctx.GetHeader("User-Agent"))
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "scope创建成功", scope)
+}
+
+// UpdateScope 更新scope的展示信息、敏感级别和释放的声明
+func (c *ScopeController) UpdateScope(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	var req ScopeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	scope, err := c.scopeService.UpdateScope(ctx.Param("name"), req.definition(), userID.(uint), ctx.ClientIP(), ctx.GetHeader("User-Agent"))
+	if err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "scope更新成功", scope)
+}
+
+// DeleteScope 删除自定义scope
+func (c *ScopeController) DeleteScope(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	if err := c.scopeService.DeleteScope(ctx.Param("name"), userID.(uint), ctx.ClientIP(), ctx.GetHeader("User-Agent")); err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "scope已删除", nil)
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"astro-pass/internal/services"
+	"astro-pass/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SigningKeyController struct {
+	keyService *services.SigningKeyService
+}
+
+func NewSigningKeyController() *SigningKeyController {
+	return &SigningKeyController{
+		keyService: services.NewSigningKeyService(),
+	}
+}
+
+// ListKeys 列出签名密钥及其状态
+func (c *SigningKeyController) ListKeys(ctx *gin.Context) {
+	keys, err := c.keyService.ListKeys()
+	if err != nil {
+		utils.InternalError(ctx, "获取签名密钥失败")
+		return
+	}
+
+	utils.Success(ctx, keys)
+}
+
+// RotateKey 立即轮换签名密钥
+func (c *SigningKeyController) RotateKey(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	key, err := c.keyService.ForceRotate(userID.(uint), ctx.ClientIP(), ctx.GetHeader("User-Agent"))
+	if err != nil {
+		utils.InternalError(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "签名密钥已轮换", key)
+}
+
+// RevokeKeyRequest 撤销签名密钥请求
+type RevokeKeyRequest struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// RevokeKey 撤销签名密钥，用于私钥泄露等情况
+func (c *SigningKeyController) RevokeKey(ctx *gin.Context) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	var req RevokeKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && ctx.Request.ContentLength > 0 {
+		utils.BadRequest(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	if err := c.keyService.RevokeKey(ctx.Param("kid"), req.Reason, userID.(uint), ctx.ClientIP(), ctx.GetHeader("User-Agent")); err != nil {
+		utils.BadRequest(ctx, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "签名密钥已撤销", nil)
+}
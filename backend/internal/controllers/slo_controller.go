@@ -1,9 +1,15 @@
 package controllers
 
 import (
+	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
+	"astro-pass/internal/config"
+	"astro-pass/internal/database"
+	"astro-pass/internal/models"
 	"astro-pass/internal/services"
 	"astro-pass/internal/utils"
 	"github.com/gin-gonic/gin"
@@ -206,7 +212,7 @@ func (c *SLOController) HandleLogoutCallback(ctx *gin.Context) {
 
 // GetOIDCLogout OIDC标准登出端点
 // @Summary OIDC登出端点
-// @Description OpenID Connect标准的登出端点
+// @Description OpenID Connect标准的登出端点，注册了前端通道登出地址的客户端由登出页面以iframe通知
 // @Tags OIDC
 // @Produce json
 // @Param id_token_hint query string false "ID Token提示"
@@ -219,25 +225,178 @@ func (c *SLOController) GetOIDCLogout(ctx *gin.Context) {
 	postLogoutRedirectURI := ctx.Query("post_logout_redirect_uri")
 	state := ctx.Query("state")
 
-	// 如果提供了ID Token，验证并提取用户信息
+	// 如果提供了ID Token，验证并结束其所属的登录会话（sid），没有sid时结束用户的所有会话
+	// 参与会话的客户端通过后端通道收到登出令牌
+	var frontchannelURLs []string
 	if idTokenHint != "" {
-		claims, err := utils.ParseToken(idTokenHint)
-		if err == nil && claims.UserID > 0 {
-			// 撤销用户的所有会话
-			c.sloService.RevokeUserSessions(claims.UserID, "oidc", 0)
+		claims, err := utils.ParseIDTokenHint(idTokenHint)
+		if err == nil {
+			var user models.User
+			if err := database.DB.Where("uuid = ?", claims.Subject).First(&user).Error; err == nil {
+				sessions, err := c.sloService.LogoutSession(user.ID, claims.SID, "oidc", user.ID)
+				if err != nil {
+					utils.Error("OIDC登出失败: %v", err)
+				}
+				frontchannelURLs = c.sloService.FrontchannelLogoutURLs(sessions)
+			}
 		}
 	}
 
+	// 清除浏览器状态，check_session_iframe 随即向客户端报告会话已变化
+	setBrowserStateCookie(ctx, "", -1)
+
 	// 构建重定向URL
+	redirectURL := ""
 	if postLogoutRedirectURI != "" {
-		redirectURL := postLogoutRedirectURI
+		redirectURL = postLogoutRedirectURI
 		if state != "" {
-			redirectURL += "?state=" + state
+			if parsed, err := url.Parse(postLogoutRedirectURI); err == nil {
+				query := parsed.Query()
+				query.Set("state", state)
+				parsed.RawQuery = query.Encode()
+				redirectURL = parsed.String()
+			}
 		}
+	}
+
+	// 有前端通道登出地址时渲染登出页面，全部iframe加载完成（或超时）后再重定向
+	if len(frontchannelURLs) > 0 {
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Header("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; frame-src *")
+		ctx.Header("Content-Type", "text/html; charset=utf-8")
+		ctx.Status(http.StatusOK)
+		if err := frontchannelLogoutTemplate.Execute(ctx.Writer, gin.H{
+			"LogoutURLs":  frontchannelURLs,
+			"RedirectURL": redirectURL,
+		}); err != nil {
+			utils.Error("渲染登出页面失败: %v", err)
+		}
+		return
+	}
+
+	if redirectURL != "" {
 		ctx.Redirect(http.StatusFound, redirectURL)
 		return
 	}
 
 	// 如果没有重定向URI，返回成功响应
 	utils.SuccessWithMessage(ctx, "登出成功", nil)
-}
\ No newline at end of file
+}
+
+// frontchannelLogoutTemplate 前端通道登出页面，以不可见iframe加载各客户端的登出地址
+var frontchannelLogoutTemplate = template.Must(template.New("frontchannel_logout").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>正在登出</title>
+<script>
+var pending = {{len .LogoutURLs}};
+var redirectURL = {{.RedirectURL}};
+var finished = false;
+function finish() {
+  if (finished) { return; }
+  finished = true;
+  if (redirectURL) {
+    window.location.replace(redirectURL);
+  } else {
+    document.getElementById("status").textContent = "已登出";
+  }
+}
+function loaded() {
+  pending--;
+  if (pending <= 0) { finish(); }
+}
+setTimeout(finish, 5000);
+</script>
+</head>
+<body>
+<p id="status">正在登出...</p>
+{{range .LogoutURLs}}<iframe src="{{.}}" style="display:none" onload="loaded()"></iframe>
+{{end}}</body>
+</html>`))
+
+// checkSessionTemplate check_session_iframe 页面（OIDC Session Management 3.2节）
+// 收到客户端postMessage的"client_id session_state"后，用浏览器状态Cookie重新计算session_state并回复changed、unchanged或error
+var checkSessionTemplate = template.Must(template.New("check_session").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Check Session</title></head>
+<body>
+<script>
+(function () {
+  var cookieName = {{.CookieName}};
+  function browserState() {
+    var cookies = document.cookie ? document.cookie.split("; ") : [];
+    for (var i = 0; i < cookies.length; i++) {
+      var index = cookies[i].indexOf("=");
+      if (cookies[i].substring(0, index) === cookieName) {
+        return decodeURIComponent(cookies[i].substring(index + 1));
+      }
+    }
+    return "";
+  }
+  function base64url(buffer) {
+    var bytes = new Uint8Array(buffer);
+    var binary = "";
+    for (var i = 0; i < bytes.length; i++) {
+      binary += String.fromCharCode(bytes[i]);
+    }
+    return btoa(binary).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+  }
+  window.addEventListener("message", function (e) {
+    if (typeof e.data !== "string") {
+      return;
+    }
+    var parts = e.data.split(" ");
+    var sessionState = parts[1] || "";
+    var salt = sessionState.split(".")[1];
+    if (parts.length !== 2 || !parts[0] || !salt) {
+      e.source.postMessage("error", e.origin);
+      return;
+    }
+    var data = new TextEncoder().encode(parts[0] + " " + e.origin + " " + browserState() + " " + salt);
+    crypto.subtle.digest("SHA-256", data).then(function (digest) {
+      e.source.postMessage(base64url(digest) + "." + salt === sessionState ? "unchanged" : "changed", e.origin);
+    });
+  });
+})();
+</script>
+</body>
+</html>`))
+
+// CheckSessionIframe OIDC会话管理的check_session_iframe
+// @Summary 会话检查iframe
+// @Description 客户端以隐藏iframe加载该页面，通过postMessage检查用户在OP的登录状态是否变化
+// @Tags OIDC
+// @Produce html
+// @Success 200 {string} string "会话检查页面"
+// @Router /api/oidc/check_session [get]
+func (c *SLOController) CheckSessionIframe(ctx *gin.Context) {
+	// 该页面需要被客户端嵌入
+	ctx.Writer.Header().Del("X-Frame-Options")
+	ctx.Header("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; frame-ancestors *")
+	ctx.Header("Content-Type", "text/html; charset=utf-8")
+	ctx.Status(http.StatusOK)
+	if err := checkSessionTemplate.Execute(ctx.Writer, gin.H{
+		"CookieName": utils.BrowserStateCookie,
+	}); err != nil {
+		utils.Error("渲染会话检查页面失败: %v", err)
+	}
+}
+
+// setBrowserStateCookie 写入或清除（maxAge<0）OP浏览器状态Cookie
+// check_session_iframe 在客户端页面中以第三方上下文读取，HTTPS部署时需要SameSite=None
+func setBrowserStateCookie(ctx *gin.Context, browserState string, maxAge int) {
+	secure := strings.HasPrefix(config.Cfg.App.URL, "https://")
+	sameSite := http.SameSiteLaxMode
+	if secure {
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     utils.BrowserStateCookie,
+		Value:    browserState,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HttpOnly: false,
+		SameSite: sameSite,
+	})
+}
@@ -115,7 +115,10 @@ func (c *SocialAuthController) HandleGitHubCallback(ctx *gin.Context) {
 	}
 
 	// 生成JWT令牌
-	jwtAccessToken, err := utils.GenerateAccessToken(user.ID, user.Username, user.Email)
+	authTime := time.Now()
+	sessionID := utils.GenerateUUID()
+	auth := &utils.AuthContext{AuthTime: authTime, AMR: []string{utils.AMRFederated}, SessionID: sessionID}
+	jwtAccessToken, err := utils.GenerateAccessTokenWithAuth(user.ID, user.UUID, user.Username, user.Email, auth)
 	if err != nil {
 		utils.ErrorResponse(ctx, http.StatusInternalServerError, "生成访问令牌失败")
 		return
@@ -129,9 +132,13 @@ func (c *SocialAuthController) HandleGitHubCallback(ctx *gin.Context) {
 
 	// 保存刷新令牌
 	refreshTokenModel := &models.RefreshToken{
-		UserID:    user.ID,
-		Token:     refreshToken,
-		ExpiresAt: time.Now().Add(time.Hour * 24 * 7),
+		UserID:      user.ID,
+		Token:       refreshToken,
+		FamilyID:    sessionID,
+		SessionID:   sessionID,
+		AuthTime:    &authTime,
+		AuthMethods: utils.AMRFederated,
+		ExpiresAt:   time.Now().Add(time.Hour * 24 * 7),
 	}
 	database.DB.Create(refreshTokenModel)
 
@@ -162,4 +169,3 @@ func (c *SocialAuthController) HandleGitHubCallback(ctx *gin.Context) {
 		"expires_in":    900,
 	})
 }
-
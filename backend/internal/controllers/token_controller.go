@@ -3,21 +3,22 @@ package controllers
 import (
 	"astro-pass/internal/services"
 	"astro-pass/internal/utils"
-	"crypto/x509"
-	"encoding/base64"
-	"math/big"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
 type TokenController struct {
-	tokenService *services.TokenService
+	tokenService     *services.TokenService
+	oauth2Service    *services.OAuth2Service
+	discoveryService *services.DiscoveryService
 }
 
 func NewTokenController() *TokenController {
 	return &TokenController{
-		tokenService: services.NewTokenService(),
+		tokenService:     services.NewTokenService(),
+		oauth2Service:    services.NewOAuth2Service(),
+		discoveryService: services.NewDiscoveryService(),
 	}
 }
 
@@ -70,7 +71,14 @@ func (tc *TokenController) RevokeToken(c *gin.Context) {
 		return
 	}
 
-	err := tc.tokenService.RevokeToken(token, tokenTypeHint)
+	// 验证客户端，只能撤销签发给自己的令牌
+	client, err := tc.oauth2Service.AuthenticateClient(clientAuthFromRequest(c))
+	if err != nil {
+		invalidClientError(c, err.Error())
+		return
+	}
+
+	err = tc.tokenService.RevokeToken(token, tokenTypeHint, client.ClientID)
 	if err != nil {
 		// RFC 7009规定：即使令牌不存在也应返回200
 		// 这是为了防止信息泄露
@@ -93,15 +101,10 @@ func (tc *TokenController) IntrospectToken(c *gin.Context) {
 		return
 	}
 
-	// 验证客户端凭证（简化处理，实际应该验证Basic Auth）
-	clientID := c.PostForm("client_id")
-	clientSecret := c.PostForm("client_secret")
-	
-	if clientID == "" || clientSecret == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":             "invalid_client",
-			"error_description": "client authentication failed",
-		})
+	// 验证客户端凭证，公共客户端不能调用内省端点
+	client, err := tc.oauth2Service.AuthenticateClient(clientAuthFromRequest(c))
+	if err != nil || client.ClientType == "public" {
+		invalidClientError(c, "client authentication failed")
 		return
 	}
 
@@ -116,77 +119,48 @@ func (tc *TokenController) IntrospectToken(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
-// GetJWKS 获取JWKS（JSON Web Key Set）
+// GetJWKS 获取JWKS（JSON Web Key Set），包含待启用、当前和退役中的签名公钥
 func (tc *TokenController) GetJWKS(c *gin.Context) {
-	publicKey := utils.GetPublicKey()
-	if publicKey == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "public key not initialized",
-		})
-		return
-	}
-
-	// 将RSA公钥转换为JWK格式（暂时不使用，但保留用于未来扩展）
-	_, err := x509.MarshalPKIXPublicKey(publicKey)
-	if err != nil {
+	set := utils.PublishedJWKS()
+	if len(set.Keys) == 0 {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "failed to marshal public key",
+			"error": "signing keys not initialized",
 		})
 		return
 	}
 
-	// 计算key ID（使用公钥的SHA-256哈希的前8字节）
-	keyID := "rsa-key-1"
-
-	// 提取RSA公钥的n和e
-	n := publicKey.N
-	e := publicKey.E
-
-	// 将n转换为base64url编码
-	nBytes := n.Bytes()
-	nBase64 := base64.RawURLEncoding.EncodeToString(nBytes)
+	// 依赖方按kid选择公钥，遇到未知kid时应重新获取
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
 
-	// 将e转换为base64url编码
-	eBytes := big.NewInt(int64(e)).Bytes()
-	eBase64 := base64.RawURLEncoding.EncodeToString(eBytes)
+// GetOpenIDConfiguration 获取OpenID Connect配置（OIDC Discovery），由当前启用的能力生成
+func (tc *TokenController) GetOpenIDConfiguration(c *gin.Context) {
+	tc.serveMetadata(c, true)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"keys": []gin.H{
-			{
-				"kty": "RSA",
-				"use": "sig",
-				"kid": keyID,
-				"alg": "RS256",
-				"n":   nBase64,
-				"e":   eBase64,
-			},
-		},
-	})
+// GetAuthorizationServerMetadata 获取授权服务器元数据（RFC 8414）
+func (tc *TokenController) GetAuthorizationServerMetadata(c *gin.Context) {
+	tc.serveMetadata(c, false)
 }
 
-// GetOpenIDConfiguration 获取OpenID Connect配置（自动发现）
-func (tc *TokenController) GetOpenIDConfiguration(c *gin.Context) {
-	baseURL := c.Request.Host
-	scheme := "http"
-	if c.Request.TLS != nil {
-		scheme = "https"
+// serveMetadata 返回请求所属签发者的元数据，签发者由 IssuerMiddleware 确定
+func (tc *TokenController) serveMetadata(c *gin.Context, openid bool) {
+	issuer := c.GetString("issuer")
+	if issuer == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "unknown issuer",
+		})
+		return
 	}
-	issuer := scheme + "://" + baseURL
 
-	c.JSON(http.StatusOK, gin.H{
-		"issuer":                                issuer,
-		"authorization_endpoint":                issuer + "/api/oauth2/authorize",
-		"token_endpoint":                        issuer + "/api/oauth2/token",
-		"userinfo_endpoint":                     issuer + "/api/oauth2/userinfo",
-		"jwks_uri":                              issuer + "/api/oauth2/jwks",
-		"revocation_endpoint":                   issuer + "/api/oauth2/revoke",
-		"introspection_endpoint":                issuer + "/api/oauth2/introspect",
-		"response_types_supported":              []string{"code", "token", "id_token", "code token", "code id_token", "token id_token", "code token id_token"},
-		"subject_types_supported":               []string{"public"},
-		"id_token_signing_alg_values_supported": []string{"RS256"},
-		"scopes_supported":                      []string{"openid", "profile", "email"},
-		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
-		"claims_supported":                      []string{"sub", "name", "preferred_username", "email", "email_verified"},
-		"grant_types_supported":                 []string{"authorization_code", "refresh_token", "client_credentials"},
-	})
+	metadata, err := tc.discoveryService.Metadata(issuer, openid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to generate metadata",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, metadata)
 }
@@ -10,18 +10,22 @@ import (
 )
 
 type UserController struct {
-	userService *services.UserService
+	userService  *services.UserService
+	scopeService *services.ScopeService
 }
 
 func NewUserController() *UserController {
 	return &UserController{
-		userService: services.NewUserService(),
+		userService:  services.NewUserService(),
+		scopeService: services.NewScopeService(),
 	}
 }
 
 // UpdateProfileRequest 更新资料请求
 type UpdateProfileRequest struct {
-	Nickname string `json:"nickname"`
+	Nickname    string  `json:"nickname"`
+	PhoneNumber *string `json:"phone_number" binding:"omitempty,max=32"` // 为空时不修改
+	Address     *string `json:"address" binding:"omitempty,max=255"`
 }
 
 // ChangePasswordRequest 修改密码请求
@@ -62,7 +66,7 @@ func (c *UserController) UpdateProfile(ctx *gin.Context) {
 		return
 	}
 
-	user, err := c.userService.UpdateProfile(userID.(uint), req.Nickname)
+	user, err := c.userService.UpdateProfile(userID.(uint), req.Nickname, req.PhoneNumber, req.Address)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"code":    400,
@@ -76,11 +80,13 @@ func (c *UserController) UpdateProfile(ctx *gin.Context) {
 		"message": "更新成功",
 		"data": gin.H{
 			"user": gin.H{
-				"id":       user.ID,
-				"uuid":     user.UUID,
-				"username": user.Username,
-				"email":    user.Email,
-				"nickname": user.Nickname,
+				"id":           user.ID,
+				"uuid":         user.UUID,
+				"username":     user.Username,
+				"email":        user.Email,
+				"nickname":     user.Nickname,
+				"phone_number": user.PhoneNumber,
+				"address":      user.Address,
 			},
 		},
 	})
@@ -421,6 +427,68 @@ func (c *UserController) RemoveRoleFromUser(ctx *gin.Context) {
 	utils.SuccessWithMessage(ctx, "角色移除成功", nil)
 }
 
+// GetUserClaims 获取用户的自定义声明（管理员功能）
+func (c *UserController) GetUserClaims(ctx *gin.Context) {
+	userIDStr := ctx.Param("id")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		utils.ErrorResponse(ctx, http.StatusBadRequest, "无效的用户ID")
+		return
+	}
+
+	if _, err := c.userService.GetUserByID(uint(userID)); err != nil {
+		utils.ErrorResponse(ctx, http.StatusNotFound, err.Error())
+		return
+	}
+
+	claims, err := c.scopeService.GetUserCustomClaims(uint(userID))
+	if err != nil {
+		utils.ErrorResponse(ctx, http.StatusInternalServerError, "获取用户声明失败")
+		return
+	}
+
+	utils.Success(ctx, gin.H{
+		"claims": claims,
+	})
+}
+
+// UpdateUserClaimsRequest 更新用户自定义声明请求，claims整体替换已有声明
+type UpdateUserClaimsRequest struct {
+	Claims map[string]interface{} `json:"claims"`
+}
+
+// UpdateUserClaims 设置用户的自定义声明，如department、employee_id（管理员功能）
+func (c *UserController) UpdateUserClaims(ctx *gin.Context) {
+	operatorID, exists := ctx.Get("user_id")
+	if !exists {
+		utils.Unauthorized(ctx, "未认证")
+		return
+	}
+
+	userIDStr := ctx.Param("id")
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		utils.ErrorResponse(ctx, http.StatusBadRequest, "无效的用户ID")
+		return
+	}
+
+	var req UpdateUserClaimsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(ctx, http.StatusBadRequest, "请求参数错误")
+		return
+	}
+
+	claims, err := c.scopeService.SetUserCustomClaims(uint(userID), req.Claims, operatorID.(uint), ctx.ClientIP(), ctx.GetHeader("User-Agent"))
+	if err != nil {
+		utils.ErrorResponse(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utils.SuccessWithMessage(ctx, "用户声明已更新", gin.H{
+		"claims": claims,
+	})
+}
+
 // GetUserStats 获取用户统计信息（管理员功能）
 func (c *UserController) GetUserStats(ctx *gin.Context) {
 	stats, err := c.userService.GetUserStats()
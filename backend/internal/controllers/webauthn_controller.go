@@ -1,8 +1,12 @@
 package controllers
 
 import (
+	"astro-pass/internal/database"
+	"astro-pass/internal/models"
 	"astro-pass/internal/services"
 	"astro-pass/internal/utils"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/go-webauthn/webauthn/protocol"
 )
@@ -209,7 +213,10 @@ func (c *WebAuthnController) FinishLogin(ctx *gin.Context) {
 	services.DeleteSessionData(req.SessionToken)
 
 	// 生成JWT令牌
-	accessToken, err := utils.GenerateAccessToken(user.ID, user.Username, user.Email)
+	authTime := time.Now()
+	sessionID := utils.GenerateUUID()
+	auth := &utils.AuthContext{AuthTime: authTime, AMR: []string{utils.AMRHardware}, SessionID: sessionID}
+	accessToken, err := utils.GenerateAccessTokenWithAuth(user.ID, user.UUID, user.Username, user.Email, auth)
 	if err != nil {
 		utils.InternalError(ctx, "生成访问令牌失败")
 		return
@@ -221,6 +228,21 @@ func (c *WebAuthnController) FinishLogin(ctx *gin.Context) {
 		return
 	}
 
+	// 保存刷新令牌
+	refreshTokenModel := &models.RefreshToken{
+		UserID:      user.ID,
+		Token:       refreshToken,
+		FamilyID:    sessionID,
+		SessionID:   sessionID,
+		AuthTime:    &authTime,
+		AuthMethods: utils.AMRHardware,
+		ExpiresAt:   authTime.Add(time.Hour * 24 * 7),
+	}
+	if err := database.DB.Create(refreshTokenModel).Error; err != nil {
+		utils.InternalError(ctx, "保存刷新令牌失败")
+		return
+	}
+
 	utils.SuccessWithMessage(ctx, "WebAuthn登录成功", gin.H{
 		"user": gin.H{
 			"id":       user.ID,
@@ -6,6 +6,7 @@ import (
 
 	"astro-pass/internal/config"
 	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
 	"github.com/fatih/color"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -64,6 +65,7 @@ func AutoMigrate() error {
 		{&models.Role{}, "角色表"},
 		{&models.Permission{}, "权限表"},
 		{&models.OAuth2Client{}, "OAuth2客户端表"},
+		{&models.OAuth2Scope{}, "授权范围表"},
 	}
 
 	// 第二组：有外键依赖的表
@@ -74,6 +76,12 @@ func AutoMigrate() error {
 		{&models.RefreshToken{}, "刷新令牌表"},
 		{&models.AuditLog{}, "审计日志表"},
 		{&models.AuthorizationCode{}, "授权码表"},
+		{&models.DeviceCode{}, "设备码表"},
+		{&models.PushedAuthorizationRequest{}, "推送授权请求表"},
+		{&models.ClientAssertionJTI{}, "客户端断言表"},
+		{&models.DPoPProofJTI{}, "DPoP证明表"},
+		{&models.SigningKey{}, "签名密钥表"},
+		{&models.InitialAccessToken{}, "初始访问令牌表"},
 		{&models.AccessToken{}, "访问令牌表"},
 		{&models.UserSession{}, "用户会话表"},
 		{&models.LoginAttempt{}, "登录尝试表"},
@@ -85,7 +93,9 @@ func AutoMigrate() error {
 		{&models.Notification{}, "通知表"},
 		{&models.BackupRecord{}, "备份记录表"},
 		{&models.SystemConfig{}, "系统配置表"},
+		{&models.UserClaim{}, "用户声明表"},
 		{&models.UserConsent{}, "用户授权同意表"},
+		{&models.ConsentApproval{}, "授权批准凭据表"},
 		{&models.SSOSession{}, "SSO会话表"},
 		{&models.LogoutRequest{}, "登出请求表"},
 		{&models.LogoutNotification{}, "登出通知表"},
@@ -109,6 +119,11 @@ func AutoMigrate() error {
 		time.Sleep(50 * time.Millisecond)
 	}
 
+	// 访问令牌表结构变更需要在自动迁移前处理
+	if err := migrateAccessTokenHashes(); err != nil {
+		return fmt.Errorf("迁移访问令牌摘要失败: %w", err)
+	}
+
 	// 再迁移有外键依赖的表
 	color.New(color.FgYellow).Print("    └─ 迁移依赖表...")
 	for i, item := range dependentModels {
@@ -126,3 +141,33 @@ func AutoMigrate() error {
 
 	return nil
 }
+
+// migrateAccessTokenHashes 访问令牌改为按摘要建立唯一索引：JWT访问令牌超出原令牌列的长度和索引限制
+// 旧表先删除令牌原文上的唯一索引，再添加摘要列并为已有记录回填，避免新唯一索引因空摘要重复而创建失败
+func migrateAccessTokenHashes() error {
+	migrator := DB.Migrator()
+	if !migrator.HasTable(&models.AccessToken{}) || migrator.HasColumn(&models.AccessToken{}, "TokenHash") {
+		return nil
+	}
+
+	if migrator.HasIndex(&models.AccessToken{}, "idx_access_tokens_token") {
+		if err := migrator.DropIndex(&models.AccessToken{}, "idx_access_tokens_token"); err != nil {
+			return err
+		}
+	}
+	// 先以空字符串为默认值添加普通列，唯一索引由自动迁移在回填后创建
+	if err := DB.Exec("ALTER TABLE `access_tokens` ADD COLUMN `token_hash` varchar(64) NOT NULL DEFAULT ''").Error; err != nil {
+		return err
+	}
+
+	var tokens []models.AccessToken
+	return DB.Unscoped().Select("id", "token").FindInBatches(&tokens, 500, func(tx *gorm.DB, batch int) error {
+		for _, token := range tokens {
+			if err := DB.Unscoped().Model(&models.AccessToken{}).Where("id = ?", token.ID).
+				UpdateColumn("token_hash", utils.HashToken(token.Token)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
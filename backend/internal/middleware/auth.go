@@ -1,12 +1,19 @@
 package middleware
 
 import (
+	"errors"
 	"strings"
 
+	"astro-pass/internal/services"
 	"astro-pass/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	dpopService = services.NewDPoPService()
+	mtlsService = services.NewMTLSService()
+)
+
 // AuthMiddleware JWT认证中间件
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -17,9 +24,9 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 提取Bearer token
+		// 提取令牌，支持Bearer和DPoP（RFC 9449）认证方案
 		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if len(parts) != 2 || (parts[0] != "Bearer" && parts[0] != "DPoP") {
 			utils.Unauthorized(c, "认证令牌格式错误")
 			c.Abort()
 			return
@@ -33,12 +40,57 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 仅接受本服务签发的第一方登录令牌：签发给OAuth2客户端的令牌（携带client_id）
+		// 和受众不包含本服务API的令牌不能代表用户调用本服务（RFC 8707）
+		if claims.ClientID != "" || !claims.HasAudience(utils.DefaultAccessTokenAudience()) {
+			utils.Unauthorized(c, "该认证令牌不能用于访问本服务")
+			c.Abort()
+			return
+		}
+
+		// 绑定了客户端证书的令牌必须在同一证书的双向TLS连接上使用（RFC 8705 3节）
+		if err := mtlsService.VerifyBoundToken(c.Request, claims.Cnf); err != nil {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			utils.Unauthorized(c, err.Error())
+			c.Abort()
+			return
+		}
+
+		// 绑定了DPoP密钥的令牌需要校验持有证明
+		proof := strings.Join(c.Request.Header.Values("DPoP"), ",")
+		htu := services.DPoPRequestURI(c.GetString("issuer"), c.Request.URL.Path)
+		if err := dpopService.VerifyBoundToken(parts[0], tokenString, proof, c.Request.Method, htu, claims.Cnf); err != nil {
+			var dpopErr *utils.DPoPError
+			if errors.As(err, &dpopErr) {
+				utils.DPoPUnauthorized(c, dpopErr)
+			} else {
+				utils.Unauthorized(c, err.Error())
+			}
+			c.Abort()
+			return
+		}
+
 		// 将用户信息存储到上下文
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("email", claims.Email)
+		c.Set("auth_time", claims.AuthTime)
+		c.Set("amr", claims.AMR)
+		c.Set("sid", claims.SID)
 
 		c.Next()
 	}
 }
 
+// OptionalAuthMiddleware 可选认证中间件：未携带认证令牌时以匿名身份继续处理，携带时按AuthMiddleware校验
+// 用于授权端点，由处理函数决定如何响应未登录的用户（如prompt=none时返回login_required）
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	authenticate := AuthMiddleware()
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		authenticate(c)
+	}
+}
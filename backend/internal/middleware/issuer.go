@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"astro-pass/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IssuerMiddleware 按请求的Host和签发者路径确定当前签发者，写入上下文的issuer
+// 签发的令牌、授权响应和元数据均使用该签发者标识
+func IssuerMiddleware(issuerPath string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("issuer", utils.ResolveIssuer(c.Request.Host, issuerPath))
+		c.Next()
+	}
+}
@@ -11,14 +11,43 @@ type OAuth2Client struct {
 	ID                uint           `gorm:"primaryKey" json:"id"`
 	UserID            uint           `gorm:"not null;index" json:"user_id"`
 	ClientID          string         `gorm:"uniqueIndex;size:100;not null" json:"client_id"`
-	ClientSecret      string         `gorm:"size:255;not null" json:"-"`
+	ClientSecretHash  string         `gorm:"column:client_secret;size:255;not null" json:"-"` // 客户端密钥的SHA-256摘要，公共客户端为空
+	ClientSecretEncrypted string     `gorm:"type:text" json:"-"` // client_secret_jwt需要密钥原文计算HMAC，仅此时加密保存
+	ClientSecretIssuedAt  *time.Time `json:"client_secret_issued_at"` // 当前密钥的签发时间，用于计算密钥年龄
+	ClientSecretExpiresAt *time.Time `json:"client_secret_expires_at"` // 当前密钥的过期时间，为空表示不过期
+	PreviousSecretHash    string     `gorm:"size:64" json:"-"` // 轮换前的密钥摘要，宽限期内仍可使用
+	PreviousSecretEncrypted string   `gorm:"type:text" json:"-"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"` // 旧密钥宽限期结束时间
+	ClientType        string         `gorm:"size:20;default:confidential" json:"client_type"` // confidential, public
+	TokenEndpointAuthMethod string   `gorm:"size:50;default:client_secret_basic" json:"token_endpoint_auth_method"` // client_secret_basic, client_secret_post, client_secret_jwt, private_key_jwt, tls_client_auth, self_signed_tls_client_auth, none
+	JWKS              string         `gorm:"type:text" json:"-"` // private_key_jwt、self_signed_tls_client_auth 使用的内联JWKS（JSON）
+	JWKSURI           string         `gorm:"size:255" json:"jwks_uri"` // private_key_jwt、self_signed_tls_client_auth 使用的JWKS地址
+	TLSClientAuthSubjectDN string    `gorm:"size:255" json:"tls_client_auth_subject_dn,omitempty"` // tls_client_auth 期望的证书主题DN（RFC 8705 2.1.2）
+	TLSClientAuthSANDNS    string    `gorm:"size:255" json:"tls_client_auth_san_dns,omitempty"` // 期望的SAN dNSName
+	TLSClientAuthSANURI    string    `gorm:"size:255" json:"tls_client_auth_san_uri,omitempty"` // 期望的SAN uniformResourceIdentifier
+	TLSClientAuthSANIP     string    `gorm:"size:64" json:"tls_client_auth_san_ip,omitempty"` // 期望的SAN iPAddress
+	TLSClientAuthSANEmail  string    `gorm:"size:255" json:"tls_client_auth_san_email,omitempty"` // 期望的SAN rfc822Name
 	ClientName        string         `gorm:"size:100;not null" json:"client_name"`
 	ClientURI         string         `gorm:"size:255" json:"client_uri"`
 	LogoURI           string         `gorm:"size:255" json:"logo_uri"`
 	RedirectURIs      string         `gorm:"type:text;not null" json:"-"` // JSON格式存储多个重定向URI
+	RequestURIs       string         `gorm:"type:text" json:"-"` // JSON格式存储预先注册的请求对象地址（RFC 9101）
+	BackchannelLogoutURI string      `gorm:"size:500" json:"backchannel_logout_uri"` // 后端通道登出通知地址（OIDC Back-Channel Logout 2.2节）
+	BackchannelLogoutSessionRequired bool `gorm:"default:false" json:"backchannel_logout_session_required"` // 要求登出令牌包含sid
+	FrontchannelLogoutURI string     `gorm:"size:500" json:"frontchannel_logout_uri"` // 前端通道登出地址，登出页面以iframe加载（OIDC Front-Channel Logout 2节）
+	FrontchannelLogoutSessionRequired bool `gorm:"default:false" json:"frontchannel_logout_session_required"` // 要求登出地址携带iss和sid参数
 	GrantTypes        string         `gorm:"type:text;not null" json:"-"` // JSON格式存储授权类型
 	ResponseTypes     string         `gorm:"type:text;not null" json:"-"` // JSON格式存储响应类型
 	Scope             string         `gorm:"size:255" json:"scope"`
+	RequirePKCE       bool           `gorm:"default:false" json:"require_pkce"` // 强制要求PKCE且仅接受S256
+	RequirePAR        bool           `gorm:"default:false" json:"require_pushed_authorization_requests"` // 强制要求通过PAR提交授权请求（RFC 9126）
+	RequireDPoP       bool           `gorm:"default:false" json:"dpop_bound_access_tokens"` // 强制要求令牌绑定DPoP密钥（RFC 9449）
+	RequireMTLSBinding bool          `gorm:"default:false" json:"tls_client_certificate_bound_access_tokens"` // 令牌绑定客户端证书（RFC 8705 3节）
+	AccessTokenLifetime int          `gorm:"default:0" json:"access_token_lifetime"` // 访问令牌有效期（秒），0表示使用全局配置
+	IDTokenLifetime   int            `gorm:"default:0" json:"id_token_lifetime"` // ID Token有效期（秒），0表示使用全局配置
+	RefreshTokenIdleTimeout int      `gorm:"default:0" json:"refresh_token_idle_timeout"` // 刷新令牌闲置过期时间（秒），每次轮换重新计算，0表示使用全局配置
+	RefreshTokenAbsoluteLifetime int `gorm:"default:0" json:"refresh_token_absolute_lifetime"` // 刷新令牌自首次签发起的绝对有效期（秒），轮换不会延长，0表示使用全局配置
+	RegistrationAccessTokenHash string `gorm:"size:64;index" json:"-"` // 动态注册客户端的注册访问令牌摘要（RFC 7592）
 	Status            string         `gorm:"size:20;default:active" json:"status"` // active, suspended, revoked
 	CreatedAt         time.Time      `json:"created_at"`
 	UpdatedAt         time.Time      `json:"updated_at"`
@@ -41,6 +70,12 @@ type AuthorizationCode struct {
 	Scope             string         `gorm:"size:255" json:"scope"`
 	CodeChallenge     string         `gorm:"size:255" json:"-"` // PKCE支持
 	CodeChallengeMethod string       `gorm:"size:20" json:"-"` // S256, plain
+	Nonce             string         `gorm:"size:255" json:"-"` // OIDC nonce，原样写入ID Token
+	Claims            string         `gorm:"type:text" json:"-"` // OIDC claims请求参数（JSON），决定ID Token和用户信息端点额外返回的声明
+	Resource          string         `gorm:"type:text" json:"resource"` // 授权请求中的资源指示（RFC 8707），空格分隔
+	AuthTime          *time.Time     `json:"auth_time"` // 用户完成认证的时间
+	AuthMethods       string         `gorm:"size:100" json:"auth_methods"` // 认证方式（amr），空格分隔
+	SessionID         string         `gorm:"size:36;index" json:"-"` // 用户登录会话标识，写入ID Token的sid声明
 	ExpiresAt         time.Time      `gorm:"not null;index" json:"expires_at"`
 	Used              bool           `gorm:"default:false" json:"used"`
 	CreatedAt         time.Time      `json:"created_at"`
@@ -51,14 +86,104 @@ type AuthorizationCode struct {
 	User              User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
 
+// PushedAuthorizationRequest 推送授权请求模型（RFC 9126）
+type PushedAuthorizationRequest struct {
+	ID                uint           `gorm:"primaryKey" json:"id"`
+	RequestURI        string         `gorm:"uniqueIndex;size:255;not null" json:"request_uri"`
+	OAuth2ClientID    uint           `gorm:"not null;index" json:"oauth2_client_id"` // 外键引用 OAuth2Client.ID
+	ClientID          string         `gorm:"not null;index" json:"client_id"` // OAuth2 标准中的 client_id（字符串）
+	Parameters        string         `gorm:"type:text;not null" json:"-"` // JSON格式存储授权请求参数
+	ExpiresAt         time.Time      `gorm:"not null;index" json:"expires_at"`
+	Used              bool           `gorm:"default:false" json:"used"` // 签发授权码后即失效
+	CreatedAt         time.Time      `json:"created_at"`
+}
+
+// DeviceCode 设备授权码模型（RFC 8628）
+type DeviceCode struct {
+	ID                uint           `gorm:"primaryKey" json:"id"`
+	DeviceCode        string         `gorm:"uniqueIndex;size:255;not null" json:"-"`
+	UserCode          string         `gorm:"uniqueIndex;size:20;not null" json:"user_code"` // 用户在浏览器中输入的短码
+	OAuth2ClientID    uint           `gorm:"not null;index" json:"oauth2_client_id"` // 外键引用 OAuth2Client.ID
+	ClientID          string         `gorm:"not null;index" json:"client_id"` // OAuth2 标准中的 client_id（字符串）
+	UserID            *uint          `gorm:"index" json:"user_id"` // 用户批准前为空
+	Scope             string         `gorm:"size:255" json:"scope"`
+	Status            string         `gorm:"size:20;default:pending;index" json:"status"` // pending, approved, denied, consumed
+	Interval          int            `gorm:"not null" json:"interval"` // 轮询间隔（秒），slow_down时递增
+	LastPolledAt      *time.Time     `json:"last_polled_at"`
+	AuthTime          *time.Time     `json:"auth_time"` // 用户完成认证的时间
+	AuthMethods       string         `gorm:"size:100" json:"auth_methods"` // 认证方式（amr），空格分隔
+	SessionID         string         `gorm:"size:36;index" json:"-"` // 用户登录会话标识，写入ID Token的sid声明
+	ExpiresAt         time.Time      `gorm:"not null;index" json:"expires_at"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// 关联关系
+	Client            OAuth2Client   `gorm:"foreignKey:OAuth2ClientID" json:"client,omitempty"`
+	User              *User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// InitialAccessToken 动态客户端注册的初始访问令牌（RFC 7591 3节）
+type InitialAccessToken struct {
+	ID                uint           `gorm:"primaryKey" json:"id"`
+	TokenHash         string         `gorm:"uniqueIndex;size:64;not null" json:"-"` // 只保存摘要
+	Description       string         `gorm:"size:255" json:"description"`
+	CreatedBy         uint           `gorm:"not null;index" json:"created_by"` // 签发的管理员，注册的客户端归属该用户
+	MaxUses           int            `gorm:"default:0" json:"max_uses"` // 0表示不限次数
+	UsedCount         int            `gorm:"default:0" json:"used_count"`
+	ExpiresAt         *time.Time     `gorm:"index" json:"expires_at"` // 为空表示不过期
+	Revoked           bool           `gorm:"default:false" json:"revoked"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+}
+
+// ClientAssertionJTI 已使用的客户端断言jti，用于防止断言重放（RFC 7523）
+type ClientAssertionJTI struct {
+	ID                uint           `gorm:"primaryKey" json:"id"`
+	ClientID          string         `gorm:"size:100;not null;uniqueIndex:idx_client_assertion_jti" json:"client_id"`
+	JTI               string         `gorm:"size:255;not null;uniqueIndex:idx_client_assertion_jti" json:"jti"`
+	ExpiresAt         time.Time      `gorm:"not null;index" json:"expires_at"` // 断言过期后记录可清理
+	CreatedAt         time.Time      `json:"created_at"`
+}
+
+// DPoPProofJTI 已使用的DPoP证明jti，用于防止证明重放（RFC 9449 11.1节）
+type DPoPProofJTI struct {
+	ID                uint           `gorm:"primaryKey" json:"id"`
+	JKT               string         `gorm:"size:64;not null;uniqueIndex:idx_dpop_proof_jti" json:"jkt"`
+	JTI               string         `gorm:"size:255;not null;uniqueIndex:idx_dpop_proof_jti" json:"jti"`
+	ExpiresAt         time.Time      `gorm:"not null;index" json:"expires_at"` // 证明过期后记录可清理
+	CreatedAt         time.Time      `json:"created_at"`
+}
+
+// SigningKey 令牌签名密钥，私钥加密后保存
+type SigningKey struct {
+	ID                uint           `gorm:"primaryKey" json:"id"`
+	KID               string         `gorm:"uniqueIndex;size:100;not null" json:"kid"`
+	Algorithm         string         `gorm:"size:20;not null" json:"alg"` // RS256、ES256 或 EdDSA
+	PrivateKey        string         `gorm:"type:text;not null" json:"-"` // 以JWT_SECRET加密的PKCS#8 PEM
+	PublicKey         string         `gorm:"type:text;not null" json:"public_key"` // PKIX PEM
+	Status            string         `gorm:"size:20;not null;index" json:"status"` // pending, active, retiring, retired, revoked
+	ActivatesAt       time.Time      `gorm:"not null" json:"activates_at"` // 开始用于签名的时间，此前仅在JWKS中发布
+	RetireAt          *time.Time     `json:"retire_at"` // 退役中的密钥停止发布和验签的时间
+	RevokedAt         *time.Time     `json:"revoked_at"`
+	RevokedReason     string         `gorm:"size:255" json:"revoked_reason,omitempty"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+}
+
 // AccessToken 访问令牌模型
 type AccessToken struct {
 	ID                uint           `gorm:"primaryKey" json:"id"`
-	Token             string         `gorm:"uniqueIndex;size:500;not null" json:"token"`
+	Token             string         `gorm:"type:text;not null" json:"token"` // JWT访问令牌原文，长度超出索引限制
+	TokenHash         string         `gorm:"uniqueIndex;size:64;not null" json:"-"` // 令牌的SHA-256摘要，按令牌查找记录时使用
 	OAuth2ClientID   uint           `gorm:"not null;index" json:"oauth2_client_id"` // 外键引用 OAuth2Client.ID
 	ClientID          string         `gorm:"not null;index" json:"client_id"` // OAuth2 标准中的 client_id（字符串）
 	UserID            *uint          `gorm:"index" json:"user_id"` // 可为空，支持客户端凭证模式
 	Scope             string         `gorm:"size:255" json:"scope"`
+	Audience          string         `gorm:"type:text" json:"audience"` // 令牌受众（aud），空格分隔
+	JKT               string         `gorm:"size:64" json:"jkt,omitempty"` // 绑定的DPoP公钥指纹（cnf.jkt）
+	X5tS256           string         `gorm:"size:64" json:"x5t_s256,omitempty"` // 绑定的客户端证书指纹（cnf.x5t#S256）
+	Claims            string         `gorm:"type:text" json:"-"` // 授权时的OIDC claims请求参数（JSON），用户信息端点据此返回声明
 	ExpiresAt         time.Time      `gorm:"not null;index" json:"expires_at"`
 	Revoked           bool           `gorm:"default:false" json:"revoked"`
 	CreatedAt         time.Time      `json:"created_at"`
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// OAuth2Scope 授权范围定义：同意页面的展示信息以及该scope释放的用户声明
+type OAuth2Scope struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;size:100;not null" json:"name"`
+	DisplayName string    `gorm:"size:100" json:"display_name"`
+	Description string    `gorm:"size:255" json:"description"`            // 同意页面向用户展示的说明
+	Sensitivity string    `gorm:"size:20;default:low" json:"sensitivity"` // low, medium, high
+	Claims      string    `gorm:"type:text" json:"-"`                     // JSON格式存储该scope释放的声明名称
+	BuiltIn     bool      `gorm:"default:false" json:"built_in"`          // 内置scope，不能删除或改名
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -9,6 +9,7 @@ import (
 type SSOSession struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
 	SessionID   string         `json:"session_id" gorm:"type:varchar(255);uniqueIndex;not null"` // 全局会话ID
+	SID         string         `json:"sid" gorm:"column:sid;type:varchar(36);index"`             // 用户登录会话标识，与ID Token的sid声明一致
 	UserID      uint           `json:"user_id" gorm:"not null"`
 	User        User           `json:"user" gorm:"foreignKey:UserID"`
 	ClientID    string         `json:"client_id" gorm:"type:varchar(255);not null"`              // OAuth2客户端ID
@@ -43,6 +44,7 @@ type LogoutNotification struct {
 	RequestID     string         `json:"request_id" gorm:"type:varchar(255);not null"`     // 关联的登出请求ID
 	ClientID      string         `json:"client_id" gorm:"type:varchar(255);not null"`      // 客户端ID
 	LogoutURL     string         `json:"logout_url" gorm:"type:varchar(500);not null"`     // 登出URL
+	LogoutToken   string         `json:"-" gorm:"type:text"`                               // 发送给客户端的登出令牌（OIDC Back-Channel Logout 2.4节），重试时复用
 	Status        string         `json:"status" gorm:"type:varchar(50);default:'pending'"` // pending, success, failed, timeout
 	ResponseCode  int            `json:"response_code"`                  // HTTP响应码
 	ResponseBody  string         `json:"response_body" gorm:"type:text"`                  // 响应内容
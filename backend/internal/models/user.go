@@ -16,6 +16,9 @@ type User struct {
 	Nickname          string         `gorm:"size:50" json:"nickname"`
 	Avatar            string         `gorm:"size:255" json:"avatar"`
 	EmailVerified     bool           `gorm:"default:false" json:"email_verified"`
+	PhoneNumber       string         `gorm:"size:32" json:"phone_number"`
+	PhoneNumberVerified bool         `gorm:"default:false" json:"phone_number_verified"`
+	Address           string         `gorm:"size:255" json:"address"` // 完整地址，作为OIDC address声明的formatted字段
 	MFAEnabled        bool           `gorm:"default:false" json:"mfa_enabled"`
 	MFASecret         string         `gorm:"size:255" json:"-"`
 	MFARecoveryCodes  string         `gorm:"type:text" json:"-"` // JSON格式存储恢复码
@@ -33,6 +36,16 @@ type User struct {
 	AuditLogs         []AuditLog     `gorm:"foreignKey:UserID" json:"-"`
 }
 
+// UserClaim 用户的自定义声明（如department、employee_id），由管理员维护，通过scope或claims请求参数释放给客户端
+type UserClaim struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_user_claim_name" json:"user_id"`
+	Name      string    `gorm:"size:100;not null;uniqueIndex:idx_user_claim_name" json:"name"`
+	Value     string    `gorm:"type:text" json:"-"` // JSON格式存储声明值
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 // Role 角色模型
 type Role struct {
 	ID          uint           `gorm:"primaryKey" json:"id"`
@@ -70,8 +83,19 @@ type RefreshToken struct {
 	UserID    uint           `gorm:"not null;index" json:"user_id"`
 	Token     string         `gorm:"uniqueIndex;size:255;not null" json:"token"`
 	ClientID  string         `gorm:"size:100" json:"client_id"`
+	Scope     string         `gorm:"size:255" json:"scope"` // 原始授权范围，刷新时只能缩小
+	Resource  string         `gorm:"type:text" json:"resource"` // 授权的资源指示（RFC 8707），刷新时只能从中选择，空格分隔
+	FamilyID  string         `gorm:"size:36;index" json:"family_id"` // 令牌家族ID，同一次登录轮换出的令牌共享
 	ExpiresAt time.Time      `gorm:"not null;index" json:"expires_at"`
+	AbsoluteExpiresAt *time.Time `json:"absolute_expires_at"` // 令牌家族的绝对过期时间，轮换时保持不变，为空表示不限制
 	Revoked   bool           `gorm:"default:false" json:"revoked"`
+	RotatedAt *time.Time     `json:"rotated_at"` // 因轮换而失效的时间，再次使用即视为重放
+	AuthTime  *time.Time     `json:"auth_time"` // 用户完成认证的时间，轮换时保持不变
+	AuthMethods string       `gorm:"size:100" json:"auth_methods"` // 认证方式（amr），空格分隔
+	SessionID string         `gorm:"size:36;index" json:"-"` // 用户登录会话标识（sid），轮换时保持不变
+	Claims    string         `gorm:"type:text" json:"-"` // 授权时的OIDC claims请求参数（JSON），轮换时保持不变
+	JKT       string         `gorm:"size:64" json:"jkt,omitempty"` // 公共客户端的刷新令牌绑定的DPoP公钥指纹
+	X5tS256   string         `gorm:"size:64" json:"x5t_s256,omitempty"` // 公共客户端的刷新令牌绑定的客户端证书指纹
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
@@ -12,6 +12,7 @@ type UserConsent struct {
 	UserID    uint           `gorm:"not null;index" json:"user_id"`
 	ClientID  string         `gorm:"not null;index" json:"client_id"`
 	Scope     string         `gorm:"type:varchar(500)" json:"scope"`
+	Claims    string         `gorm:"type:varchar(1000)" json:"claims"` // 通过claims请求参数同意释放的声明，空格分隔
 	ExpiresAt time.Time      `json:"expires_at"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
@@ -25,3 +26,17 @@ type UserConsent struct {
 func (UserConsent) TableName() string {
 	return "user_consents"
 }
+
+// ConsentApproval 用户在同意页面作出的一次性批准，授权端点据此确认批准来自用户而非客户端伪造的参数
+type ConsentApproval struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	TicketHash  string    `gorm:"uniqueIndex;size:64;not null" json:"-"` // 批准凭据的SHA-256摘要
+	UserID      uint      `gorm:"not null;index" json:"user_id"`
+	ClientID    string    `gorm:"size:100;not null" json:"client_id"`
+	RedirectURI string    `gorm:"size:255" json:"redirect_uri"`
+	Scope       string    `gorm:"type:varchar(500)" json:"scope"`
+	Claims      string    `gorm:"type:varchar(1000)" json:"claims"` // 同意释放的通过claims请求参数请求的声明，空格分隔
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+	Used        bool      `gorm:"default:false" json:"used"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"astro-pass/internal/controllers"
 	"astro-pass/internal/middleware"
+	"astro-pass/internal/utils"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -21,7 +22,8 @@ func SetupRoutes() *gin.Engine {
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"http://localhost:3000"} // 前端地址
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "DPoP"}
+	config.ExposeHeaders = []string{"DPoP-Nonce", "WWW-Authenticate"}
 	config.AllowCredentials = true
 	router.Use(cors.New(config))
 
@@ -75,6 +77,8 @@ func SetupRoutes() *gin.Engine {
 			adminUser.DELETE("/:id", userController.DeleteUser)
 			adminUser.POST("/:id/roles", userController.AssignRoleToUser)
 			adminUser.DELETE("/:id/roles", userController.RemoveRoleFromUser)
+			adminUser.GET("/:id/claims", userController.GetUserClaims)
+			adminUser.PUT("/:id/claims", middleware.PermissionMiddleware("user", "write"), userController.UpdateUserClaims)
 		}
 
 		// 权限管理路由
@@ -100,6 +104,9 @@ func SetupRoutes() *gin.Engine {
 			adminPermission.GET("/permissions", permissionController.GetAllPermissions)
 			adminPermission.PUT("/permissions/:id", permissionController.UpdatePermission)
 			adminPermission.DELETE("/permissions/:id", permissionController.DeletePermission)
+			adminPermission.GET("/client-permissions/:client_id", permissionController.GetClientPermissions)
+			adminPermission.POST("/client-permissions/:client_id", middleware.PermissionMiddleware("permission", "write"), permissionController.GrantClientPermission)
+			adminPermission.DELETE("/client-permissions/:client_id", middleware.PermissionMiddleware("permission", "write"), permissionController.RevokeClientPermission)
 		}
 
 		// 审计日志路由
@@ -136,15 +143,68 @@ func SetupRoutes() *gin.Engine {
 		oauth2Controller := controllers.NewOAuth2Controller()
 		tokenController := controllers.NewTokenController()
 		oauth2 := api.Group("/oauth2")
+		oauth2.Use(middleware.IssuerMiddleware(""))
 		{
-			oauth2.GET("/authorize", middleware.AuthMiddleware(), oauth2Controller.Authorize)
+			oauth2.GET("/authorize", middleware.OptionalAuthMiddleware(), oauth2Controller.Authorize)
 			oauth2.POST("/token", oauth2Controller.Token)
+			oauth2.POST("/par", oauth2Controller.PushAuthorizationRequest)
 			oauth2.GET("/userinfo", oauth2Controller.UserInfo)
 			oauth2.GET("/jwks", tokenController.GetJWKS)
 			oauth2.POST("/revoke", tokenController.RevokeToken)
 			oauth2.POST("/introspect", tokenController.IntrospectToken)
 		}
 
+		// 设备授权路由（RFC 8628）
+		deviceController := controllers.NewDeviceAuthorizationController()
+		oauth2.POST("/device_authorization", deviceController.DeviceAuthorization)
+		device := api.Group("/oauth2/device")
+		device.Use(middleware.AuthMiddleware())
+		{
+			device.GET("/verify", deviceController.GetDeviceVerification)
+			device.POST("/verify", deviceController.VerifyDevice)
+		}
+
+		// 动态客户端注册路由（RFC 7591/7592）
+		clientRegistrationController := controllers.NewClientRegistrationController()
+		oauth2.POST("/register", clientRegistrationController.Register)
+		oauth2.GET("/register/:client_id", clientRegistrationController.GetClientConfiguration)
+		oauth2.PUT("/register/:client_id", clientRegistrationController.UpdateClientConfiguration)
+		oauth2.DELETE("/register/:client_id", clientRegistrationController.DeleteClientConfiguration)
+
+		// 初始访问令牌管理路由（需要管理员权限）
+		initialAccessTokens := api.Group("/admin/oauth2/initial-access-tokens")
+		initialAccessTokens.Use(middleware.AuthMiddleware())
+		initialAccessTokens.Use(middleware.PermissionMiddleware("oauth2_client", "manage"))
+		{
+			initialAccessTokens.POST("", clientRegistrationController.CreateInitialAccessToken)
+			initialAccessTokens.GET("", clientRegistrationController.ListInitialAccessTokens)
+			initialAccessTokens.DELETE("/:id", clientRegistrationController.RevokeInitialAccessToken)
+		}
+
+		// 签名密钥管理路由（需要管理员权限）
+		signingKeyController := controllers.NewSigningKeyController()
+		signingKeys := api.Group("/admin/signing-keys")
+		signingKeys.Use(middleware.AuthMiddleware())
+		signingKeys.Use(middleware.PermissionMiddleware("signing_key", "manage"))
+		{
+			signingKeys.GET("", signingKeyController.ListKeys)
+			signingKeys.POST("/rotate", signingKeyController.RotateKey)
+			signingKeys.POST("/:kid/revoke", signingKeyController.RevokeKey)
+		}
+
+		// 授权范围管理路由（需要管理员权限）
+		scopeController := controllers.NewScopeController()
+		scopes := api.Group("/admin/oauth2/scopes")
+		scopes.Use(middleware.AuthMiddleware())
+		scopes.Use(middleware.PermissionMiddleware("oauth2_scope", "manage"))
+		{
+			scopes.GET("", scopeController.ListScopes)
+			scopes.POST("", scopeController.CreateScope)
+			scopes.GET("/:name", scopeController.GetScope)
+			scopes.PUT("/:name", scopeController.UpdateScope)
+			scopes.DELETE("/:name", scopeController.DeleteScope)
+		}
+
 		// OAuth2客户端管理路由
 		oauth2ClientController := controllers.NewOAuth2ClientController()
 		oauth2Clients := api.Group("/oauth2/clients")
@@ -152,7 +212,22 @@ func SetupRoutes() *gin.Engine {
 		{
 			oauth2Clients.POST("", oauth2ClientController.CreateClient)
 			oauth2Clients.GET("", oauth2ClientController.GetUserClients)
+			oauth2Clients.PUT("/:id", oauth2ClientController.UpdateClient)
 			oauth2Clients.DELETE("/:id", oauth2ClientController.RevokeClient)
+			oauth2Clients.POST("/:id/rotate-secret", oauth2ClientController.RotateClientSecret)
+		}
+
+		// 管理员OAuth2客户端管理路由
+		adminClients := api.Group("/admin/oauth2/clients")
+		adminClients.Use(middleware.AuthMiddleware())
+		adminClients.Use(middleware.PermissionMiddleware("oauth2_client", "manage"))
+		{
+			adminClients.GET("", oauth2ClientController.AdminListClients)
+			adminClients.GET("/:client_id", oauth2ClientController.AdminGetClient)
+			adminClients.GET("/:client_id/audit-logs", oauth2ClientController.AdminGetClientAuditLogs)
+			adminClients.POST("/:client_id/suspend", oauth2ClientController.AdminSuspendClient)
+			adminClients.POST("/:client_id/reactivate", oauth2ClientController.AdminReactivateClient)
+			adminClients.POST("/:client_id/transfer", oauth2ClientController.AdminTransferClient)
 		}
 
 		// 授权同意路由
@@ -166,8 +241,34 @@ func SetupRoutes() *gin.Engine {
 			consent.DELETE("/:client_id", middleware.AuthMiddleware(), consentController.RevokeConsent)
 		}
 
-		// OIDC发现端点
-		router.GET("/.well-known/openid-configuration", tokenController.GetOpenIDConfiguration)
+		// OIDC发现和授权服务器元数据端点（RFC 8414），按签发者生成
+		router.GET("/.well-known/openid-configuration", middleware.IssuerMiddleware(""), tokenController.GetOpenIDConfiguration)
+		router.GET("/.well-known/oauth-authorization-server", middleware.IssuerMiddleware(""), tokenController.GetAuthorizationServerMetadata)
+
+		// 带路径的签发者（OAUTH2_ISSUERS）：协议端点注册在签发者路径下，
+		// 元数据地址按RFC 8414 3.1节插入签发者路径，OIDC发现地址追加在签发者之后
+		for _, issuerPath := range utils.IssuerPaths() {
+			issuerMiddleware := middleware.IssuerMiddleware(issuerPath)
+			router.GET("/.well-known/oauth-authorization-server"+issuerPath, issuerMiddleware, tokenController.GetAuthorizationServerMetadata)
+			router.GET(issuerPath+"/.well-known/openid-configuration", issuerMiddleware, tokenController.GetOpenIDConfiguration)
+
+			issuerOAuth2 := router.Group(issuerPath + "/api/oauth2")
+			issuerOAuth2.Use(issuerMiddleware)
+			{
+				issuerOAuth2.GET("/authorize", middleware.OptionalAuthMiddleware(), oauth2Controller.Authorize)
+				issuerOAuth2.POST("/token", oauth2Controller.Token)
+				issuerOAuth2.POST("/par", oauth2Controller.PushAuthorizationRequest)
+				issuerOAuth2.GET("/userinfo", oauth2Controller.UserInfo)
+				issuerOAuth2.GET("/jwks", tokenController.GetJWKS)
+				issuerOAuth2.POST("/revoke", tokenController.RevokeToken)
+				issuerOAuth2.POST("/introspect", tokenController.IntrospectToken)
+				issuerOAuth2.POST("/device_authorization", deviceController.DeviceAuthorization)
+				issuerOAuth2.POST("/register", clientRegistrationController.Register)
+				issuerOAuth2.GET("/register/:client_id", clientRegistrationController.GetClientConfiguration)
+				issuerOAuth2.PUT("/register/:client_id", clientRegistrationController.UpdateClientConfiguration)
+				issuerOAuth2.DELETE("/register/:client_id", clientRegistrationController.DeleteClientConfiguration)
+			}
+		}
 
 		// WebAuthn路由
 		webauthnController := controllers.NewWebAuthnController()
@@ -268,6 +369,7 @@ func SetupRoutes() *gin.Engine {
 		oidc := api.Group("/oidc")
 		{
 			oidc.GET("/logout", sloController.GetOIDCLogout)
+			oidc.GET("/check_session", sloController.CheckSessionIframe)
 		}
 
 		// SAML路由
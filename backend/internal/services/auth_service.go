@@ -12,6 +12,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrMFARequired 应用要求MFA验证（acr_values），但登录请求未提供验证码
+var ErrMFARequired = errors.New("该应用要求通过MFA验证登录，请输入MFA验证码")
+
 type AuthService struct{}
 
 func NewAuthService() *AuthService {
@@ -75,8 +78,10 @@ func (s *AuthService) Register(username, email, password, nickname string) (*mod
 	return user, nil
 }
 
-	// Login 用户登录
-func (s *AuthService) Login(username, password, ip, userAgent string) (*models.User, string, string, error) {
+// Login 用户登录
+// mfaCode 为可选的TOTP验证码，用户已启用MFA且验证通过时记为多因素认证
+// requireMFA 为true时（授权请求的acr_values要求MFA），已启用MFA的用户必须提供验证码
+func (s *AuthService) Login(username, password, mfaCode string, requireMFA bool, ip, userAgent string) (*models.User, string, string, error) {
 	// 检查账户是否被锁定
 	lockService := NewAccountLockService()
 	locked, unlockTime, err := lockService.IsAccountLocked(username, ip)
@@ -109,11 +114,32 @@ func (s *AuthService) Login(username, password, ip, userAgent string) (*models.U
 		return nil, "", "", errors.New("用户名或密码错误")
 	}
 
+	// 应用要求MFA时（step-up）不能只凭密码登录
+	if requireMFA && user.MFAEnabled && mfaCode == "" {
+		return nil, "", "", ErrMFARequired
+	}
+
+	// 记录认证方式
+	authMethods := []string{utils.AMRPassword}
+	if user.MFAEnabled && mfaCode != "" {
+		valid, err := NewMFAService().VerifyTOTP(user.ID, mfaCode)
+		if err != nil || !valid {
+			lockService.RecordLoginAttempt(username, ip, false, "MFA验证码错误")
+			s.createAuditLog(user.ID, "login", "user", user.UUID, "登录失败：MFA验证码错误", map[string]interface{}{"ip": ip})
+			return nil, "", "", errors.New("MFA验证码错误")
+		}
+		authMethods = append(authMethods, utils.AMROTP, utils.AMRMFA)
+	}
+	authTime := time.Now()
+	// 登录会话标识同时作为刷新令牌家族ID，经授权码流程写入ID Token的sid
+	sessionID := utils.GenerateUUID()
+	auth := &utils.AuthContext{AuthTime: authTime, AMR: authMethods, SessionID: sessionID}
+
 	// 登录成功，清除登录尝试记录
 	lockService.ClearLoginAttempts(username, ip)
 
 	// 生成Token
-	accessToken, err := utils.GenerateAccessToken(user.ID, user.Username, user.Email)
+	accessToken, err := utils.GenerateAccessTokenWithAuth(user.ID, user.UUID, user.Username, user.Email, auth)
 	if err != nil {
 		return nil, "", "", errors.New("生成访问令牌失败")
 	}
@@ -125,9 +151,13 @@ func (s *AuthService) Login(username, password, ip, userAgent string) (*models.U
 
 	// 保存刷新令牌
 	refreshTokenModel := &models.RefreshToken{
-		UserID:    user.ID,
-		Token:     refreshToken,
-		ExpiresAt: time.Now().Add(time.Hour * 24 * 7), // 7天
+		UserID:      user.ID,
+		Token:       refreshToken,
+		FamilyID:    sessionID,
+		SessionID:   sessionID,
+		AuthTime:    &authTime,
+		AuthMethods: strings.Join(authMethods, " "),
+		ExpiresAt:   time.Now().Add(time.Hour * 24 * 7), // 7天
 	}
 	database.DB.Create(refreshTokenModel)
 
@@ -163,14 +193,18 @@ func (s *AuthService) detectDevice(userAgent string) string {
 // RefreshToken 刷新访问令牌
 func (s *AuthService) RefreshToken(refreshTokenString string) (string, string, error) {
 	// 解析刷新令牌
-	_, err := utils.ParseToken(refreshTokenString)
+	_, err := utils.ParseRefreshToken(refreshTokenString)
 	if err != nil {
 		return "", "", errors.New("无效的刷新令牌")
 	}
 
 	// 查找刷新令牌记录
 	var refreshToken models.RefreshToken
+	tokenService := NewTokenService()
 	if err := database.DB.Where("token = ? AND revoked = ?", refreshTokenString, false).First(&refreshToken).Error; err != nil {
+		if tokenService.DetectRefreshTokenReuse(refreshTokenString) {
+			return "", "", ErrRefreshTokenReused
+		}
 		return "", "", errors.New("刷新令牌不存在或已撤销")
 	}
 
@@ -185,8 +219,9 @@ func (s *AuthService) RefreshToken(refreshTokenString string) (string, string, e
 		return "", "", errors.New("用户不存在")
 	}
 
-	// 生成新的访问令牌和刷新令牌
-	newAccessToken, err := utils.GenerateAccessToken(user.ID, user.Username, user.Email)
+	// 生成新的访问令牌和刷新令牌（沿用原始认证上下文）
+	newAccessToken, err := utils.GenerateAccessTokenWithAuth(user.ID, user.UUID, user.Username, user.Email,
+		authContextOf(refreshToken.AuthTime, refreshToken.AuthMethods, refreshToken.SessionID))
 	if err != nil {
 		return "", "", errors.New("生成访问令牌失败")
 	}
@@ -196,17 +231,10 @@ func (s *AuthService) RefreshToken(refreshTokenString string) (string, string, e
 		return "", "", errors.New("生成刷新令牌失败")
 	}
 
-	// 撤销旧的刷新令牌
-	refreshToken.Revoked = true
-	database.DB.Save(&refreshToken)
-
-	// 保存新的刷新令牌
-	newRefreshTokenModel := &models.RefreshToken{
-		UserID:    user.ID,
-		Token:     newRefreshToken,
-		ExpiresAt: time.Now().Add(time.Hour * 24 * 7),
+	// 轮换刷新令牌（新令牌继承令牌家族，会话同步更新）
+	if err := tokenService.RotateRefreshToken(&refreshToken, newRefreshToken, time.Hour*24*7); err != nil {
+		return "", "", err
 	}
-	database.DB.Create(newRefreshTokenModel)
 
 	return newAccessToken, newRefreshToken, nil
 }
@@ -218,7 +246,7 @@ func (s *AuthService) createAuditLog(userID uint, action, resource, resourceID,
 	if userID > 0 {
 		userIDPtr = &userID
 	}
-	
+
 	// 从metadata中提取IP和UserAgent
 	var ip, userAgent string
 	if metadata != nil {
@@ -229,7 +257,6 @@ func (s *AuthService) createAuditLog(userID uint, action, resource, resourceID,
 			userAgent = uaVal
 		}
 	}
-	
+
 	_ = auditService.CreateAuditLog(userIDPtr, action, resource, resourceID, message, "success", ip, userAgent, metadata)
 }
-
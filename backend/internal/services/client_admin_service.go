@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+
+	"astro-pass/internal/database"
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+)
+
+// ClientSearchQuery 管理员检索客户端的条件
+type ClientSearchQuery struct {
+	Search   string // 匹配client_id或客户端名称
+	Status   string // active, suspended, revoked，为空表示全部
+	OwnerID  uint   // 所有者用户ID，0表示全部
+	Page     int
+	PageSize int
+}
+
+// ClientAdminService 管理员对全部OAuth2客户端的管理
+type ClientAdminService struct{}
+
+func NewClientAdminService() *ClientAdminService {
+	return &ClientAdminService{}
+}
+
+// SearchClients 分页检索客户端
+func (s *ClientAdminService) SearchClients(q *ClientSearchQuery) ([]models.OAuth2Client, int64, error) {
+	var clients []models.OAuth2Client
+	var total int64
+
+	query := database.DB.Model(&models.OAuth2Client{})
+	if q.Search != "" {
+		query = query.Where("client_id LIKE ? OR client_name LIKE ?", "%"+q.Search+"%", "%"+q.Search+"%")
+	}
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+	if q.OwnerID != 0 {
+		query = query.Where("user_id = ?", q.OwnerID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (q.Page - 1) * q.PageSize
+	if err := query.Preload("User").Offset(offset).Limit(q.PageSize).Order("created_at DESC").Find(&clients).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return clients, total, nil
+}
+
+// GetClient 获取任意状态的客户端
+func (s *ClientAdminService) GetClient(clientID string) (*models.OAuth2Client, error) {
+	var client models.OAuth2Client
+	if err := database.DB.Preload("User").Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		return nil, errors.New("客户端不存在")
+	}
+	return &client, nil
+}
+
+// SuspendClient 暂停客户端：暂停期间客户端无法认证和发起授权，已签发的令牌在内省和用户信息端点视为无效
+func (s *ClientAdminService) SuspendClient(clientID, reason string, operatorID uint, ip, userAgent string) (*models.OAuth2Client, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.Status != "active" {
+		return nil, errors.New("只能暂停正常状态的客户端")
+	}
+
+	if err := database.DB.Model(client).Update("status", "suspended").Error; err != nil {
+		return nil, errors.New("暂停客户端失败")
+	}
+	client.Status = "suspended"
+
+	s.audit(operatorID, "client_suspend", client.ClientID, "暂停客户端", ip, userAgent, map[string]interface{}{
+		"reason":   reason,
+		"owner_id": client.UserID,
+	})
+	return client, nil
+}
+
+// ReactivateClient 恢复已暂停的客户端，已撤销的客户端不能恢复
+func (s *ClientAdminService) ReactivateClient(clientID string, operatorID uint, ip, userAgent string) (*models.OAuth2Client, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.Status != "suspended" {
+		return nil, errors.New("只能恢复已暂停的客户端")
+	}
+
+	if err := database.DB.Model(client).Update("status", "active").Error; err != nil {
+		return nil, errors.New("恢复客户端失败")
+	}
+	client.Status = "active"
+
+	s.audit(operatorID, "client_reactivate", client.ClientID, "恢复客户端", ip, userAgent, map[string]interface{}{
+		"owner_id": client.UserID,
+	})
+	return client, nil
+}
+
+// TransferClient 将客户端转移给其他用户，新所有者必须是正常状态的用户
+func (s *ClientAdminService) TransferClient(clientID string, newOwnerID, operatorID uint, ip, userAgent string) (*models.OAuth2Client, error) {
+	client, err := s.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client.Status == "revoked" {
+		return nil, errors.New("已撤销的客户端不能转移")
+	}
+
+	var owner models.User
+	if err := database.DB.First(&owner, newOwnerID).Error; err != nil {
+		return nil, errors.New("新所有者不存在")
+	}
+	if owner.Status != "active" {
+		return nil, errors.New("新所有者账户不可用")
+	}
+	if client.UserID == owner.ID {
+		return nil, errors.New("客户端已属于该用户")
+	}
+
+	previousOwnerID := client.UserID
+	if err := database.DB.Model(client).Update("user_id", owner.ID).Error; err != nil {
+		return nil, errors.New("转移客户端失败")
+	}
+	client.UserID = owner.ID
+	client.User = owner
+
+	s.audit(operatorID, "client_transfer", client.ClientID, "转移客户端所有权", ip, userAgent, map[string]interface{}{
+		"from_user_id": previousOwnerID,
+		"to_user_id":   owner.ID,
+	})
+	return client, nil
+}
+
+// GetClientAuditLogs 分页获取与客户端相关的审计日志（创建、更新、密钥轮换、暂停、转移等）
+func (s *ClientAdminService) GetClientAuditLogs(clientID string, page, pageSize int) ([]models.AuditLog, int64, error) {
+	var logs []models.AuditLog
+	var total int64
+
+	query := database.DB.Model(&models.AuditLog{}).Where("resource = ? AND resource_id = ?", "oauth2_client", clientID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Preload("User").Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return logs, total, nil
+}
+
+// audit 记录客户端管理的审计日志
+func (s *ClientAdminService) audit(userID uint, action, clientID, message, ip, userAgent string, metadata map[string]interface{}) {
+	if err := NewAuditService().CreateAuditLog(&userID, action, "oauth2_client", clientID, message, "success", ip, userAgent, metadata); err != nil {
+		utils.Warn("记录客户端管理审计日志失败: %v", err)
+	}
+}
+
+// clientIsActive 客户端是否处于正常状态，暂停或撤销的客户端签发的令牌不再视为有效
+func clientIsActive(clientID string) bool {
+	var count int64
+	database.DB.Model(&models.OAuth2Client{}).Where("client_id = ? AND status = ?", clientID, "active").Count(&count)
+	return count > 0
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signClientAssertion 签名客户端断言，kid为空时不设置
+func signClientAssertion(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	assertion, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("签名客户端断言失败: %v", err)
+	}
+	return assertion
+}
+
+// assertionClaims 客户端断言的声明，各测试用例在此基础上修改
+func assertionClaims(clientID string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss": clientID,
+		"sub": clientID,
+		"aud": utils.PrimaryIssuer() + "/api/oauth2/token",
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"jti": utils.GenerateUUID(),
+	}
+}
+
+// newSecretJWTClient 使用client_secret_jwt认证的客户端
+func newSecretJWTClient(t *testing.T, secret string) *models.OAuth2Client {
+	t.Helper()
+	encrypted, err := utils.EncryptSecret(secret)
+	if err != nil {
+		t.Fatalf("加密客户端密钥失败: %v", err)
+	}
+	return &models.OAuth2Client{
+		ClientID:                "secret-jwt-client",
+		ClientSecretHash:        utils.HashToken(secret),
+		ClientSecretEncrypted:   encrypted,
+		TokenEndpointAuthMethod: ClientAuthSecretJWT,
+	}
+}
+
+func TestVerifyClientAssertionSecretJWT(t *testing.T) {
+	setupTestDB(t, &models.ClientAssertionJTI{})
+
+	secret, _ := utils.GenerateRandomToken(32)
+	client := newSecretJWTClient(t, secret)
+	service := NewOAuth2Service()
+
+	tests := []struct {
+		name    string
+		modify  func(claims jwt.MapClaims)
+		key     []byte
+		wantErr bool
+	}{
+		{name: "有效断言", key: []byte(secret)},
+		{name: "aud为令牌端点以外的服务", modify: func(c jwt.MapClaims) { c["aud"] = "https://rp.example.com/api/oauth2/token" }, key: []byte(secret), wantErr: true},
+		{name: "缺少aud", modify: func(c jwt.MapClaims) { delete(c, "aud") }, key: []byte(secret), wantErr: true},
+		{name: "已过期", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, key: []byte(secret), wantErr: true},
+		{name: "缺少exp", modify: func(c jwt.MapClaims) { delete(c, "exp") }, key: []byte(secret), wantErr: true},
+		{name: "有效期过长", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(2 * time.Hour).Unix() }, key: []byte(secret), wantErr: true},
+		{name: "缺少jti", modify: func(c jwt.MapClaims) { delete(c, "jti") }, key: []byte(secret), wantErr: true},
+		{name: "iss不是client_id", modify: func(c jwt.MapClaims) { c["iss"] = "other-client" }, key: []byte(secret), wantErr: true},
+		{name: "sub不是client_id", modify: func(c jwt.MapClaims) { c["sub"] = "other-client" }, key: []byte(secret), wantErr: true},
+		// 数据库中只保存密钥摘要，取得摘要不能伪造断言
+		{name: "使用密钥摘要签名", key: []byte(client.ClientSecretHash), wantErr: true},
+		{name: "使用错误的密钥签名", key: []byte("wrong-secret"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := assertionClaims(client.ClientID)
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			assertion := signClientAssertion(t, jwt.SigningMethodHS256, tt.key, "", claims)
+			err := service.verifyClientAssertion(client, assertion)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyClientAssertion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyClientAssertionReplay(t *testing.T) {
+	setupTestDB(t, &models.ClientAssertionJTI{})
+
+	secret, _ := utils.GenerateRandomToken(32)
+	client := newSecretJWTClient(t, secret)
+	service := NewOAuth2Service()
+
+	claims := assertionClaims(client.ClientID)
+	assertion := signClientAssertion(t, jwt.SigningMethodHS256, []byte(secret), "", claims)
+	if err := service.verifyClientAssertion(client, assertion); err != nil {
+		t.Fatalf("首次使用断言 error = %v", err)
+	}
+	if err := service.verifyClientAssertion(client, assertion); err == nil {
+		t.Fatal("重放同一断言应被拒绝")
+	}
+
+	// 相同jti的新断言同样被唯一索引拒绝
+	claims["exp"] = time.Now().Add(10 * time.Minute).Unix()
+	if err := service.verifyClientAssertion(client, signClientAssertion(t, jwt.SigningMethodHS256, []byte(secret), "", claims)); err == nil {
+		t.Fatal("重复使用jti应被拒绝")
+	}
+
+	// jti按客户端区分，其他客户端可以使用相同的jti
+	other := newSecretJWTClient(t, secret)
+	other.ClientID = "other-client"
+	otherClaims := assertionClaims(other.ClientID)
+	otherClaims["jti"] = claims["jti"]
+	if err := service.verifyClientAssertion(other, signClientAssertion(t, jwt.SigningMethodHS256, []byte(secret), "", otherClaims)); err != nil {
+		t.Errorf("其他客户端使用相同jti error = %v", err)
+	}
+}
+
+func TestVerifyClientAssertionPrivateKeyJWT(t *testing.T) {
+	setupTestDB(t, &models.ClientAssertionJTI{})
+
+	key, err := utils.GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatalf("生成客户端密钥失败: %v", err)
+	}
+	jwk, err := utils.NewPublicJWK(key.Public())
+	if err != nil {
+		t.Fatalf("生成JWK失败: %v", err)
+	}
+	jwk.Kid = "client-key-1"
+	jwks, _ := json.Marshal(utils.JWKSet{Keys: []utils.JWK{jwk}})
+
+	client := &models.OAuth2Client{
+		ClientID:                "private-key-client",
+		TokenEndpointAuthMethod: ClientAuthPrivateKey,
+		JWKS:                    string(jwks),
+	}
+	service := NewOAuth2Service()
+
+	assertion := signClientAssertion(t, jwt.SigningMethodES256, key, jwk.Kid, assertionClaims(client.ClientID))
+	if err := service.verifyClientAssertion(client, assertion); err != nil {
+		t.Fatalf("verifyClientAssertion() error = %v", err)
+	}
+
+	// 未注册的密钥签名的断言
+	otherKey, _ := utils.GenerateSigningKey("ES256")
+	forged := signClientAssertion(t, jwt.SigningMethodES256, otherKey, jwk.Kid, assertionClaims(client.ClientID))
+	if err := service.verifyClientAssertion(client, forged); err == nil {
+		t.Error("未注册密钥签名的断言应被拒绝")
+	}
+
+	// private_key_jwt客户端不接受HMAC签名的断言
+	hmac := signClientAssertion(t, jwt.SigningMethodHS256, []byte("secret"), jwk.Kid, assertionClaims(client.ClientID))
+	if err := service.verifyClientAssertion(client, hmac); err == nil {
+		t.Error("private_key_jwt客户端应拒绝HMAC签名的断言")
+	}
+}
@@ -0,0 +1,443 @@
+package services
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"astro-pass/internal/config"
+	"astro-pass/internal/database"
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+	"gorm.io/gorm"
+)
+
+// 动态客户端注册错误码（RFC 7591 3.2.2节）
+const (
+	RegistrationErrInvalidRedirectURI    = "invalid_redirect_uri"
+	RegistrationErrInvalidClientMetadata = "invalid_client_metadata"
+)
+
+// RegistrationError 动态客户端注册错误
+type RegistrationError struct {
+	Code        string
+	Description string
+}
+
+func (e *RegistrationError) Error() string {
+	return e.Description
+}
+
+// ErrInvalidRegistrationToken 初始访问令牌或注册访问令牌无效
+var ErrInvalidRegistrationToken = errors.New("invalid_token")
+
+// ClientMetadata 客户端元数据（RFC 7591 2节）
+type ClientMetadata struct {
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+	RequestURIs  []string `json:"request_uris,omitempty"`
+	// OIDC Back-Channel Logout 2.2节：用户登出时接收登出令牌的地址
+	BackchannelLogoutURI             string `json:"backchannel_logout_uri,omitempty"`
+	BackchannelLogoutSessionRequired bool   `json:"backchannel_logout_session_required,omitempty"`
+	// OIDC Front-Channel Logout 2节：用户登出时登出页面以iframe加载的地址
+	FrontchannelLogoutURI             string          `json:"frontchannel_logout_uri,omitempty"`
+	FrontchannelLogoutSessionRequired bool            `json:"frontchannel_logout_session_required,omitempty"`
+	TokenEndpointAuthMethod           string          `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes                        []string        `json:"grant_types,omitempty"`
+	ResponseTypes                     []string        `json:"response_types,omitempty"`
+	ClientName                        string          `json:"client_name,omitempty"`
+	ClientURI                         string          `json:"client_uri,omitempty"`
+	LogoURI                           string          `json:"logo_uri,omitempty"`
+	Scope                             string          `json:"scope,omitempty"`
+	JWKSURI                           string          `json:"jwks_uri,omitempty"`
+	JWKS                              json.RawMessage `json:"jwks,omitempty"`
+	// RFC 9126 6节：要求该客户端只能通过PAR发起授权请求
+	RequirePushedAuthorizationRequests bool `json:"require_pushed_authorization_requests,omitempty"`
+	// RFC 9449 5.2节：要求该客户端的访问令牌均绑定DPoP密钥
+	DPoPBoundAccessTokens bool `json:"dpop_bound_access_tokens,omitempty"`
+	// RFC 8705 3.4节：要求该客户端的访问令牌均绑定双向TLS的客户端证书
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+	TLSClientAuthIdentity
+}
+
+// ClientInformationResponse 客户端信息响应（RFC 7591 3.2.1节、RFC 7592 3节）
+type ClientInformationResponse struct {
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64 `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri"`
+	ClientMetadata
+}
+
+type ClientRegistrationService struct {
+	oauth2Service *OAuth2Service
+}
+
+func NewClientRegistrationService() *ClientRegistrationService {
+	return &ClientRegistrationService{
+		oauth2Service: NewOAuth2Service(),
+	}
+}
+
+// CreateInitialAccessToken 签发初始访问令牌，明文只返回一次
+func (s *ClientRegistrationService) CreateInitialAccessToken(adminID uint, description string, maxUses int, expiresIn time.Duration) (*models.InitialAccessToken, string, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", errors.New("生成初始访问令牌失败")
+	}
+
+	iat := &models.InitialAccessToken{
+		TokenHash:   utils.HashToken(token),
+		Description: description,
+		CreatedBy:   adminID,
+		MaxUses:     maxUses,
+	}
+	if expiresIn > 0 {
+		expiresAt := time.Now().Add(expiresIn)
+		iat.ExpiresAt = &expiresAt
+	}
+
+	if err := database.DB.Create(iat).Error; err != nil {
+		return nil, "", errors.New("保存初始访问令牌失败")
+	}
+
+	return iat, token, nil
+}
+
+// ListInitialAccessTokens 获取初始访问令牌列表
+func (s *ClientRegistrationService) ListInitialAccessTokens() ([]models.InitialAccessToken, error) {
+	var tokens []models.InitialAccessToken
+	if err := database.DB.Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, errors.New("获取初始访问令牌列表失败")
+	}
+	return tokens, nil
+}
+
+// RevokeInitialAccessToken 撤销初始访问令牌
+func (s *ClientRegistrationService) RevokeInitialAccessToken(id uint) error {
+	result := database.DB.Model(&models.InitialAccessToken{}).Where("id = ?", id).Update("revoked", true)
+	if result.Error != nil {
+		return errors.New("撤销初始访问令牌失败")
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("初始访问令牌不存在")
+	}
+	return nil
+}
+
+// findInitialAccessToken 校验初始访问令牌是否有效
+func (s *ClientRegistrationService) findInitialAccessToken(token string) (*models.InitialAccessToken, error) {
+	if token == "" {
+		return nil, ErrInvalidRegistrationToken
+	}
+
+	var iat models.InitialAccessToken
+	if err := database.DB.Where("token_hash = ? AND revoked = ?", utils.HashToken(token), false).First(&iat).Error; err != nil {
+		return nil, ErrInvalidRegistrationToken
+	}
+	if iat.ExpiresAt != nil && time.Now().After(*iat.ExpiresAt) {
+		return nil, ErrInvalidRegistrationToken
+	}
+	if iat.MaxUses > 0 && iat.UsedCount >= iat.MaxUses {
+		return nil, ErrInvalidRegistrationToken
+	}
+
+	return &iat, nil
+}
+
+// consumeInitialAccessToken 消耗一次初始访问令牌，使用条件更新避免并发注册超出次数限制
+func (s *ClientRegistrationService) consumeInitialAccessToken(iat *models.InitialAccessToken) error {
+	result := database.DB.Model(&models.InitialAccessToken{}).
+		Where("id = ? AND (max_uses = 0 OR used_count < max_uses)", iat.ID).
+		Update("used_count", gorm.Expr("used_count + 1"))
+	if result.Error != nil || result.RowsAffected == 0 {
+		return ErrInvalidRegistrationToken
+	}
+	return nil
+}
+
+// RegisterClient 动态注册客户端（RFC 7591）
+func (s *ClientRegistrationService) RegisterClient(initialAccessToken string, metadata *ClientMetadata, ip, userAgent string) (*ClientInformationResponse, error) {
+	iat, err := s.findInitialAccessToken(initialAccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := validateClientMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// 元数据校验通过后才计入使用次数
+	if err := s.consumeInitialAccessToken(iat); err != nil {
+		return nil, err
+	}
+
+	client, clientSecret, err := s.oauth2Service.CreateClient(iat.CreatedBy, reg)
+	if err != nil {
+		return nil, &RegistrationError{Code: RegistrationErrInvalidClientMetadata, Description: err.Error()}
+	}
+
+	registrationToken, err := s.issueRegistrationAccessToken(client)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(iat.CreatedBy, "client_register", client.ClientID, "动态注册客户端", ip, userAgent, map[string]interface{}{
+		"initial_access_token_id": iat.ID,
+		"client_name":             client.ClientName,
+	})
+
+	response := clientInformation(client)
+	response.ClientSecret = clientSecret
+	response.RegistrationAccessToken = registrationToken
+	return response, nil
+}
+
+// AuthenticateRegistrationAccess 使用注册访问令牌认证对客户端配置端点的访问（RFC 7592）
+func (s *ClientRegistrationService) AuthenticateRegistrationAccess(clientID, registrationAccessToken string) (*models.OAuth2Client, error) {
+	if registrationAccessToken == "" {
+		return nil, ErrInvalidRegistrationToken
+	}
+
+	client, err := s.oauth2Service.GetClientByClientID(clientID)
+	if err != nil || client.RegistrationAccessTokenHash == "" {
+		return nil, ErrInvalidRegistrationToken
+	}
+
+	hash := utils.HashToken(registrationAccessToken)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(client.RegistrationAccessTokenHash)) != 1 {
+		return nil, ErrInvalidRegistrationToken
+	}
+
+	return client, nil
+}
+
+// GetClientConfiguration 读取客户端配置（RFC 7592 2.1节），客户端密钥只保存摘要，不再返回
+func (s *ClientRegistrationService) GetClientConfiguration(client *models.OAuth2Client) *ClientInformationResponse {
+	return clientInformation(client)
+}
+
+// UpdateClientConfiguration 以请求中的元数据整体替换客户端配置（RFC 7592 2.2节）
+func (s *ClientRegistrationService) UpdateClientConfiguration(client *models.OAuth2Client, clientID, clientSecret string, metadata *ClientMetadata, ip, userAgent string) (*ClientInformationResponse, error) {
+	// 请求体中的client_id必须与当前客户端一致，client_secret若提供也必须一致
+	if clientID != client.ClientID {
+		return nil, &RegistrationError{Code: RegistrationErrInvalidClientMetadata, Description: "client_id不匹配"}
+	}
+	if clientSecret != "" && verifyClientSecret(client, clientSecret) != nil {
+		return nil, &RegistrationError{Code: RegistrationErrInvalidClientMetadata, Description: "client_secret不匹配"}
+	}
+
+	reg, err := validateClientMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	// 令牌有效期不属于客户端可自行注册的元数据，保持管理员或所有者的设置
+	reg.TokenLifetimes = ClientTokenLifetimesOf(client)
+	newSecret, err := s.oauth2Service.UpdateClientMetadata(client, reg)
+	if err != nil {
+		return nil, &RegistrationError{Code: RegistrationErrInvalidClientMetadata, Description: err.Error()}
+	}
+
+	s.audit(client.UserID, "client_update", client.ClientID, "通过客户端配置端点更新客户端", ip, userAgent, nil)
+
+	// 仅在签发了新密钥时返回明文
+	response := clientInformation(client)
+	response.ClientSecret = newSecret
+	return response, nil
+}
+
+// DeleteClientConfiguration 注销客户端（RFC 7592 2.3节）
+func (s *ClientRegistrationService) DeleteClientConfiguration(client *models.OAuth2Client, ip, userAgent string) error {
+	client.Status = "revoked"
+	client.RegistrationAccessTokenHash = ""
+	if err := database.DB.Save(client).Error; err != nil {
+		return errors.New("注销客户端失败")
+	}
+
+	// 撤销该客户端签发的令牌
+	database.DB.Model(&models.AccessToken{}).Where("client_id = ?", client.ClientID).Update("revoked", true)
+	database.DB.Model(&models.RefreshToken{}).Where("client_id = ?", client.ClientID).Update("revoked", true)
+
+	s.audit(client.UserID, "client_delete", client.ClientID, "通过客户端配置端点注销客户端", ip, userAgent, nil)
+	return nil
+}
+
+// issueRegistrationAccessToken 签发注册访问令牌，只保存摘要
+func (s *ClientRegistrationService) issueRegistrationAccessToken(client *models.OAuth2Client) (string, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", errors.New("生成注册访问令牌失败")
+	}
+
+	client.RegistrationAccessTokenHash = utils.HashToken(token)
+	if err := database.DB.Model(client).Update("registration_access_token_hash", client.RegistrationAccessTokenHash).Error; err != nil {
+		return "", errors.New("保存注册访问令牌失败")
+	}
+
+	return token, nil
+}
+
+// audit 记录客户端注册相关的审计日志
+func (s *ClientRegistrationService) audit(userID uint, action, clientID, message, ip, userAgent string, metadata map[string]interface{}) {
+	if err := NewAuditService().CreateAuditLog(&userID, action, "oauth2_client", clientID, message, "success", ip, userAgent, metadata); err != nil {
+		utils.Warn("记录客户端注册审计日志失败: %v", err)
+	}
+}
+
+// RegistrationClientURI 客户端配置端点地址
+func RegistrationClientURI(clientID string) string {
+	return strings.TrimRight(config.Cfg.App.URL, "/") + "/api/oauth2/register/" + url.PathEscape(clientID)
+}
+
+// clientInformation 将客户端转换为RFC 7591/7592定义的客户端信息
+func clientInformation(client *models.OAuth2Client) *ClientInformationResponse {
+	response := &ClientInformationResponse{
+		ClientID:              client.ClientID,
+		ClientIDIssuedAt:      client.CreatedAt.Unix(),
+		RegistrationClientURI: RegistrationClientURI(client.ClientID),
+		ClientMetadata: ClientMetadata{
+			RedirectURIs:                      ClientRedirectURIs(client),
+			RequestURIs:                       ClientRequestURIs(client),
+			BackchannelLogoutURI:              client.BackchannelLogoutURI,
+			BackchannelLogoutSessionRequired:  client.BackchannelLogoutSessionRequired,
+			FrontchannelLogoutURI:             client.FrontchannelLogoutURI,
+			FrontchannelLogoutSessionRequired: client.FrontchannelLogoutSessionRequired,
+			TokenEndpointAuthMethod:           client.TokenEndpointAuthMethod,
+			GrantTypes:                        ClientGrantTypes(client),
+			ResponseTypes:                     ClientResponseTypes(client),
+			ClientName:                        client.ClientName,
+			ClientURI:                         client.ClientURI,
+			LogoURI:                           client.LogoURI,
+			Scope:                             client.Scope,
+			JWKSURI:                           client.JWKSURI,
+
+			RequirePushedAuthorizationRequests: client.RequirePAR,
+			DPoPBoundAccessTokens:              client.RequireDPoP,
+
+			TLSClientCertificateBoundAccessTokens: client.RequireMTLSBinding,
+			TLSClientAuthIdentity:                 ClientTLSIdentity(client),
+		},
+	}
+	if client.JWKS != "" {
+		response.JWKS = json.RawMessage(client.JWKS)
+	}
+	if client.ClientSecretHash != "" {
+		// 0表示密钥不过期
+		var expiresAt int64
+		if client.ClientSecretExpiresAt != nil {
+			expiresAt = client.ClientSecretExpiresAt.Unix()
+		}
+		response.ClientSecretExpiresAt = &expiresAt
+	}
+	return response
+}
+
+// validateClientMetadata 校验客户端元数据并转换为注册参数
+func validateClientMetadata(metadata *ClientMetadata) (*ClientRegistration, error) {
+	invalid := func(description string) error {
+		return &RegistrationError{Code: RegistrationErrInvalidClientMetadata, Description: description}
+	}
+
+	// RFC 7591 2节：grant_types默认为authorization_code，response_types默认为code
+	grantTypes := metadata.GrantTypes
+	responseTypes := metadata.ResponseTypes
+	if len(grantTypes) == 0 {
+		grantTypes = []string{"authorization_code"}
+	}
+	if len(responseTypes) == 0 && containsString(grantTypes, "authorization_code") {
+		responseTypes = []string{"code"}
+	}
+
+	// 仅支持code响应类型，且必须与authorization_code授权类型同时出现
+	for _, rt := range responseTypes {
+		if rt != "code" {
+			return nil, invalid("不支持的response_type: " + rt)
+		}
+	}
+	if containsString(responseTypes, "code") != containsString(grantTypes, "authorization_code") {
+		return nil, invalid("response_types与grant_types不一致")
+	}
+
+	// 使用重定向的授权类型必须注册redirect_uris
+	if containsString(grantTypes, "authorization_code") && len(metadata.RedirectURIs) == 0 {
+		return nil, &RegistrationError{Code: RegistrationErrInvalidRedirectURI, Description: "缺少redirect_uris"}
+	}
+	for _, uri := range metadata.RedirectURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return nil, &RegistrationError{Code: RegistrationErrInvalidRedirectURI, Description: "无效的redirect_uri: " + uri}
+		}
+	}
+
+	for _, uri := range []string{metadata.ClientURI, metadata.LogoURI} {
+		if uri == "" {
+			continue
+		}
+		if parsed, err := url.Parse(uri); err != nil || !parsed.IsAbs() {
+			return nil, invalid("无效的URI: " + uri)
+		}
+	}
+
+	jwks := ""
+	if len(metadata.JWKS) > 0 && string(metadata.JWKS) != "null" {
+		jwks = string(metadata.JWKS)
+	}
+	if jwks != "" || metadata.JWKSURI != "" {
+		if err := validateClientJWKS(jwks, metadata.JWKSURI); err != nil {
+			return nil, invalid(err.Error())
+		}
+	}
+
+	clientName := metadata.ClientName
+	if clientName == "" {
+		clientName = "未命名客户端"
+	}
+
+	clientType := "confidential"
+	if metadata.TokenEndpointAuthMethod == ClientAuthNone {
+		clientType = "public"
+	}
+
+	reg := &ClientRegistration{
+		ClientName:                        clientName,
+		ClientURI:                         metadata.ClientURI,
+		LogoURI:                           metadata.LogoURI,
+		RedirectURIs:                      metadata.RedirectURIs,
+		RequestURIs:                       metadata.RequestURIs,
+		BackchannelLogoutURI:              metadata.BackchannelLogoutURI,
+		BackchannelLogoutSessionRequired:  metadata.BackchannelLogoutSessionRequired,
+		FrontchannelLogoutURI:             metadata.FrontchannelLogoutURI,
+		FrontchannelLogoutSessionRequired: metadata.FrontchannelLogoutSessionRequired,
+		ClientType:                        clientType,
+		TokenEndpointAuthMethod:           metadata.TokenEndpointAuthMethod,
+		GrantTypes:                        grantTypes,
+		JWKS:                              jwks,
+		JWKSURI:                           metadata.JWKSURI,
+		Scope:                             metadata.Scope,
+		RequirePAR:                        metadata.RequirePushedAuthorizationRequests,
+		RequireDPoP:                       metadata.DPoPBoundAccessTokens,
+		RequireMTLSBinding:                metadata.TLSClientCertificateBoundAccessTokens,
+		TLSClientAuth:                     metadata.TLSClientAuthIdentity,
+	}
+	if err := normalizeClientRegistration(reg); err != nil {
+		return nil, invalid(err.Error())
+	}
+
+	return reg, nil
+}
+
+// containsString 检查切片中是否包含指定字符串
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"astro-pass/internal/database"
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+)
+
+func TestVerifyClientSecret(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name    string
+		client  models.OAuth2Client
+		secret  string
+		wantErr bool
+	}{
+		{
+			name:   "当前密钥",
+			client: models.OAuth2Client{ClientSecretHash: utils.HashToken("current")},
+			secret: "current",
+		},
+		{
+			name:   "当前密钥未到过期时间",
+			client: models.OAuth2Client{ClientSecretHash: utils.HashToken("current"), ClientSecretExpiresAt: &future},
+			secret: "current",
+		},
+		{
+			name:    "当前密钥已过期",
+			client:  models.OAuth2Client{ClientSecretHash: utils.HashToken("current"), ClientSecretExpiresAt: &past},
+			secret:  "current",
+			wantErr: true,
+		},
+		{
+			name:    "密钥错误",
+			client:  models.OAuth2Client{ClientSecretHash: utils.HashToken("current")},
+			secret:  "wrong",
+			wantErr: true,
+		},
+		{
+			name:    "空密钥",
+			client:  models.OAuth2Client{ClientSecretHash: utils.HashToken("")},
+			secret:  "",
+			wantErr: true,
+		},
+		{
+			name:    "公共客户端没有密钥",
+			client:  models.OAuth2Client{},
+			secret:  "current",
+			wantErr: true,
+		},
+		{
+			name: "宽限期内的旧密钥",
+			client: models.OAuth2Client{
+				ClientSecretHash:        utils.HashToken("current"),
+				PreviousSecretHash:      utils.HashToken("previous"),
+				PreviousSecretExpiresAt: &future,
+			},
+			secret: "previous",
+		},
+		{
+			name: "宽限期结束的旧密钥",
+			client: models.OAuth2Client{
+				ClientSecretHash:        utils.HashToken("current"),
+				PreviousSecretHash:      utils.HashToken("previous"),
+				PreviousSecretExpiresAt: &past,
+			},
+			secret:  "previous",
+			wantErr: true,
+		},
+		{
+			name: "明文保存的密钥不能直接匹配",
+			client: models.OAuth2Client{
+				ClientSecretHash: "current",
+			},
+			secret:  "current",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyClientSecret(&tt.client, tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyClientSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMigratePlaintextClientSecrets(t *testing.T) {
+	setupTestDB(t, &models.OAuth2Client{})
+
+	plainSecret, _ := utils.GenerateRandomToken(32)
+	jwtSecret, _ := utils.GenerateRandomToken(32)
+	hashedSecret := utils.HashToken("already-hashed")
+
+	clients := []models.OAuth2Client{
+		{ClientID: "plain", ClientSecretHash: plainSecret, TokenEndpointAuthMethod: ClientAuthSecretBasic},
+		{ClientID: "secret-jwt", ClientSecretHash: jwtSecret, TokenEndpointAuthMethod: ClientAuthSecretJWT},
+		{ClientID: "hashed", ClientSecretHash: hashedSecret, TokenEndpointAuthMethod: ClientAuthSecretBasic},
+		{ClientID: "public", ClientSecretHash: "", TokenEndpointAuthMethod: ClientAuthNone},
+	}
+	for i := range clients {
+		clients[i].ClientName = clients[i].ClientID
+		clients[i].RedirectURIs = "[]"
+		clients[i].GrantTypes = "[]"
+		clients[i].ResponseTypes = "[]"
+		if err := database.DB.Create(&clients[i]).Error; err != nil {
+			t.Fatalf("创建客户端失败: %v", err)
+		}
+	}
+
+	service := NewOAuth2Service()
+	if err := service.MigratePlaintextClientSecrets(); err != nil {
+		t.Fatalf("MigratePlaintextClientSecrets() error = %v", err)
+	}
+	// 再次执行不应重复转换
+	if err := service.MigratePlaintextClientSecrets(); err != nil {
+		t.Fatalf("MigratePlaintextClientSecrets() 第二次执行 error = %v", err)
+	}
+
+	load := func(clientID string) *models.OAuth2Client {
+		var client models.OAuth2Client
+		if err := database.DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+			t.Fatalf("查询客户端%s失败: %v", clientID, err)
+		}
+		return &client
+	}
+
+	plain := load("plain")
+	if plain.ClientSecretHash != utils.HashToken(plainSecret) {
+		t.Errorf("明文密钥未转换为摘要: %s", plain.ClientSecretHash)
+	}
+	if plain.ClientSecretIssuedAt == nil {
+		t.Error("未记录密钥签发时间")
+	}
+	if plain.ClientSecretEncrypted != "" {
+		t.Error("client_secret_basic客户端不应保存密钥原文")
+	}
+	if err := verifyClientSecret(plain, plainSecret); err != nil {
+		t.Errorf("转换后原密钥应仍可认证: %v", err)
+	}
+
+	secretJWT := load("secret-jwt")
+	if secretJWT.ClientSecretHash != utils.HashToken(jwtSecret) {
+		t.Errorf("明文密钥未转换为摘要: %s", secretJWT.ClientSecretHash)
+	}
+	decrypted, err := utils.DecryptToken(secretJWT.ClientSecretEncrypted)
+	if err != nil || decrypted != jwtSecret {
+		t.Errorf("client_secret_jwt客户端应加密保存密钥原文, got %q, err %v", decrypted, err)
+	}
+
+	if hashed := load("hashed"); hashed.ClientSecretHash != hashedSecret {
+		t.Errorf("已是摘要的密钥不应再次转换: %s", hashed.ClientSecretHash)
+	}
+	if public := load("public"); public.ClientSecretHash != "" {
+		t.Errorf("公共客户端不应生成密钥: %s", public.ClientSecretHash)
+	}
+}
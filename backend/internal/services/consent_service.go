@@ -3,7 +3,9 @@ package services
 import (
 	"astro-pass/internal/database"
 	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
 	"errors"
+	"strings"
 	"time"
 )
 
@@ -13,8 +15,8 @@ func NewConsentService() *ConsentService {
 	return &ConsentService{}
 }
 
-// CheckConsent 检查用户是否已授权
-func (s *ConsentService) CheckConsent(userID uint, clientID, scope string) (bool, error) {
+// CheckConsent 检查用户是否已授权，claims 为通过claims请求参数请求的声明名称
+func (s *ConsentService) CheckConsent(userID uint, clientID, scope string, claims []string) (bool, error) {
 	var consent models.UserConsent
 	err := database.DB.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error
 	
@@ -32,11 +34,16 @@ func (s *ConsentService) CheckConsent(userID uint, clientID, scope string) (bool
 		return false, nil
 	}
 
+	// 通过claims请求参数请求的声明必须已获用户同意
+	if !isScopeSubset(strings.Join(claims, " "), consent.Claims) {
+		return false, nil
+	}
+
 	return true, nil
 }
 
-// SaveConsent 保存用户授权
-func (s *ConsentService) SaveConsent(userID uint, clientID, scope string) error {
+// SaveConsent 保存用户授权，claims 为用户同意释放的通过claims请求参数请求的声明名称
+func (s *ConsentService) SaveConsent(userID uint, clientID, scope string, claims []string) error {
 	// 检查是否已存在
 	var consent models.UserConsent
 	err := database.DB.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error
@@ -44,6 +51,7 @@ func (s *ConsentService) SaveConsent(userID uint, clientID, scope string) error
 	if err == nil {
 		// 更新现有授权
 		consent.Scope = scope
+		consent.Claims = strings.Join(claims, " ")
 		consent.ExpiresAt = time.Now().Add(365 * 24 * time.Hour) // 1年有效期
 		return database.DB.Save(&consent).Error
 	}
@@ -53,12 +61,63 @@ func (s *ConsentService) SaveConsent(userID uint, clientID, scope string) error
 		UserID:    userID,
 		ClientID:  clientID,
 		Scope:     scope,
+		Claims:    strings.Join(claims, " "),
 		ExpiresAt: time.Now().Add(365 * 24 * time.Hour),
 	}
 
 	return database.DB.Create(&consent).Error
 }
 
+// consentApprovalLifetime 同意页面批准凭据的有效期，凭据只能在返回授权端点时使用一次
+const consentApprovalLifetime = 5 * time.Minute
+
+// CreateApproval 记录用户在同意页面对一次授权请求的批准，返回交给授权端点的一次性凭据
+func (s *ConsentService) CreateApproval(userID uint, clientID, redirectURI, scope string, claims []string) (string, error) {
+	ticket, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", errors.New("生成批准凭据失败")
+	}
+
+	approval := &models.ConsentApproval{
+		TicketHash:  utils.HashToken(ticket),
+		UserID:      userID,
+		ClientID:    clientID,
+		RedirectURI: redirectURI,
+		Scope:       scope,
+		Claims:      strings.Join(claims, " "),
+		ExpiresAt:   time.Now().Add(consentApprovalLifetime),
+	}
+	if err := database.DB.Create(approval).Error; err != nil {
+		return "", errors.New("保存批准凭据失败")
+	}
+	return ticket, nil
+}
+
+// ConsumeApproval 校验并消费批准凭据：必须由同一用户为同一客户端和重定向URI签发，且覆盖请求的scope和声明
+func (s *ConsentService) ConsumeApproval(ticket string, userID uint, clientID, redirectURI, scope string, claims []string) bool {
+	if ticket == "" {
+		return false
+	}
+
+	var approval models.ConsentApproval
+	if err := database.DB.Where("ticket_hash = ? AND used = ?", utils.HashToken(ticket), false).First(&approval).Error; err != nil {
+		return false
+	}
+	if approval.UserID != userID || approval.ClientID != clientID || approval.RedirectURI != redirectURI ||
+		time.Now().After(approval.ExpiresAt) {
+		return false
+	}
+	if !isScopeSubset(scope, approval.Scope) || !isScopeSubset(strings.Join(claims, " "), approval.Claims) {
+		return false
+	}
+
+	// 条件更新保证凭据只能使用一次
+	result := database.DB.Model(&models.ConsentApproval{}).
+		Where("id = ? AND used = ?", approval.ID, false).
+		Update("used", true)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
 // RevokeConsent 撤销用户授权
 func (s *ConsentService) RevokeConsent(userID uint, clientID string) error {
 	result := database.DB.Where("user_id = ? AND client_id = ?", userID, clientID).Delete(&models.UserConsent{})
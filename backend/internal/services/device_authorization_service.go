@@ -0,0 +1,327 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"astro-pass/internal/config"
+	"astro-pass/internal/database"
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+)
+
+// GrantTypeDeviceCode 设备授权模式的grant_type（RFC 8628）
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// 设备授权轮询错误，对应RFC 8628 3.5节定义的错误码
+var (
+	ErrAuthorizationPending = errors.New("authorization_pending")
+	ErrSlowDown             = errors.New("slow_down")
+	ErrAccessDenied         = errors.New("access_denied")
+	ErrExpiredToken         = errors.New("expired_token")
+)
+
+// userCodeCharset 用户码字符集：去除元音和易混淆字符的20个辅音字母（RFC 8628 6.1节建议）
+const userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+// userCodeLength 用户码长度（不含分隔符）
+const userCodeLength = 8
+
+// slowDownIncrement 收到slow_down后轮询间隔的增量（秒）
+const slowDownIncrement = 5
+
+type DeviceAuthorizationService struct {
+	oauth2Service *OAuth2Service
+}
+
+func NewDeviceAuthorizationService() *DeviceAuthorizationService {
+	return &DeviceAuthorizationService{
+		oauth2Service: NewOAuth2Service(),
+	}
+}
+
+// DeviceAuthorizationResponse 设备授权响应
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceAuthorizationInfo 用户码对应的待确认授权信息
+type DeviceAuthorizationInfo struct {
+	UserCode   string    `json:"user_code"`
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	ClientURI  string    `json:"client_uri"`
+	LogoURI    string    `json:"logo_uri"`
+	Scope      string    `json:"scope"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// RequestDeviceAuthorization 处理设备授权请求，签发设备码和用户码
+func (s *DeviceAuthorizationService) RequestDeviceAuthorization(clientAuth *ClientAuthentication, scope string) (*DeviceAuthorizationResponse, error) {
+	// 验证客户端
+	client, err := s.oauth2Service.AuthenticateClient(clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckClientGrantType(client, GrantTypeDeviceCode); err != nil {
+		return nil, err
+	}
+
+	scope, err = ResolveClientScope(client, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// 生成设备码
+	deviceCodeBytes := make([]byte, 32)
+	if _, err := rand.Read(deviceCodeBytes); err != nil {
+		return nil, &ServerError{Description: "生成设备码失败"}
+	}
+	deviceCodeString := base64.RawURLEncoding.EncodeToString(deviceCodeBytes)
+
+	// 生成用户码，与未过期的用户码冲突时重试
+	var userCode string
+	for i := 0; i < 5; i++ {
+		candidate, err := generateUserCode()
+		if err != nil {
+			return nil, &ServerError{Description: "生成用户码失败"}
+		}
+		var count int64
+		database.DB.Model(&models.DeviceCode{}).Where("user_code = ?", candidate).Count(&count)
+		if count == 0 {
+			userCode = candidate
+			break
+		}
+	}
+	if userCode == "" {
+		return nil, &ServerError{Description: "生成用户码失败"}
+	}
+
+	interval := int(config.Cfg.OAuth2.DeviceCodeInterval.Seconds())
+	if interval < 1 {
+		interval = 1
+	}
+
+	deviceCode := &models.DeviceCode{
+		DeviceCode:     deviceCodeString,
+		UserCode:       userCode,
+		OAuth2ClientID: client.ID,
+		ClientID:       client.ClientID,
+		Scope:          scope,
+		Status:         "pending",
+		Interval:       interval,
+		ExpiresAt:      time.Now().Add(config.Cfg.OAuth2.DeviceCodeExpire),
+	}
+	if err := database.DB.Create(deviceCode).Error; err != nil {
+		return nil, &ServerError{Description: "保存设备码失败"}
+	}
+
+	verificationURI := strings.TrimRight(config.Cfg.App.FrontendURL, "/") + "/oauth2/device"
+
+	return &DeviceAuthorizationResponse{
+		DeviceCode:              deviceCodeString,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + formatUserCode(userCode),
+		ExpiresIn:               int(config.Cfg.OAuth2.DeviceCodeExpire.Seconds()),
+		Interval:                interval,
+	}, nil
+}
+
+// GetPendingAuthorization 根据用户码获取待确认的设备授权
+func (s *DeviceAuthorizationService) GetPendingAuthorization(userCode string) (*DeviceAuthorizationInfo, error) {
+	deviceCode, err := s.findPendingByUserCode(userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	var client models.OAuth2Client
+	if err := database.DB.First(&client, deviceCode.OAuth2ClientID).Error; err != nil {
+		return nil, errors.New("无效的客户端")
+	}
+
+	return &DeviceAuthorizationInfo{
+		UserCode:   formatUserCode(deviceCode.UserCode),
+		ClientID:   client.ClientID,
+		ClientName: client.ClientName,
+		ClientURI:  client.ClientURI,
+		LogoURI:    client.LogoURI,
+		Scope:      deviceCode.Scope,
+		ExpiresAt:  deviceCode.ExpiresAt,
+	}, nil
+}
+
+// ApproveDeviceAuthorization 用户批准或拒绝设备授权
+func (s *DeviceAuthorizationService) ApproveDeviceAuthorization(userCode string, userID uint, approved bool, auth *utils.AuthContext) error {
+	deviceCode, err := s.findPendingByUserCode(userCode)
+	if err != nil {
+		return err
+	}
+
+	deviceCode.UserID = &userID
+	if !approved {
+		deviceCode.Status = "denied"
+	} else {
+		deviceCode.Status = "approved"
+		if auth != nil {
+			authTime := auth.AuthTime
+			deviceCode.AuthTime = &authTime
+			deviceCode.AuthMethods = strings.Join(auth.AMR, " ")
+			deviceCode.SessionID = auth.SessionID
+		}
+	}
+
+	// 仅在状态仍为pending时更新，防止并发重复确认
+	result := database.DB.Model(&models.DeviceCode{}).
+		Where("id = ? AND status = ?", deviceCode.ID, "pending").
+		Updates(map[string]interface{}{
+			"user_id":      deviceCode.UserID,
+			"status":       deviceCode.Status,
+			"auth_time":    deviceCode.AuthTime,
+			"auth_methods": deviceCode.AuthMethods,
+			"session_id":   deviceCode.SessionID,
+		})
+	if result.Error != nil {
+		return errors.New("更新设备授权失败")
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("用户码无效或已使用")
+	}
+
+	if approved {
+		// 记录用户授权同意，与授权码模式保持一致
+		if err := NewConsentService().SaveConsent(userID, deviceCode.ClientID, deviceCode.Scope, nil); err != nil {
+			utils.Warn("保存设备授权同意记录失败: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// DeviceCodeGrant 设备授权模式的令牌请求（RFC 8628 3.4节），resources 为令牌请求中的资源指示（RFC 8707）
+func (s *DeviceAuthorizationService) DeviceCodeGrant(clientAuth *ClientAuthentication, deviceCodeString string, resources []string) (*TokenResponse, error) {
+	// 验证客户端
+	client, err := s.oauth2Service.AuthenticateClient(clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckClientGrantType(client, GrantTypeDeviceCode); err != nil {
+		return nil, err
+	}
+
+	cnf, err := tokenConfirmation(client, clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	var deviceCode models.DeviceCode
+	if err := database.DB.Where("device_code = ?", deviceCodeString).First(&deviceCode).Error; err != nil {
+		return nil, errors.New("无效的设备码")
+	}
+
+	// 设备码必须由申请它的客户端使用
+	if deviceCode.ClientID != client.ClientID {
+		return nil, errors.New("设备码与客户端不匹配")
+	}
+
+	if time.Now().After(deviceCode.ExpiresAt) {
+		return nil, ErrExpiredToken
+	}
+
+	switch deviceCode.Status {
+	case "pending":
+		// 轮询过快时增大间隔并返回slow_down
+		now := time.Now()
+		tooFast := deviceCode.LastPolledAt != nil &&
+			now.Sub(*deviceCode.LastPolledAt) < time.Duration(deviceCode.Interval)*time.Second
+		updates := map[string]interface{}{"last_polled_at": now}
+		if tooFast {
+			updates["interval"] = deviceCode.Interval + slowDownIncrement
+		}
+		database.DB.Model(&deviceCode).Updates(updates)
+		if tooFast {
+			return nil, ErrSlowDown
+		}
+		return nil, ErrAuthorizationPending
+	case "denied":
+		return nil, ErrAccessDenied
+	case "approved":
+		// 继续签发令牌
+	default:
+		return nil, errors.New("设备码已使用")
+	}
+
+	// 标记设备码为已使用，仅允许成功兑换一次
+	result := database.DB.Model(&models.DeviceCode{}).
+		Where("id = ? AND status = ?", deviceCode.ID, "approved").
+		Update("status", "consumed")
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, errors.New("设备码已使用")
+	}
+
+	// 获取用户信息
+	var user models.User
+	if deviceCode.UserID == nil || database.DB.First(&user, *deviceCode.UserID).Error != nil {
+		return nil, errors.New("用户不存在")
+	}
+
+	withRefreshToken := clientSupportsGrantType(client, "refresh_token")
+	return s.oauth2Service.issueUserTokens(client, clientAuth.Issuer, &user, deviceCode.Scope, "", "",
+		authContextOf(deviceCode.AuthTime, deviceCode.AuthMethods, deviceCode.SessionID), withRefreshToken, cnf, resources, nil)
+}
+
+// findPendingByUserCode 根据用户码查找未过期且待确认的设备授权
+func (s *DeviceAuthorizationService) findPendingByUserCode(userCode string) (*models.DeviceCode, error) {
+	var deviceCode models.DeviceCode
+	if err := database.DB.Where("user_code = ? AND status = ?", normalizeUserCode(userCode), "pending").
+		First(&deviceCode).Error; err != nil {
+		return nil, errors.New("用户码无效或已使用")
+	}
+
+	if time.Now().After(deviceCode.ExpiresAt) {
+		return nil, errors.New("用户码已过期")
+	}
+
+	return &deviceCode, nil
+}
+
+// generateUserCode 生成随机用户码
+func generateUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeCharset)))
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeCharset[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// formatUserCode 将用户码格式化为 XXXX-XXXX 便于输入
+func formatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+	return userCode[:4] + "-" + userCode[4:]
+}
+
+// normalizeUserCode 规范化用户输入的用户码：忽略大小写、连字符和空格
+func normalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(userCode)
+	userCode = strings.ReplaceAll(userCode, "-", "")
+	userCode = strings.ReplaceAll(userCode, " ", "")
+	return userCode
+}
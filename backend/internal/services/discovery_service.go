@@ -0,0 +1,168 @@
+package services
+
+import (
+	"sort"
+
+	"astro-pass/internal/utils"
+)
+
+// AuthorizationServerMetadata 授权服务器元数据（RFC 8414 2节）
+// OpenID Provider元数据（OIDC Discovery 3节）在此基础上增加用户信息端点、ID Token和声明相关字段
+type AuthorizationServerMetadata struct {
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	JWKSURI                                    string   `json:"jwks_uri"`
+	RegistrationEndpoint                       string   `json:"registration_endpoint"`
+	RevocationEndpoint                         string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint                      string   `json:"introspection_endpoint"`
+	DeviceAuthorizationEndpoint                string   `json:"device_authorization_endpoint"`
+	PushedAuthorizationRequestEndpoint         string   `json:"pushed_authorization_request_endpoint"`
+	RequirePushedAuthorizationRequests         bool     `json:"require_pushed_authorization_requests"`
+	ScopesSupported                            []string `json:"scopes_supported"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	ResponseModesSupported                     []string `json:"response_modes_supported"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	RevocationEndpointAuthMethodsSupported     []string `json:"revocation_endpoint_auth_methods_supported"`
+	IntrospectionEndpointAuthMethodsSupported  []string `json:"introspection_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported"`
+	RequestParameterSupported                  bool     `json:"request_parameter_supported"`
+	RequestURIParameterSupported               bool     `json:"request_uri_parameter_supported"`
+	RequireRequestURIRegistration              bool     `json:"require_request_uri_registration"`
+	RequestObjectSigningAlgValuesSupported     []string `json:"request_object_signing_alg_values_supported"`
+	AuthorizationSigningAlgValuesSupported     []string `json:"authorization_signing_alg_values_supported"`
+	AccessTokenSigningAlgValuesSupported       []string `json:"access_token_signing_alg_values_supported"`
+	DPoPSigningAlgValuesSupported              []string `json:"dpop_signing_alg_values_supported"`
+	TLSClientCertificateBoundAccessTokens      bool     `json:"tls_client_certificate_bound_access_tokens"`
+
+	// OpenID Provider元数据
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint,omitempty"`
+	SubjectTypesSupported            []string `json:"subject_types_supported,omitempty"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported,omitempty"`
+	ClaimsSupported                  []string `json:"claims_supported,omitempty"`
+	ClaimsParameterSupported         bool     `json:"claims_parameter_supported,omitempty"`
+	ACRValuesSupported               []string `json:"acr_values_supported,omitempty"`
+	EndSessionEndpoint               string   `json:"end_session_endpoint,omitempty"`
+
+	CheckSessionIframe string `json:"check_session_iframe,omitempty"`
+
+	// OIDC Back-Channel Logout 2.1节、Front-Channel Logout 3节
+	BackchannelLogoutSupported         bool `json:"backchannel_logout_supported,omitempty"`
+	BackchannelLogoutSessionSupported  bool `json:"backchannel_logout_session_supported,omitempty"`
+	FrontchannelLogoutSupported        bool `json:"frontchannel_logout_supported,omitempty"`
+	FrontchannelLogoutSessionSupported bool `json:"frontchannel_logout_session_supported,omitempty"`
+}
+
+// idTokenProtocolClaims ID Token中由协议本身产生的声明
+var idTokenProtocolClaims = []string{"iss", "aud", "exp", "iat", "nonce", "auth_time", "amr", "acr", "sid"}
+
+// DiscoveryService 根据当前启用的能力生成授权服务器元数据，避免手工维护的文档与实际行为不一致
+type DiscoveryService struct {
+	scopeService *ScopeService
+}
+
+func NewDiscoveryService() *DiscoveryService {
+	return &DiscoveryService{
+		scopeService: NewScopeService(),
+	}
+}
+
+// Metadata 生成签发者的元数据，openid为true时包含OpenID Provider元数据
+// 端点地址以签发者标识为前缀，按签发者路径注册的协议端点与之对应
+func (s *DiscoveryService) Metadata(issuer string, openid bool) (*AuthorizationServerMetadata, error) {
+	scopes, err := s.scopeService.ListScopes()
+	if err != nil {
+		return nil, err
+	}
+	scopeNames := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scopeNames = append(scopeNames, scope.Name)
+	}
+
+	grantTypes := make([]string, 0, len(supportedGrantTypes))
+	for grantType := range supportedGrantTypes {
+		grantTypes = append(grantTypes, grantType)
+	}
+	sort.Strings(grantTypes)
+
+	// 无法获得客户端证书时，双向TLS客户端认证和证书绑定令牌不可用
+	mtlsAvailable := MTLSAvailable()
+	authMethods := make([]string, 0, len(supportedClientAuthMethods))
+	for _, method := range supportedClientAuthMethods {
+		if (method == ClientAuthTLS || method == ClientAuthSelfSigned) && !mtlsAvailable {
+			continue
+		}
+		authMethods = append(authMethods, method)
+	}
+	// 公共客户端不能调用内省端点
+	introspectionAuthMethods := make([]string, 0, len(authMethods))
+	for _, method := range authMethods {
+		if method != ClientAuthNone {
+			introspectionAuthMethods = append(introspectionAuthMethods, method)
+		}
+	}
+
+	clientSigningAlgs := append(append([]string{}, clientKeySigningAlgs...), clientSecretSigningAlgs...)
+	signingAlgs := utils.PublishedSigningAlgorithms()
+
+	metadata := &AuthorizationServerMetadata{
+		Issuer:                                     issuer,
+		AuthorizationEndpoint:                      issuer + "/api/oauth2/authorize",
+		TokenEndpoint:                              issuer + "/api/oauth2/token",
+		JWKSURI:                                    issuer + "/api/oauth2/jwks",
+		RegistrationEndpoint:                       issuer + "/api/oauth2/register",
+		RevocationEndpoint:                         issuer + "/api/oauth2/revoke",
+		IntrospectionEndpoint:                      issuer + "/api/oauth2/introspect",
+		DeviceAuthorizationEndpoint:                issuer + "/api/oauth2/device_authorization",
+		PushedAuthorizationRequestEndpoint:         issuer + "/api/oauth2/par",
+		RequirePushedAuthorizationRequests:         false,
+		ScopesSupported:                            scopeNames,
+		ResponseTypesSupported:                     []string{"code"},
+		ResponseModesSupported:                     supportedResponseModes,
+		GrantTypesSupported:                        grantTypes,
+		TokenEndpointAuthMethodsSupported:          authMethods,
+		TokenEndpointAuthSigningAlgValuesSupported: clientSigningAlgs,
+		RevocationEndpointAuthMethodsSupported:     authMethods,
+		IntrospectionEndpointAuthMethodsSupported:  introspectionAuthMethods,
+		CodeChallengeMethodsSupported:              utils.PKCEMethods,
+		RequestParameterSupported:                  true,
+		RequestURIParameterSupported:               true,
+		RequireRequestURIRegistration:              true,
+		RequestObjectSigningAlgValuesSupported:     clientSigningAlgs,
+		AuthorizationSigningAlgValuesSupported:     signingAlgs,
+		AccessTokenSigningAlgValuesSupported:       signingAlgs,
+		DPoPSigningAlgValuesSupported:              utils.DPoPSigningAlgs,
+		TLSClientCertificateBoundAccessTokens:      mtlsAvailable,
+	}
+
+	if openid {
+		claimSet := map[string]bool{}
+		for _, claim := range append(s.scopeService.SupportedClaims(), idTokenProtocolClaims...) {
+			claimSet[claim] = true
+		}
+		claimSet["sub"] = true
+		claims := make([]string, 0, len(claimSet))
+		for claim := range claimSet {
+			claims = append(claims, claim)
+		}
+		sort.Strings(claims)
+
+		metadata.UserinfoEndpoint = issuer + "/api/oauth2/userinfo"
+		metadata.SubjectTypesSupported = []string{"public"}
+		metadata.IDTokenSigningAlgValuesSupported = signingAlgs
+		metadata.ClaimsSupported = claims
+		metadata.ClaimsParameterSupported = true
+		metadata.ACRValuesSupported = []string{utils.ACRSingleFactor, utils.ACRMultiFactor}
+		// 登出和会话检查端点只注册在主签发者下，id_token_hint可由任一签发者签发
+		metadata.EndSessionEndpoint = utils.PrimaryIssuer() + "/api/oidc/logout"
+		metadata.CheckSessionIframe = utils.PrimaryIssuer() + "/api/oidc/check_session"
+		metadata.BackchannelLogoutSupported = true
+		metadata.BackchannelLogoutSessionSupported = true
+		metadata.FrontchannelLogoutSupported = true
+		metadata.FrontchannelLogoutSessionSupported = true
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"astro-pass/internal/config"
+	"astro-pass/internal/database"
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+)
+
+// dpopReplayWindowSkew jti记录在证明有效期之外额外保留的时间，覆盖时钟偏差
+const dpopReplayWindowSkew = time.Minute
+
+type DPoPService struct{}
+
+func NewDPoPService() *DPoPService {
+	return &DPoPService{}
+}
+
+// DPoPRequestURI 计算请求的htu：服务对外地址加请求路径
+// 其他签发者（OAUTH2_ISSUERS）的请求路径已包含签发者路径，使用签发者的源加请求路径
+func DPoPRequestURI(issuer, path string) string {
+	if issuer == "" || issuer == utils.PrimaryIssuer() {
+		return utils.PrimaryIssuer() + path
+	}
+	return utils.IssuerOrigin(issuer) + path
+}
+
+// ValidateProof 验证DPoP证明（RFC 9449 4.3节），检查nonce并记录jti防止重放，返回证明公钥的指纹
+// accessToken 不为空时校验证明中的ath
+func (s *DPoPService) ValidateProof(proof, method, htu, accessToken string) (string, error) {
+	if proof == "" {
+		return "", &utils.DPoPError{Code: utils.DPoPErrorInvalidProof, Description: "缺少DPoP证明"}
+	}
+	if strings.Contains(proof, ",") {
+		// 请求只能携带一个DPoP头
+		return "", &utils.DPoPError{Code: utils.DPoPErrorInvalidProof, Description: "只能提供一个DPoP证明"}
+	}
+
+	maxAge := config.Cfg.OAuth2.DPoPProofMaxAge
+	parsed, err := utils.ParseDPoPProof(proof, method, htu, accessToken, maxAge)
+	if err != nil {
+		return "", &utils.DPoPError{Code: utils.DPoPErrorInvalidProof, Description: err.Error()}
+	}
+
+	if config.Cfg.OAuth2.DPoPNonceRequired && !utils.ValidateDPoPNonce(parsed.Nonce, config.Cfg.OAuth2.DPoPNonceLifetime) {
+		return "", &utils.DPoPError{Code: utils.DPoPErrorUseNonce, Description: "DPoP证明需要携带服务端提供的nonce"}
+	}
+
+	// 同一密钥的jti在证明有效期内只能使用一次
+	record := &models.DPoPProofJTI{
+		JKT:       parsed.JKT,
+		JTI:       parsed.JTI,
+		ExpiresAt: parsed.IssuedAt.Add(maxAge + dpopReplayWindowSkew),
+	}
+	if err := database.DB.Create(record).Error; err != nil {
+		return "", &utils.DPoPError{Code: utils.DPoPErrorInvalidProof, Description: "DPoP证明已被使用"}
+	}
+
+	return parsed.JKT, nil
+}
+
+// VerifyBoundToken 校验访问受保护资源时访问令牌与DPoP证明的绑定（RFC 9449 7节）
+// 绑定了DPoP密钥的令牌必须使用DPoP认证方案并附带匹配的证明；未绑定的令牌不能使用DPoP方案
+func (s *DPoPService) VerifyBoundToken(scheme, accessToken, proof, method, htu string, cnf *utils.ConfirmationClaim) error {
+	if cnf == nil || cnf.JKT == "" {
+		if strings.EqualFold(scheme, "DPoP") {
+			return &utils.DPoPError{Code: utils.DPoPErrorInvalidToken, Description: "访问令牌未绑定DPoP密钥"}
+		}
+		return nil
+	}
+
+	if !strings.EqualFold(scheme, "DPoP") {
+		return &utils.DPoPError{Code: utils.DPoPErrorInvalidToken, Description: "DPoP绑定的访问令牌必须使用DPoP认证方案"}
+	}
+
+	jkt, err := s.ValidateProof(proof, method, htu, accessToken)
+	if err != nil {
+		return err
+	}
+	if jkt != cnf.JKT {
+		return &utils.DPoPError{Code: utils.DPoPErrorInvalidToken, Description: "DPoP证明与令牌绑定的密钥不匹配"}
+	}
+
+	return nil
+}
+
+// CleanupExpiredProofs 清理已过期的DPoP证明jti记录
+func (s *DPoPService) CleanupExpiredProofs() error {
+	return database.DB.Where("expires_at < ?", time.Now()).Delete(&models.DPoPProofJTI{}).Error
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"astro-pass/internal/config"
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testDPoPHTU = "https://auth.example.com/api/user/profile"
+
+// dpopTestKey DPoP证明使用的密钥及其公钥指纹
+type dpopTestKey struct {
+	signer crypto.Signer
+	jwk    map[string]interface{}
+	jkt    string
+}
+
+func newDPoPTestKey(t *testing.T) *dpopTestKey {
+	t.Helper()
+	signer, err := utils.GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatalf("生成DPoP密钥失败: %v", err)
+	}
+	jwk, err := utils.NewPublicJWK(signer.Public())
+	if err != nil {
+		t.Fatalf("生成JWK失败: %v", err)
+	}
+	jkt, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatalf("计算JWK指纹失败: %v", err)
+	}
+	data, _ := json.Marshal(jwk)
+	header := map[string]interface{}{}
+	_ = json.Unmarshal(data, &header)
+	return &dpopTestKey{signer: signer, jwk: header, jkt: jkt}
+}
+
+// proof 为访问令牌签名DPoP证明，携带服务端签发的nonce
+func (k *dpopTestKey) proof(t *testing.T, method, htu, accessToken string) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"jti":   utils.GenerateUUID(),
+		"htm":   method,
+		"htu":   htu,
+		"iat":   time.Now().Unix(),
+		"nonce": utils.GenerateDPoPNonce(),
+	}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = utils.DPoPProofType
+	token.Header["jwk"] = k.jwk
+	proof, err := token.SignedString(k.signer)
+	if err != nil {
+		t.Fatalf("签名DPoP证明失败: %v", err)
+	}
+	return proof
+}
+
+// dpopErrorCode DPoP错误的错误码，非DPoP错误返回空字符串
+func dpopErrorCode(err error) string {
+	var dpopErr *utils.DPoPError
+	if errors.As(err, &dpopErr) {
+		return dpopErr.Code
+	}
+	return ""
+}
+
+func TestDPoPValidateProofReplay(t *testing.T) {
+	setupTestDB(t, &models.DPoPProofJTI{})
+	key := newDPoPTestKey(t)
+	service := NewDPoPService()
+
+	proof := key.proof(t, "GET", testDPoPHTU, "")
+	jkt, err := service.ValidateProof(proof, "GET", testDPoPHTU, "")
+	if err != nil {
+		t.Fatalf("ValidateProof() error = %v", err)
+	}
+	if jkt != key.jkt {
+		t.Errorf("ValidateProof() jkt = %s, want %s", jkt, key.jkt)
+	}
+
+	// 同一证明（jti）不能再次使用
+	if _, err := service.ValidateProof(proof, "GET", testDPoPHTU, ""); dpopErrorCode(err) != utils.DPoPErrorInvalidProof {
+		t.Errorf("重放DPoP证明应返回invalid_dpop_proof, got %v", err)
+	}
+
+	// 新证明可以正常使用
+	if _, err := service.ValidateProof(key.proof(t, "GET", testDPoPHTU, ""), "GET", testDPoPHTU, ""); err != nil {
+		t.Errorf("新的DPoP证明 error = %v", err)
+	}
+}
+
+func TestDPoPValidateProofRejectsInvalidProof(t *testing.T) {
+	setupTestDB(t, &models.DPoPProofJTI{})
+	key := newDPoPTestKey(t)
+	service := NewDPoPService()
+
+	tests := []struct {
+		name     string
+		proof    string
+		method   string
+		htu      string
+		wantCode string
+	}{
+		{"缺少证明", "", "GET", testDPoPHTU, utils.DPoPErrorInvalidProof},
+		{"多个证明", key.proof(t, "GET", testDPoPHTU, "") + "," + key.proof(t, "GET", testDPoPHTU, ""), "GET", testDPoPHTU, utils.DPoPErrorInvalidProof},
+		{"htm不匹配", key.proof(t, "POST", testDPoPHTU, ""), "GET", testDPoPHTU, utils.DPoPErrorInvalidProof},
+		{"htu不匹配", key.proof(t, "GET", "https://auth.example.com/api/admin/users", ""), "GET", testDPoPHTU, utils.DPoPErrorInvalidProof},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.ValidateProof(tt.proof, tt.method, tt.htu, ""); dpopErrorCode(err) != tt.wantCode {
+				t.Errorf("ValidateProof() error = %v, want code %s", err, tt.wantCode)
+			}
+		})
+	}
+
+	// 要求nonce时，未携带服务端nonce的证明要求客户端重试
+	nonceRequired := config.Cfg.OAuth2.DPoPNonceRequired
+	config.Cfg.OAuth2.DPoPNonceRequired = true
+	t.Cleanup(func() { config.Cfg.OAuth2.DPoPNonceRequired = nonceRequired })
+	claims := jwt.MapClaims{"jti": utils.GenerateUUID(), "htm": "GET", "htu": testDPoPHTU, "iat": time.Now().Unix()}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = utils.DPoPProofType
+	token.Header["jwk"] = key.jwk
+	withoutNonce, _ := token.SignedString(key.signer)
+	if _, err := service.ValidateProof(withoutNonce, "GET", testDPoPHTU, ""); dpopErrorCode(err) != utils.DPoPErrorUseNonce {
+		t.Errorf("缺少nonce应返回use_dpop_nonce, got %v", err)
+	}
+}
+
+func TestDPoPVerifyBoundToken(t *testing.T) {
+	setupTestDB(t, &models.DPoPProofJTI{})
+	key := newDPoPTestKey(t)
+	otherKey := newDPoPTestKey(t)
+	service := NewDPoPService()
+
+	const accessToken = "bound-access-token"
+	bound := &utils.ConfirmationClaim{JKT: key.jkt}
+
+	tests := []struct {
+		name     string
+		scheme   string
+		proof    string
+		cnf      *utils.ConfirmationClaim
+		wantCode string
+	}{
+		{"绑定令牌使用匹配的证明", "DPoP", key.proof(t, "GET", testDPoPHTU, accessToken), bound, ""},
+		{"其他密钥的证明", "DPoP", otherKey.proof(t, "GET", testDPoPHTU, accessToken), bound, utils.DPoPErrorInvalidToken},
+		{"ath对应其他令牌", "DPoP", key.proof(t, "GET", testDPoPHTU, "other-access-token"), bound, utils.DPoPErrorInvalidProof},
+		{"绑定令牌缺少证明", "DPoP", "", bound, utils.DPoPErrorInvalidProof},
+		{"绑定令牌使用Bearer方案", "Bearer", key.proof(t, "GET", testDPoPHTU, accessToken), bound, utils.DPoPErrorInvalidToken},
+		{"未绑定令牌使用DPoP方案", "DPoP", key.proof(t, "GET", testDPoPHTU, accessToken), nil, utils.DPoPErrorInvalidToken},
+		{"未绑定令牌使用Bearer方案", "Bearer", "", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.VerifyBoundToken(tt.scheme, accessToken, tt.proof, "GET", testDPoPHTU, tt.cnf)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Errorf("VerifyBoundToken() error = %v", err)
+				}
+				return
+			}
+			if dpopErrorCode(err) != tt.wantCode {
+				t.Errorf("VerifyBoundToken() error = %v, want code %s", err, tt.wantCode)
+			}
+		})
+	}
+}
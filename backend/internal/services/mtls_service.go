@@ -0,0 +1,251 @@
+package services
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"astro-pass/internal/config"
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+)
+
+// TLSClientAuthIdentity tls_client_auth 客户端注册的证书身份（RFC 8705 2.1.2节），只能设置其中一项
+type TLSClientAuthIdentity struct {
+	SubjectDN string `json:"tls_client_auth_subject_dn,omitempty"`
+	SANDNS    string `json:"tls_client_auth_san_dns,omitempty"`
+	SANURI    string `json:"tls_client_auth_san_uri,omitempty"`
+	SANIP     string `json:"tls_client_auth_san_ip,omitempty"`
+	SANEmail  string `json:"tls_client_auth_san_email,omitempty"`
+}
+
+// count 已设置的身份字段数量
+func (id *TLSClientAuthIdentity) count() int {
+	n := 0
+	for _, v := range []string{id.SubjectDN, id.SANDNS, id.SANURI, id.SANIP, id.SANEmail} {
+		if v != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// ClientTLSIdentity 获取客户端注册的证书身份
+func ClientTLSIdentity(client *models.OAuth2Client) TLSClientAuthIdentity {
+	return TLSClientAuthIdentity{
+		SubjectDN: client.TLSClientAuthSubjectDN,
+		SANDNS:    client.TLSClientAuthSANDNS,
+		SANURI:    client.TLSClientAuthSANURI,
+		SANIP:     client.TLSClientAuthSANIP,
+		SANEmail:  client.TLSClientAuthSANEmail,
+	}
+}
+
+// validateTLSClientAuthIdentity 校验tls_client_auth的证书身份元数据
+func validateTLSClientAuthIdentity(id *TLSClientAuthIdentity) error {
+	if id.count() != 1 {
+		return errors.New("tls_client_auth需要且只能提供一项证书身份（subject_dn或某一SAN）")
+	}
+	if id.SANIP != "" && net.ParseIP(id.SANIP) == nil {
+		return errors.New("tls_client_auth_san_ip格式错误")
+	}
+	if id.SANURI != "" {
+		if parsed, err := url.Parse(id.SANURI); err != nil || !parsed.IsAbs() {
+			return errors.New("tls_client_auth_san_uri格式错误")
+		}
+	}
+	return nil
+}
+
+type MTLSService struct{}
+
+func NewMTLSService() *MTLSService {
+	return &MTLSService{}
+}
+
+// MTLSAvailable 能否获得客户端证书：直接终止TLS，或配置了可信代理转发的证书头
+func MTLSAvailable() bool {
+	return config.Cfg.Server.TLSCertFile != "" || (config.Cfg.OAuth2.MTLSCertHeader != "" && len(config.Cfg.OAuth2.MTLSTrustedProxies) > 0)
+}
+
+// ClientCertificatesFromRequest 获取请求携带的客户端证书链（客户端证书在前）
+// 直接TLS连接时取握手中的证书；否则仅当请求来自可信代理时读取代理转发的证书头
+func ClientCertificatesFromRequest(r *http.Request) []*x509.Certificate {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates
+	}
+
+	header := config.Cfg.OAuth2.MTLSCertHeader
+	if header == "" || !isTrustedCertificateProxy(r.RemoteAddr) {
+		return nil
+	}
+	value := r.Header.Get(header)
+	if value == "" {
+		return nil
+	}
+	certs, err := utils.ParseCertificateHeader(value)
+	if err != nil {
+		utils.Warn("解析代理转发的客户端证书失败: %v", err)
+		return nil
+	}
+	return certs
+}
+
+// isTrustedCertificateProxy 请求的直接来源是否为配置的可信代理
+func isTrustedCertificateProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, proxy := range config.Cfg.OAuth2.MTLSTrustedProxies {
+		if strings.Contains(proxy, "/") {
+			if _, network, err := net.ParseCIDR(proxy); err == nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if proxyIP := net.ParseIP(proxy); proxyIP != nil && proxyIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	mtlsRootsOnce sync.Once
+	mtlsRoots     *x509.CertPool
+)
+
+// mtlsClientCAs 加载校验客户端证书链的CA，未配置时返回nil以使用系统根证书
+func mtlsClientCAs() *x509.CertPool {
+	mtlsRootsOnce.Do(func() {
+		file := config.Cfg.OAuth2.MTLSClientCAFile
+		if file == "" {
+			return
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			utils.Error("读取客户端证书CA失败: %v", err)
+			mtlsRoots = x509.NewCertPool()
+			return
+		}
+		mtlsRoots = x509.NewCertPool()
+		if !mtlsRoots.AppendCertsFromPEM(data) {
+			utils.Error("客户端证书CA文件中没有有效的证书")
+		}
+	})
+	return mtlsRoots
+}
+
+// verifyTLSClientAuth 基于PKI的双向TLS客户端认证（RFC 8705 2.1节）：证书链可信且身份与注册值一致
+func verifyTLSClientAuth(client *models.OAuth2Client, certs []*x509.Certificate) error {
+	leaf := certs[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         mtlsClientCAs(),
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return errors.New("客户端证书不受信任")
+	}
+
+	identity := ClientTLSIdentity(client)
+	var matched bool
+	switch {
+	case identity.SubjectDN != "":
+		matched = strings.EqualFold(normalizeDN(leaf.Subject.String()), normalizeDN(identity.SubjectDN))
+	case identity.SANDNS != "":
+		for _, name := range leaf.DNSNames {
+			if strings.EqualFold(name, identity.SANDNS) {
+				matched = true
+				break
+			}
+		}
+	case identity.SANURI != "":
+		for _, uri := range leaf.URIs {
+			if uri.String() == identity.SANURI {
+				matched = true
+				break
+			}
+		}
+	case identity.SANIP != "":
+		expected := net.ParseIP(identity.SANIP)
+		for _, ip := range leaf.IPAddresses {
+			if ip.Equal(expected) {
+				matched = true
+				break
+			}
+		}
+	case identity.SANEmail != "":
+		for _, email := range leaf.EmailAddresses {
+			if strings.EqualFold(email, identity.SANEmail) {
+				matched = true
+				break
+			}
+		}
+	}
+	if !matched {
+		return errors.New("客户端证书与注册的身份不匹配")
+	}
+	return nil
+}
+
+// normalizeDN 去除DN各RDN之间的空白，便于比较
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return strings.Join(parts, ",")
+}
+
+// verifySelfSignedTLSClientAuth 自签名证书的双向TLS客户端认证（RFC 8705 2.2节）：证书公钥必须在客户端注册的JWKS中
+func verifySelfSignedTLSClientAuth(client *models.OAuth2Client, certs []*x509.Certificate) error {
+	leaf := certs[0]
+	now := time.Now()
+	if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return errors.New("客户端证书不在有效期内")
+	}
+
+	keys, err := clientPublicKeys(client, "", false)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if k, ok := key.(interface{ Equal(crypto.PublicKey) bool }); ok && k.Equal(leaf.PublicKey) {
+			return nil
+		}
+	}
+	return errors.New("客户端证书与注册的公钥不匹配")
+}
+
+// VerifyBoundToken 校验访问受保护资源时访问令牌与客户端证书的绑定（RFC 8705 3节）
+func (s *MTLSService) VerifyBoundToken(r *http.Request, cnf *utils.ConfirmationClaim) error {
+	if cnf == nil || cnf.X5tS256 == "" {
+		return nil
+	}
+
+	certs := ClientCertificatesFromRequest(r)
+	if len(certs) == 0 {
+		return errors.New("证书绑定的访问令牌需要通过双向TLS使用")
+	}
+	if utils.CertificateThumbprint(certs[0]) != cnf.X5tS256 {
+		return errors.New("客户端证书与令牌绑定的证书不匹配")
+	}
+	return nil
+}
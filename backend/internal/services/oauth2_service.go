@@ -2,15 +2,21 @@ package services
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"astro-pass/internal/config"
 	"astro-pass/internal/database"
 	"astro-pass/internal/models"
 	"astro-pass/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 type OAuth2Service struct{}
@@ -19,88 +25,759 @@ func NewOAuth2Service() *OAuth2Service {
 	return &OAuth2Service{}
 }
 
+// AuthorizationCodeRequest 签发授权码所需的授权请求参数
+type AuthorizationCodeRequest struct {
+	ClientID            string
+	UserID              uint
+	RedirectURI         string
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	Claims              *ClaimsRequest     // OIDC claims请求参数
+	Resources           []string           // 资源指示（RFC 8707）
+	Auth                *utils.AuthContext // 用户在授权时的认证上下文
+}
+
 // GenerateAuthorizationCode 生成授权码
-func (s *OAuth2Service) GenerateAuthorizationCode(clientID string, userID uint, redirectURI, scope, codeChallenge, codeChallengeMethod string) (string, error) {
+func (s *OAuth2Service) GenerateAuthorizationCode(req *AuthorizationCodeRequest) (string, error) {
 	// 生成随机授权码
 	codeBytes := make([]byte, 32)
 	if _, err := rand.Read(codeBytes); err != nil {
-		return "", errors.New("生成授权码失败")
+		return "", &ServerError{Description: "生成授权码失败"}
 	}
 	code := base64.URLEncoding.EncodeToString(codeBytes)
 
 	// 查找客户端以获取 ID
 	var client models.OAuth2Client
-	if err := database.DB.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+	if err := database.DB.Where("client_id = ?", req.ClientID).First(&client).Error; err != nil {
 		return "", errors.New("无效的客户端")
 	}
 
+	// 校验PKCE参数
+	codeChallengeMethod, err := s.ValidatePKCEChallenge(&client, req.CodeChallenge, req.CodeChallengeMethod)
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateResourceIndicators(req.Resources); err != nil {
+		return "", err
+	}
+
 	// 保存授权码
 	authCode := &models.AuthorizationCode{
-		Code:              code,
-		OAuth2ClientID:    client.ID, // 外键
-		ClientID:          clientID,  // OAuth2 标准中的 client_id
-		UserID:            userID,
-		RedirectURI:       redirectURI,
-		Scope:             scope,
-		CodeChallenge:     codeChallenge,
+		Code:                code,
+		OAuth2ClientID:      client.ID,    // 外键
+		ClientID:            req.ClientID, // OAuth2 标准中的 client_id
+		UserID:              req.UserID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
 		CodeChallengeMethod: codeChallengeMethod,
-		ExpiresAt:         time.Now().Add(config.Cfg.OAuth2.AuthorizationCodeExpire),
+		Nonce:               req.Nonce,
+		Claims:              req.Claims.Encode(),
+		Resource:            strings.Join(req.Resources, " "),
+		ExpiresAt:           time.Now().Add(config.Cfg.OAuth2.AuthorizationCodeExpire),
+	}
+	if req.Auth != nil {
+		authTime := req.Auth.AuthTime
+		authCode.AuthTime = &authTime
+		authCode.AuthMethods = strings.Join(req.Auth.AMR, " ")
+		authCode.SessionID = req.Auth.SessionID
 	}
 
 	if err := database.DB.Create(authCode).Error; err != nil {
-		return "", errors.New("保存授权码失败")
+		return "", &ServerError{Description: "保存授权码失败"}
 	}
 
 	return code, nil
 }
 
-// ClientCredentialsGrant 客户端凭证模式
-func (s *OAuth2Service) ClientCredentialsGrant(clientID, clientSecret, scope string) (*models.AccessToken, error) {
-	// 验证客户端
+// prompt参数的取值（OIDC Core 3.1.2.1节）
+const (
+	PromptNone          = "none"
+	PromptLogin         = "login"
+	PromptConsent       = "consent"
+	PromptSelectAccount = "select_account" // 不支持多账户切换，按未指定处理
+)
+
+// AuthenticationRequirements 授权请求对用户认证的要求，来自prompt、max_age、login_hint和acr_values参数（OIDC Core 3.1.2.1节）
+type AuthenticationRequirements struct {
+	Prompts   []string
+	MaxAge    int // 允许的最长认证时长（秒），-1表示未指定
+	LoginHint string
+	ACRValues []string // 按优先顺序请求的认证上下文类
+}
+
+// ParseAuthenticationRequirements 解析授权请求中与用户认证相关的参数
+func ParseAuthenticationRequirements(prompt, maxAge, loginHint, acrValues string) (*AuthenticationRequirements, error) {
+	req := &AuthenticationRequirements{
+		MaxAge:    -1,
+		LoginHint: strings.TrimSpace(loginHint),
+		ACRValues: strings.Fields(acrValues),
+	}
+
+	for _, value := range strings.Fields(prompt) {
+		switch value {
+		case PromptNone, PromptLogin, PromptConsent, PromptSelectAccount:
+		default:
+			return nil, errors.New("不支持的prompt取值: " + value)
+		}
+		if !containsString(req.Prompts, value) {
+			req.Prompts = append(req.Prompts, value)
+		}
+	}
+	if req.HasPrompt(PromptNone) && len(req.Prompts) > 1 {
+		return nil, errors.New("prompt=none不能与其他取值同时使用")
+	}
+
+	if maxAge != "" {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil || seconds < 0 {
+			return nil, errors.New("max_age必须是非负整数")
+		}
+		req.MaxAge = seconds
+	}
+	return req, nil
+}
+
+// HasPrompt 是否请求了指定的prompt取值
+func (r *AuthenticationRequirements) HasPrompt(value string) bool {
+	return containsString(r.Prompts, value)
+}
+
+// RequiresMFA 请求的acr_values是否只能由MFA认证满足
+func (r *AuthenticationRequirements) RequiresMFA() bool {
+	return ACRValuesRequireMFA(r.ACRValues)
+}
+
+// ACRValuesRequireMFA acr_values是否只能由MFA认证满足，用于触发登录时的MFA验证（step-up）
+// acr_values是自愿声明（OIDC Core 5.5.1.1节），不认识的取值被忽略
+func ACRValuesRequireMFA(acrValues []string) bool {
+	return containsString(acrValues, utils.ACRMultiFactor) && !containsString(acrValues, utils.ACRSingleFactor)
+}
+
+// LoginRequestedAt 验证授权请求携带的login_request凭据，返回授权端点要求重新登录的时间
+// 凭据缺失、伪造、过期或与授权请求不匹配时返回零值，视为尚未要求重新登录
+func LoginRequestedAt(loginRequest, clientID, redirectURI string) time.Time {
+	if loginRequest == "" {
+		return time.Time{}
+	}
+	requestedAt, err := utils.ParseLoginRequestToken(loginRequest, clientID, redirectURI)
+	if err != nil {
+		return time.Time{}
+	}
+	return requestedAt
+}
+
+// ReauthenticationReason 判断用户当前的登录能否满足授权请求，需要重新认证时返回原因，满足时返回空字符串
+// loginRequestedAt 为授权端点要求重新登录的时间（由 LoginRequestedAt 取自服务端签发的凭据），
+// 此后完成的认证满足prompt=login和max_age，零值表示尚未要求
+func (r *AuthenticationRequirements) ReauthenticationReason(user *models.User, auth *utils.AuthContext, loginRequestedAt time.Time, now time.Time) string {
+	reauthenticated := auth != nil && !loginRequestedAt.IsZero() && auth.AuthTime.Unix() >= loginRequestedAt.Unix()
+
+	if r.HasPrompt(PromptLogin) && !reauthenticated {
+		return "该应用要求重新登录"
+	}
+	if r.MaxAge >= 0 && !reauthenticated && (auth == nil || now.Sub(auth.AuthTime) > time.Duration(r.MaxAge)*time.Second) {
+		return "距上次登录的时间超过了应用允许的范围，请重新登录"
+	}
+	if r.LoginHint != "" && !matchesLoginHint(user, r.LoginHint) {
+		return "当前登录的账户与应用指定的账户不一致"
+	}
+	// 只有已启用MFA的用户才能完成step-up，否则按实际的acr签发，由客户端决定是否接受
+	if r.RequiresMFA() && user.MFAEnabled && (auth == nil || auth.ACR() != utils.ACRMultiFactor) {
+		return "该应用要求通过MFA验证登录"
+	}
+	return ""
+}
+
+// matchesLoginHint login_hint可以是用户名、邮箱或用户UUID
+func matchesLoginHint(user *models.User, hint string) bool {
+	return hint == user.Username || hint == user.UUID || strings.EqualFold(hint, user.Email)
+}
+
+// GetClientByClientID 根据client_id获取有效的客户端
+func (s *OAuth2Service) GetClientByClientID(clientID string) (*models.OAuth2Client, error) {
 	var client models.OAuth2Client
 	if err := database.DB.Where("client_id = ? AND status = ?", clientID, "active").First(&client).Error; err != nil {
 		return nil, errors.New("无效的客户端")
 	}
+	return &client, nil
+}
+
+// 客户端认证方式（token_endpoint_auth_method）
+const (
+	ClientAuthSecretBasic = "client_secret_basic"
+	ClientAuthSecretPost  = "client_secret_post"
+	ClientAuthSecretJWT   = "client_secret_jwt"
+	ClientAuthPrivateKey  = "private_key_jwt"
+	ClientAuthTLS         = "tls_client_auth"             // 基于PKI的双向TLS（RFC 8705 2.1节）
+	ClientAuthSelfSigned  = "self_signed_tls_client_auth" // 自签名证书的双向TLS（RFC 8705 2.2节）
+	ClientAuthNone        = "none"
+)
+
+// ClientAssertionTypeJWTBearer JWT客户端断言类型（RFC 7523）
+const ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionMaxLifetime 客户端断言允许的最长有效期
+const clientAssertionMaxLifetime = time.Hour
+
+// clientSecretSigningAlgs 使用客户端密钥（HMAC）签名的断言和请求对象允许的算法
+var clientSecretSigningAlgs = []string{"HS256", "HS384", "HS512"}
 
-	// 验证客户端密钥
-	if client.ClientSecret != clientSecret {
-		return nil, errors.New("客户端密钥错误")
+// clientKeySigningAlgs 使用客户端注册的公钥验证的断言和请求对象允许的算法
+var clientKeySigningAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// supportedClientAuthMethods 令牌端点支持的客户端认证方式
+var supportedClientAuthMethods = []string{ClientAuthSecretBasic, ClientAuthSecretPost, ClientAuthSecretJWT, ClientAuthPrivateKey, ClientAuthTLS, ClientAuthSelfSigned, ClientAuthNone}
+
+// ClientAuthentication 客户端在令牌、内省、撤销等端点提交的认证信息
+type ClientAuthentication struct {
+	ClientID            string
+	ClientSecret        string
+	ClientAssertionType string
+	ClientAssertion     string
+	DPoPKeyThumbprint   string              // 令牌端点已验证的DPoP证明公钥指纹（RFC 9449），为空表示未使用DPoP
+	ClientCertificates  []*x509.Certificate // 双向TLS连接中的客户端证书链，客户端证书在前（RFC 8705）
+	Issuer              string              // 请求到达的签发者（RFC 8414），签发的令牌使用该iss，为空表示主签发者
+}
+
+// certificateThumbprint 客户端证书的指纹，未提供证书时为空
+func (auth *ClientAuthentication) certificateThumbprint() string {
+	if len(auth.ClientCertificates) == 0 {
+		return ""
 	}
+	return utils.CertificateThumbprint(auth.ClientCertificates[0])
+}
 
-	// 检查是否支持客户端凭证模式
+// tokenConfirmation 根据客户端提交的持有证明确定令牌绑定的密钥（cnf）
+// DPoP证明存在时绑定其公钥；客户端注册了证书绑定时绑定双向TLS的客户端证书
+func tokenConfirmation(client *models.OAuth2Client, auth *ClientAuthentication) (*utils.ConfirmationClaim, error) {
+	cnf := &utils.ConfirmationClaim{JKT: auth.DPoPKeyThumbprint}
+	if cnf.JKT == "" && client.RequireDPoP {
+		return nil, errors.New("该客户端要求使用DPoP证明")
+	}
+	if client.RequireMTLSBinding {
+		if cnf.X5tS256 = auth.certificateThumbprint(); cnf.X5tS256 == "" {
+			return nil, errors.New("该客户端要求通过双向TLS获取证书绑定的令牌")
+		}
+	}
+	if cnf.JKT == "" && cnf.X5tS256 == "" {
+		return nil, nil
+	}
+	return cnf, nil
+}
+
+// tokenTypeFor 绑定DPoP密钥的令牌类型为DPoP，否则为Bearer
+func tokenTypeFor(cnf *utils.ConfirmationClaim) string {
+	if cnf != nil && cnf.JKT != "" {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+// confirmationJKT 取出cnf中的DPoP公钥指纹
+func confirmationJKT(cnf *utils.ConfirmationClaim) string {
+	if cnf == nil {
+		return ""
+	}
+	return cnf.JKT
+}
+
+// confirmationX5tS256 取出cnf中的客户端证书指纹
+func confirmationX5tS256(cnf *utils.ConfirmationClaim) string {
+	if cnf == nil {
+		return ""
+	}
+	return cnf.X5tS256
+}
+
+// AuthenticateClient 在令牌端点认证客户端
+// 客户端必须使用注册时选择的认证方式：公共客户端（none）不得提交凭证，
+// client_secret_basic/client_secret_post 比较密钥，client_secret_jwt/private_key_jwt 验证签名断言，
+// tls_client_auth/self_signed_tls_client_auth 验证双向TLS连接中的客户端证书
+// 认证失败时返回 *InvalidClientError
+func (s *OAuth2Service) AuthenticateClient(auth *ClientAuthentication) (*models.OAuth2Client, error) {
+	client, err := s.authenticateClient(auth)
+	if err != nil {
+		return nil, &InvalidClientError{Description: err.Error()}
+	}
+	return client, nil
+}
+
+// authenticateClient 按客户端注册的认证方式校验凭证
+func (s *OAuth2Service) authenticateClient(auth *ClientAuthentication) (*models.OAuth2Client, error) {
+	if auth == nil || auth.ClientID == "" {
+		return nil, errors.New("缺少client_id")
+	}
+
+	client, err := s.GetClientByClientID(auth.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	registered := client.TokenEndpointAuthMethod
+	if registered == "" {
+		registered = ClientAuthSecretBasic
+	}
+
+	switch registered {
+	case ClientAuthNone:
+		if auth.ClientSecret != "" || auth.ClientAssertion != "" {
+			return nil, errors.New("公共客户端不应提供客户端凭证")
+		}
+		return client, nil
+	case ClientAuthSecretBasic, ClientAuthSecretPost:
+		// 两种密钥传递方式均接受，但不接受断言
+		if auth.ClientAssertion != "" {
+			return nil, errors.New("客户端认证方式不匹配")
+		}
+		if err := verifyClientSecret(client, auth.ClientSecret); err != nil {
+			return nil, err
+		}
+		return client, nil
+	case ClientAuthSecretJWT, ClientAuthPrivateKey:
+		if auth.ClientSecret != "" || auth.ClientAssertion == "" {
+			return nil, errors.New("客户端认证方式不匹配")
+		}
+		if auth.ClientAssertionType != ClientAssertionTypeJWTBearer {
+			return nil, errors.New("不支持的client_assertion_type")
+		}
+		if err := s.verifyClientAssertion(client, auth.ClientAssertion); err != nil {
+			return nil, err
+		}
+		return client, nil
+	case ClientAuthTLS, ClientAuthSelfSigned:
+		if auth.ClientSecret != "" || auth.ClientAssertion != "" {
+			return nil, errors.New("客户端认证方式不匹配")
+		}
+		if len(auth.ClientCertificates) == 0 {
+			return nil, errors.New("缺少客户端证书")
+		}
+		verify := verifyTLSClientAuth
+		if registered == ClientAuthSelfSigned {
+			verify = verifySelfSignedTLSClientAuth
+		}
+		if err := verify(client, auth.ClientCertificates); err != nil {
+			return nil, err
+		}
+		return client, nil
+	default:
+		return nil, errors.New("不支持的客户端认证方式")
+	}
+}
+
+// verifyClientAssertion 验证客户端断言（RFC 7523 第3节）
+func (s *OAuth2Service) verifyClientAssertion(client *models.OAuth2Client, assertion string) error {
+	var keyCandidates []interface{}
+	var allowedAlgs []string
+
+	if client.TokenEndpointAuthMethod == ClientAuthSecretJWT {
+		allowedAlgs = clientSecretSigningAlgs
+		keyCandidates = clientSecretKeys(client)
+	} else {
+		allowedAlgs = clientKeySigningAlgs
+		keys, err := clientPublicKeys(client, jwtKeyID(assertion), false)
+		if err != nil {
+			return err
+		}
+		keyCandidates = keys
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	var verified bool
+	for _, key := range keyCandidates {
+		k := key
+		_, err := jwt.ParseWithClaims(assertion, claims, func(token *jwt.Token) (interface{}, error) {
+			return k, nil
+		}, jwt.WithValidMethods(allowedAlgs), jwt.WithExpirationRequired())
+		if err == nil {
+			verified = true
+			break
+		}
+		claims = &jwt.RegisteredClaims{}
+	}
+	if !verified {
+		return errors.New("客户端断言签名无效或已过期")
+	}
+
+	// iss和sub必须均为client_id
+	if claims.Issuer != client.ClientID || claims.Subject != client.ClientID {
+		return errors.New("客户端断言的iss或sub无效")
+	}
+
+	// aud必须包含本授权服务器
+	audienceValid := false
+	for _, aud := range claims.Audience {
+		if isAuthorizationServerAudience(aud) {
+			audienceValid = true
+			break
+		}
+	}
+	if !audienceValid {
+		return errors.New("客户端断言的aud无效")
+	}
+
+	if claims.ExpiresAt.Time.After(time.Now().Add(clientAssertionMaxLifetime)) {
+		return errors.New("客户端断言有效期过长")
+	}
+
+	// jti防重放：同一客户端的jti在断言有效期内只能使用一次
+	if claims.ID == "" {
+		return errors.New("客户端断言缺少jti")
+	}
+	record := &models.ClientAssertionJTI{
+		ClientID:  client.ClientID,
+		JTI:       claims.ID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if err := database.DB.Create(record).Error; err != nil {
+		return errors.New("客户端断言已被使用")
+	}
+
+	return nil
+}
+
+// clientPublicKeys 获取客户端注册的用于验签的公钥，优先使用内联JWKS
+func clientPublicKeys(client *models.OAuth2Client, kid string, forceRefresh bool) ([]interface{}, error) {
+	var set *utils.JWKSet
+	var err error
+	switch {
+	case client.JWKS != "":
+		set, err = utils.ParseJWKSet([]byte(client.JWKS))
+	case client.JWKSURI != "":
+		set, err = utils.FetchJWKS(client.JWKSURI, forceRefresh)
+	default:
+		return nil, errors.New("客户端未注册JWKS")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := set.FindKeys(kid)
+	if len(jwks) == 0 && kid != "" && client.JWKS == "" && !forceRefresh {
+		// kid未命中时可能是客户端轮换了密钥，重新拉取一次
+		return clientPublicKeys(client, kid, true)
+	}
+
+	keys := make([]interface{}, 0, len(jwks))
+	for i := range jwks {
+		key, err := jwks[i].PublicKey()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("未找到匹配的客户端公钥")
+	}
+	return keys, nil
+}
+
+// jwtKeyID 读取JWT头部中的kid（不验证签名）
+func jwtKeyID(tokenString string) string {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, &jwt.RegisteredClaims{})
+	if err != nil {
+		return ""
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+// ClientIDFromAssertion 读取客户端断言中的iss（不验证签名），用于请求未携带client_id的情况
+func ClientIDFromAssertion(assertion string) string {
+	claims := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, claims); err != nil {
+		return ""
+	}
+	return claims.Issuer
+}
+
+// isAuthorizationServerAudience 检查断言的aud是否指向本授权服务器（任一签发者或其端点）
+func isAuthorizationServerAudience(aud string) bool {
+	for _, issuer := range utils.Issuers() {
+		switch aud {
+		case issuer,
+			issuer + "/api/oauth2/token",
+			issuer + "/api/oauth2/introspect",
+			issuer + "/api/oauth2/revoke",
+			issuer + "/api/oauth2/device_authorization",
+			issuer + "/api/oauth2/par":
+			return true
+		}
+	}
+	return false
+}
+
+// CleanupExpiredClientAssertions 清理已过期的客户端断言jti记录
+func (s *OAuth2Service) CleanupExpiredClientAssertions() error {
+	return database.DB.Where("expires_at < ?", time.Now()).Delete(&models.ClientAssertionJTI{}).Error
+}
+
+// ClientGrantTypes 获取客户端注册的授权类型
+func ClientGrantTypes(client *models.OAuth2Client) []string {
 	var grantTypes []string
 	if err := json.Unmarshal([]byte(client.GrantTypes), &grantTypes); err != nil {
-		return nil, errors.New("客户端配置错误")
+		return []string{}
 	}
+	return grantTypes
+}
 
-	supportsClientCredentials := false
-	for _, gt := range grantTypes {
-		if gt == "client_credentials" {
-			supportsClientCredentials = true
-			break
+// clientSupportsGrantType 检查客户端是否注册了指定的授权类型
+func clientSupportsGrantType(client *models.OAuth2Client, grantType string) bool {
+	for _, gt := range ClientGrantTypes(client) {
+		if gt == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckClientGrantType 客户端未注册该授权类型时返回unauthorized_client错误（RFC 6749 5.2节）
+func CheckClientGrantType(client *models.OAuth2Client, grantType string) error {
+	if !clientSupportsGrantType(client, grantType) {
+		return &UnauthorizedClientError{Description: "客户端不支持" + grantType + "授权类型"}
+	}
+	return nil
+}
+
+// checkClientScope 检查scope是否在客户端允许的范围内，客户端未配置scope时不限制
+func checkClientScope(client *models.OAuth2Client, scope string) error {
+	if client.Scope == "" || isScopeSubset(scope, client.Scope) {
+		return nil
+	}
+	return &InvalidScopeError{Description: "请求的scope超出客户端允许的范围"}
+}
+
+// ResolveClientScope 确定授权请求的scope：未指定时使用客户端允许的全部scope（RFC 6749 3.3节），否则必须在允许范围内
+func ResolveClientScope(client *models.OAuth2Client, scope string) (string, error) {
+	if strings.TrimSpace(scope) == "" {
+		return client.Scope, nil
+	}
+	if err := checkClientScope(client, scope); err != nil {
+		return "", err
+	}
+	return scope, nil
+}
+
+// clientLifetime 客户端覆盖的有效期（秒），未覆盖时使用全局配置
+func clientLifetime(seconds int, fallback time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
+// ClientAccessTokenLifetime 客户端的访问令牌有效期
+func ClientAccessTokenLifetime(client *models.OAuth2Client) time.Duration {
+	return clientLifetime(client.AccessTokenLifetime, config.Cfg.OAuth2.AccessTokenExpire)
+}
+
+// clientIDTokenLifetime 客户端的ID Token有效期
+func clientIDTokenLifetime(client *models.OAuth2Client) time.Duration {
+	return clientLifetime(client.IDTokenLifetime, config.Cfg.OAuth2.IDTokenExpire)
+}
+
+// clientRefreshTokenIdleTimeout 客户端的刷新令牌闲置过期时间
+func clientRefreshTokenIdleTimeout(client *models.OAuth2Client) time.Duration {
+	return clientLifetime(client.RefreshTokenIdleTimeout, config.Cfg.OAuth2.RefreshTokenExpire)
+}
+
+// clientRefreshTokenAbsoluteExpiry 新令牌家族的绝对过期时间，未配置绝对有效期时为nil
+func clientRefreshTokenAbsoluteExpiry(client *models.OAuth2Client, now time.Time) *time.Time {
+	lifetime := clientLifetime(client.RefreshTokenAbsoluteLifetime, config.Cfg.OAuth2.RefreshTokenAbsoluteExpire)
+	if lifetime <= 0 {
+		return nil
+	}
+	expiresAt := now.Add(lifetime)
+	return &expiresAt
+}
+
+// capExpiry 过期时间不超过上限，上限为nil时不限制
+func capExpiry(expiresAt time.Time, limit *time.Time) time.Time {
+	if limit != nil && limit.Before(expiresAt) {
+		return *limit
+	}
+	return expiresAt
+}
+
+// pkceRequired 客户端是否必须使用PKCE（公共客户端始终需要）
+func pkceRequired(client *models.OAuth2Client) bool {
+	return client.RequirePKCE || client.ClientType == "public"
+}
+
+// ValidatePKCEChallenge 校验授权请求中的PKCE参数，返回规范化后的code_challenge_method
+func (s *OAuth2Service) ValidatePKCEChallenge(client *models.OAuth2Client, codeChallenge, codeChallengeMethod string) (string, error) {
+	if codeChallenge == "" {
+		if codeChallengeMethod != "" {
+			return "", errors.New("缺少code_challenge参数")
+		}
+		if pkceRequired(client) {
+			return "", errors.New("该客户端要求使用PKCE")
+		}
+		return "", nil
+	}
+
+	// 未指定method时按RFC 7636默认为plain
+	if codeChallengeMethod == "" {
+		codeChallengeMethod = utils.PKCEMethodPlain
+	}
+	if !utils.IsSupportedPKCEMethod(codeChallengeMethod) {
+		return "", errors.New("不支持的code_challenge_method")
+	}
+	if pkceRequired(client) && codeChallengeMethod != utils.PKCEMethodS256 {
+		return "", errors.New("该客户端要求使用S256作为code_challenge_method")
+	}
+	if !utils.ValidatePKCEValue(codeChallenge) {
+		return "", errors.New("code_challenge格式错误")
+	}
+
+	return codeChallengeMethod, nil
+}
+
+// InvalidTargetError 资源指示（resource）无效或不被允许（RFC 8707 2节，错误码invalid_target）
+type InvalidTargetError struct {
+	Description string
+}
+
+func (e *InvalidTargetError) Error() string {
+	return e.Description
+}
+
+// InvalidScopeError 请求的scope无效或超出允许范围（RFC 6749 5.2节，错误码invalid_scope）
+type InvalidScopeError struct {
+	Description string
+}
+
+func (e *InvalidScopeError) Error() string {
+	return e.Description
+}
+
+// UnauthorizedClientError 客户端无权使用该授权类型（RFC 6749 5.2节，错误码unauthorized_client）
+type UnauthorizedClientError struct {
+	Description string
+}
+
+func (e *UnauthorizedClientError) Error() string {
+	return e.Description
+}
+
+// InvalidClientError 客户端认证失败（RFC 6749 5.2节，错误码invalid_client）
+type InvalidClientError struct {
+	Description string
+}
+
+func (e *InvalidClientError) Error() string {
+	return e.Description
+}
+
+// ServerError 服务端内部错误导致无法完成请求（RFC 6749 4.1.2.1节、5.2节，错误码server_error）
+type ServerError struct {
+	Description string
+}
+
+func (e *ServerError) Error() string {
+	return e.Description
+}
+
+// ValidateResourceIndicators 校验resource参数：必须为不含片段的绝对URI（RFC 8707 2节）
+func ValidateResourceIndicators(resources []string) error {
+	for _, resource := range resources {
+		parsed, err := url.Parse(resource)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return &InvalidTargetError{Description: "无效的resource: " + resource}
+		}
+	}
+	return nil
+}
+
+// resolveTokenAudience 确定访问令牌的受众（aud）
+// 授权时指定过资源的，令牌请求只能从中选择（未指定时为全部）；否则使用令牌请求中的资源；均未指定时为用户信息端点
+func resolveTokenAudience(requested, granted []string) ([]string, error) {
+	if err := ValidateResourceIndicators(requested); err != nil {
+		return nil, err
+	}
+	if len(granted) > 0 {
+		if len(requested) == 0 {
+			return granted, nil
+		}
+		for _, resource := range requested {
+			if !containsString(granted, resource) {
+				return nil, &InvalidTargetError{Description: "请求的resource超出授权范围: " + resource}
+			}
 		}
+		return requested, nil
+	}
+	if len(requested) > 0 {
+		return requested, nil
+	}
+	return []string{utils.ClientAccessTokenAudience()}, nil
+}
+
+// ClientCredentialsGrant 客户端凭证模式，resources 为令牌请求中的资源指示（RFC 8707）
+func (s *OAuth2Service) ClientCredentialsGrant(clientAuth *ClientAuthentication, scope string, resources []string) (*models.AccessToken, error) {
+	// 验证客户端
+	client, err := s.AuthenticateClient(clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	// 公共客户端无法保管凭证，不能使用客户端凭证模式
+	if client.ClientType == "public" {
+		return nil, errors.New("公共客户端不支持client_credentials授权类型")
+	}
+
+	// 检查是否支持客户端凭证模式
+	if err := CheckClientGrantType(client, "client_credentials"); err != nil {
+		return nil, err
 	}
 
-	if !supportsClientCredentials {
-		return nil, errors.New("客户端不支持client_credentials授权类型")
+	scope, err = ResolveClientScope(client, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	cnf, err := tokenConfirmation(client, clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	audience, err := resolveTokenAudience(resources, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	// 生成访问令牌（客户端凭证模式不需要用户ID）
-	accessTokenString, err := utils.GenerateAccessToken(0, "", "")
+	// 生成访问令牌（客户端凭证模式没有用户，sub为client_id）
+	expiresIn := ClientAccessTokenLifetime(client)
+	accessTokenString, err := utils.GenerateAccessTokenWithOptions(0, "", "", &utils.AccessTokenOptions{
+		Subject:   client.ClientID,
+		ClientID:  client.ClientID,
+		Scope:     scope,
+		Audience:  audience,
+		Cnf:       cnf,
+		ExpiresIn: expiresIn,
+		Issuer:    clientAuth.Issuer,
+	})
 	if err != nil {
-		return nil, errors.New("生成访问令牌失败")
+		return nil, &ServerError{Description: "生成访问令牌失败"}
 	}
 
 	// 保存访问令牌（UserID为nil）
 	accessToken := &models.AccessToken{
 		Token:          accessTokenString,
+		TokenHash:      utils.HashToken(accessTokenString),
 		OAuth2ClientID: client.ID,
-		ClientID:       clientID,
+		ClientID:       client.ClientID,
 		UserID:         nil, // 客户端凭证模式没有用户
 		Scope:          scope,
-		ExpiresAt:      time.Now().Add(config.Cfg.OAuth2.AccessTokenExpire),
+		Audience:       strings.Join(audience, " "),
+		JKT:            confirmationJKT(cnf),
+		X5tS256:        confirmationX5tS256(cnf),
+		ExpiresAt:      time.Now().Add(expiresIn),
+	}
+	if err := database.DB.Create(accessToken).Error; err != nil {
+		return nil, &ServerError{Description: "保存访问令牌失败"}
 	}
-	database.DB.Create(accessToken)
 
 	return accessToken, nil
 }
@@ -113,126 +790,628 @@ type TokenResponse struct {
 	RefreshToken string `json:"refresh_token,omitempty"`
 	IDToken      string `json:"id_token,omitempty"`
 	Scope        string `json:"scope,omitempty"`
+	// IssuedTokenType 令牌交换响应中签发的令牌类型（RFC 8693）
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
 }
 
-// ExchangeAuthorizationCode 交换授权码获取令牌
-func (s *OAuth2Service) ExchangeAuthorizationCode(code, clientID, clientSecret, redirectURI, codeVerifier string) (*TokenResponse, error) {
+// ExchangeAuthorizationCode 交换授权码获取令牌，resources 为令牌请求中的资源指示（RFC 8707）
+func (s *OAuth2Service) ExchangeAuthorizationCode(clientAuth *ClientAuthentication, code, redirectURI, codeVerifier string, resources []string) (*TokenResponse, error) {
 	// 查找授权码
 	var authCode models.AuthorizationCode
 	if err := database.DB.Where("code = ? AND used = ?", code, false).First(&authCode).Error; err != nil {
 		return nil, errors.New("无效的授权码")
 	}
 
-	// 检查是否过期
-	if time.Now().After(authCode.ExpiresAt) {
-		return nil, errors.New("授权码已过期")
+	// 检查是否过期
+	if time.Now().After(authCode.ExpiresAt) {
+		return nil, errors.New("授权码已过期")
+	}
+
+	// 验证客户端
+	client, err := s.AuthenticateClient(clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	// 授权码必须由申请它的客户端兑换
+	if authCode.ClientID != client.ClientID {
+		return nil, errors.New("授权码与客户端不匹配")
+	}
+	if err := CheckClientGrantType(client, "authorization_code"); err != nil {
+		return nil, err
+	}
+
+	cnf, err := tokenConfirmation(client, clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证重定向URI
+	var redirectURIs []string
+	if err := json.Unmarshal([]byte(client.RedirectURIs), &redirectURIs); err != nil {
+		return nil, errors.New("客户端配置错误")
+	}
+
+	redirectURIMatch := false
+	for _, uri := range redirectURIs {
+		if uri == redirectURI {
+			redirectURIMatch = true
+			break
+		}
+	}
+	if !redirectURIMatch {
+		return nil, errors.New("重定向URI不匹配")
+	}
+
+	// 验证PKCE（RFC 7636）
+	if authCode.CodeChallenge != "" {
+		if codeVerifier == "" {
+			return nil, errors.New("需要提供code_verifier")
+		}
+		method := authCode.CodeChallengeMethod
+		if method == "" {
+			method = utils.PKCEMethodPlain
+		}
+		if !utils.VerifyPKCE(codeVerifier, authCode.CodeChallenge, method) {
+			return nil, errors.New("code_verifier验证失败")
+		}
+	} else if codeVerifier != "" {
+		return nil, errors.New("授权请求未使用PKCE")
+	} else if pkceRequired(client) {
+		return nil, errors.New("该客户端要求使用PKCE")
+	}
+
+	// 标记授权码为已使用
+	authCode.Used = true
+	database.DB.Save(&authCode)
+
+	// 获取用户信息
+	var user models.User
+	if err := database.DB.First(&user, authCode.UserID).Error; err != nil {
+		return nil, errors.New("用户不存在")
+	}
+
+	return s.issueUserTokens(client, clientAuth.Issuer, &user, authCode.Scope, authCode.Nonce, authCode.Claims,
+		authContextOf(authCode.AuthTime, authCode.AuthMethods, authCode.SessionID), true, cnf,
+		resources, strings.Fields(authCode.Resource))
+}
+
+// issueUserTokens 为用户签发访问令牌、刷新令牌以及ID Token（scope包含openid时）
+// claims 为授权时的OIDC claims请求参数（JSON），随访问令牌和刷新令牌保存，用户信息端点据此返回声明
+// cnf 不为空时访问令牌绑定DPoP密钥或客户端证书；公共客户端的刷新令牌同样绑定（RFC 9449 5节、RFC 8705 4节）
+// resources 为令牌请求中的资源指示，granted 为授权时确定的资源（RFC 8707），刷新令牌记录后者
+// issuer 为令牌的签发者标识，为空时使用主签发者；auth 为用户的认证上下文，包含登录会话标识时记录SSO会话以便登出通知
+func (s *OAuth2Service) issueUserTokens(client *models.OAuth2Client, issuer string, user *models.User, scope, nonce, claims string, auth *utils.AuthContext, withRefreshToken bool, cnf *utils.ConfirmationClaim, resources, granted []string) (*TokenResponse, error) {
+	audience, err := resolveTokenAudience(resources, granted)
+	if err != nil {
+		return nil, err
+	}
+
+	// 生成访问令牌
+	expiresIn := ClientAccessTokenLifetime(client)
+	accessTokenString, err := utils.GenerateAccessTokenWithOptions(user.ID, user.Username, user.Email, &utils.AccessTokenOptions{
+		Subject:   user.UUID,
+		ClientID:  client.ClientID,
+		Scope:     scope,
+		Audience:  audience,
+		Auth:      auth,
+		Cnf:       cnf,
+		ExpiresIn: expiresIn,
+		Issuer:    issuer,
+	})
+	if err != nil {
+		return nil, &ServerError{Description: "生成访问令牌失败"}
+	}
+
+	// 生成ID Token（如果scope包含openid）
+	var idTokenString string
+	if containsScope(scope, "openid") {
+		if issuer == "" {
+			issuer = utils.PrimaryIssuer()
+		}
+		idTokenString, err = utils.GenerateIDToken(
+			user.UUID,
+			NewScopeService().UserClaims(user, scope, DecodeClaimsRequest(claims).IDTokenClaims()),
+			nonce,
+			issuer,
+			client.ClientID,
+			auth,
+			clientIDTokenLifetime(client),
+		)
+		if err != nil {
+			return nil, &ServerError{Description: "生成ID Token失败"}
+		}
+
+		// 记录客户端参与的登录会话，用户登出时据此发送登出通知
+		if auth != nil && auth.SessionID != "" {
+			if err := NewSLOService().TrackClientSession(user.ID, client, auth.SessionID, accessTokenString); err != nil {
+				utils.Warn("记录SSO会话失败: %v", err)
+			}
+		}
+	}
+
+	// 保存访问令牌
+	accessToken := &models.AccessToken{
+		Token:          accessTokenString,
+		TokenHash:      utils.HashToken(accessTokenString),
+		OAuth2ClientID: client.ID,       // 外键
+		ClientID:       client.ClientID, // OAuth2 标准中的 client_id
+		UserID:         &user.ID,
+		Scope:          scope,
+		Audience:       strings.Join(audience, " "),
+		JKT:            confirmationJKT(cnf),
+		X5tS256:        confirmationX5tS256(cnf),
+		Claims:         claims,
+		ExpiresAt:      time.Now().Add(expiresIn),
+	}
+	if err := database.DB.Create(accessToken).Error; err != nil {
+		return nil, &ServerError{Description: "保存访问令牌失败"}
+	}
+
+	// 生成并保存刷新令牌
+	var refreshTokenString string
+	if withRefreshToken {
+		refreshTokenString, err = utils.GenerateRefreshToken(user.ID)
+		if err != nil {
+			return nil, &ServerError{Description: "生成刷新令牌失败"}
+		}
+
+		// 闲置过期时间不超过令牌家族的绝对过期时间
+		now := time.Now()
+		absoluteExpiresAt := clientRefreshTokenAbsoluteExpiry(client, now)
+		refreshToken := &models.RefreshToken{
+			UserID:            user.ID,
+			Token:             refreshTokenString,
+			ClientID:          client.ClientID,
+			Scope:             scope,
+			Resource:          strings.Join(granted, " "),
+			FamilyID:          utils.GenerateUUID(),
+			Claims:            claims,
+			ExpiresAt:         capExpiry(now.Add(clientRefreshTokenIdleTimeout(client)), absoluteExpiresAt),
+			AbsoluteExpiresAt: absoluteExpiresAt,
+		}
+		if auth != nil {
+			authTime := auth.AuthTime
+			refreshToken.AuthTime = &authTime
+			refreshToken.AuthMethods = strings.Join(auth.AMR, " ")
+			refreshToken.SessionID = auth.SessionID
+		}
+		// 机密客户端的刷新令牌已通过客户端认证约束，只绑定公共客户端的刷新令牌
+		if client.ClientType == "public" {
+			refreshToken.JKT = confirmationJKT(cnf)
+			refreshToken.X5tS256 = confirmationX5tS256(cnf)
+		}
+		if err := database.DB.Create(refreshToken).Error; err != nil {
+			return nil, &ServerError{Description: "保存刷新令牌失败"}
+		}
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessTokenString,
+		TokenType:    tokenTypeFor(cnf),
+		ExpiresIn:    int(expiresIn.Seconds()),
+		RefreshToken: refreshTokenString,
+		IDToken:      idTokenString,
+		Scope:        scope,
+	}, nil
+}
+
+// RefreshTokenGrant 刷新令牌模式（RFC 6749 第6节）
+// 刷新令牌与签发它的客户端绑定，scope只能缩小，旧的刷新令牌会被轮换
+func (s *OAuth2Service) RefreshTokenGrant(clientAuth *ClientAuthentication, refreshTokenString, scope string, resources []string) (*TokenResponse, error) {
+	// 验证客户端
+	client, err := s.AuthenticateClient(clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckClientGrantType(client, "refresh_token"); err != nil {
+		return nil, err
+	}
+
+	// 查找刷新令牌
+	var refreshToken models.RefreshToken
+	tokenService := NewTokenService()
+	if err := database.DB.Where("token = ? AND revoked = ?", refreshTokenString, false).First(&refreshToken).Error; err != nil {
+		if tokenService.DetectRefreshTokenReuse(refreshTokenString) {
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, errors.New("无效的刷新令牌")
+	}
+
+	// 刷新令牌必须由签发它的客户端使用
+	if refreshToken.ClientID != client.ClientID {
+		return nil, errors.New("刷新令牌与客户端不匹配")
+	}
+
+	// 检查是否过期
+	if time.Now().After(refreshToken.ExpiresAt) {
+		return nil, errors.New("刷新令牌已过期")
+	}
+
+	// 绑定了DPoP密钥的刷新令牌必须使用同一密钥的证明
+	if refreshToken.JKT != "" && refreshToken.JKT != clientAuth.DPoPKeyThumbprint {
+		return nil, errors.New("刷新令牌绑定的DPoP密钥不匹配")
+	}
+	// 绑定了客户端证书的刷新令牌必须在同一证书的双向TLS连接上使用
+	if refreshToken.X5tS256 != "" && refreshToken.X5tS256 != clientAuth.certificateThumbprint() {
+		return nil, errors.New("刷新令牌绑定的客户端证书不匹配")
+	}
+	cnf, err := tokenConfirmation(client, clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	// 请求的scope必须是原始授权范围的子集
+	if scope == "" {
+		scope = refreshToken.Scope
+	} else if !isScopeSubset(scope, refreshToken.Scope) {
+		return nil, &InvalidScopeError{Description: "请求的scope超出原始授权范围"}
+	}
+	// 客户端允许的scope可能在授权后被收窄
+	if err := checkClientScope(client, scope); err != nil {
+		return nil, err
+	}
+
+	// 获取用户信息
+	var user models.User
+	if err := database.DB.First(&user, refreshToken.UserID).Error; err != nil {
+		return nil, errors.New("用户不存在")
+	}
+
+	// 受众只能从刷新令牌授权的资源中选择
+	audience, err := resolveTokenAudience(resources, strings.Fields(refreshToken.Resource))
+	if err != nil {
+		return nil, err
+	}
+
+	// 生成新的访问令牌
+	expiresIn := ClientAccessTokenLifetime(client)
+	accessTokenString, err := utils.GenerateAccessTokenWithOptions(user.ID, user.Username, user.Email, &utils.AccessTokenOptions{
+		Subject:   user.UUID,
+		ClientID:  client.ClientID,
+		Scope:     scope,
+		Audience:  audience,
+		Auth:      authContextOf(refreshToken.AuthTime, refreshToken.AuthMethods, refreshToken.SessionID),
+		Cnf:       cnf,
+		ExpiresIn: expiresIn,
+		Issuer:    clientAuth.Issuer,
+	})
+	if err != nil {
+		return nil, &ServerError{Description: "生成访问令牌失败"}
+	}
+
+	// 生成新的刷新令牌
+	newRefreshTokenString, err := utils.GenerateRefreshToken(user.ID)
+	if err != nil {
+		return nil, &ServerError{Description: "生成刷新令牌失败"}
+	}
+
+	// 轮换刷新令牌，新的刷新令牌保持原始授权范围和绝对过期时间
+	// 先于保存访问令牌完成，并发重放时不会留下有效的访问令牌
+	if err := tokenService.RotateRefreshToken(&refreshToken, newRefreshTokenString, clientRefreshTokenIdleTimeout(client)); err != nil {
+		return nil, err
+	}
+
+	// 保存访问令牌
+	accessToken := &models.AccessToken{
+		Token:          accessTokenString,
+		TokenHash:      utils.HashToken(accessTokenString),
+		OAuth2ClientID: client.ID,
+		ClientID:       client.ClientID,
+		UserID:         &user.ID,
+		Scope:          scope,
+		Audience:       strings.Join(audience, " "),
+		JKT:            confirmationJKT(cnf),
+		X5tS256:        confirmationX5tS256(cnf),
+		Claims:         refreshToken.Claims,
+		ExpiresAt:      time.Now().Add(expiresIn),
+	}
+	if err := database.DB.Create(accessToken).Error; err != nil {
+		return nil, &ServerError{Description: "保存访问令牌失败"}
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessTokenString,
+		TokenType:    tokenTypeFor(cnf),
+		ExpiresIn:    int(expiresIn.Seconds()),
+		RefreshToken: newRefreshTokenString,
+		Scope:        scope,
+	}, nil
+}
+
+// 令牌交换相关常量（RFC 8693）
+const (
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+	TokenTypeAccessToken   = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// TokenExchangeRequest 令牌交换请求参数
+type TokenExchangeRequest struct {
+	Client             *ClientAuthentication
+	SubjectToken       string
+	SubjectTokenType   string
+	ActorToken         string
+	ActorTokenType     string
+	RequestedTokenType string
+	RequestedSubject   string // 模拟登录（act as）的目标用户UUID或用户名
+	Audience           []string
+	Resource           []string // 资源指示（RFC 8693 2.1节、RFC 8707）
+	Scope              string
+	IP                 string
+	UserAgent          string
+}
+
+// ExchangeToken 令牌交换（RFC 8693）
+// 委托模式：以用户的访问令牌换取受众更窄的下游令牌，act声明记录行事方；
+// 模拟模式：管理员通过requested_subject以目标用户身份行事，act声明记录管理员。
+// 客户端能否交换某类主体令牌由PermissionService中的客户端策略决定，所有交换均写入审计日志
+func (s *OAuth2Service) ExchangeToken(req *TokenExchangeRequest) (*TokenResponse, error) {
+	// 验证客户端，公共客户端无法安全地持有交换得到的令牌
+	client, err := s.AuthenticateClient(req.Client)
+	if err != nil {
+		return nil, err
+	}
+	if client.ClientType == "public" {
+		return nil, errors.New("公共客户端不支持令牌交换")
+	}
+	cnf, err := tokenConfirmation(client, req.Client)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckClientGrantType(client, GrantTypeTokenExchange); err != nil {
+		return nil, err
+	}
+
+	// 目前仅支持交换访问令牌
+	if req.SubjectTokenType != TokenTypeAccessToken {
+		return nil, errors.New("不支持的subject_token_type")
+	}
+	if req.ActorToken != "" && req.ActorTokenType != TokenTypeAccessToken {
+		return nil, errors.New("不支持的actor_token_type")
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != TokenTypeAccessToken {
+		return nil, errors.New("不支持的requested_token_type")
+	}
+
+	// 受众必须是已注册的客户端，资源必须是合法的绝对URI
+	for _, aud := range req.Audience {
+		if _, err := s.GetClientByClientID(aud); err != nil {
+			return nil, &InvalidTargetError{Description: "无效的audience: " + aud}
+		}
+	}
+	if err := ValidateResourceIndicators(req.Resource); err != nil {
+		return nil, err
+	}
+
+	// 验证主体令牌，绑定了DPoP密钥或客户端证书的令牌需要在令牌请求中证明持有
+	subjectClaims, subjectRecord, err := verifyExchangeToken(req.SubjectToken, req.Client)
+	if err != nil {
+		return nil, errors.New("无效的subject_token")
+	}
+
+	permissionService, err := NewPermissionService()
+	if err != nil {
+		return nil, errors.New("权限服务不可用")
+	}
+
+	var (
+		user        models.User
+		act         *utils.ActorClaim
+		actorUserID uint // 行事方为用户时的用户ID，行事方为客户端时为0
+		mode        string
+		scope       = req.Scope
+		source      string
+	)
+
+	if req.RequestedSubject != "" {
+		// 模拟模式：主体令牌属于管理员，目标用户由requested_subject指定
+		mode = "impersonate"
+		source = "*"
+		if req.ActorToken != "" {
+			return nil, errors.New("模拟模式不支持actor_token")
+		}
+		// 管理员令牌必须签发给请求交换的客户端（或以其为受众），第一方登录令牌和其他客户端的令牌不能用于模拟
+		if !exchangeTokenIssuedTo(subjectClaims, subjectRecord, client) {
+			s.auditTokenExchange(req, client, subjectClaims.UserID, mode, "failure", "subject_token未签发给请求交换的客户端", nil)
+			return nil, errors.New("subject_token未签发给请求交换的客户端")
+		}
+
+		allowed, err := permissionService.CheckClientPermission(client.ClientID, "token_exchange", mode)
+		if err != nil || !allowed {
+			s.auditTokenExchange(req, client, subjectClaims.UserID, mode, "failure", "客户端无权执行模拟令牌交换", nil)
+			return nil, errors.New("客户端无权执行模拟令牌交换")
+		}
+		allowed, err = permissionService.CheckPermission(subjectClaims.UserID, "user", "impersonate")
+		if err != nil || !allowed {
+			s.auditTokenExchange(req, client, subjectClaims.UserID, mode, "failure", "用户无权模拟其他用户", nil)
+			return nil, errors.New("用户无权模拟其他用户")
+		}
+
+		if err := database.DB.Where("uuid = ? OR username = ?", req.RequestedSubject, req.RequestedSubject).
+			First(&user).Error; err != nil {
+			return nil, errors.New("目标用户不存在")
+		}
+		if user.Status != "active" {
+			return nil, errors.New("目标用户状态异常")
+		}
+
+		var admin models.User
+		if err := database.DB.First(&admin, subjectClaims.UserID).Error; err != nil {
+			return nil, errors.New("用户不存在")
+		}
+		actorUserID = admin.ID
+		act = &utils.ActorClaim{Sub: admin.UUID, ClientID: client.ClientID}
+	} else {
+		// 委托模式：主体令牌必须是本服务签发给某个客户端的访问令牌
+		mode = "delegate"
+		if subjectRecord == nil {
+			return nil, errors.New("subject_token不是OAuth2访问令牌")
+		}
+		source = subjectRecord.ClientID
+
+		allowed, err := permissionService.CheckClientPermission(client.ClientID, "token_exchange:"+source, mode)
+		if err == nil && !allowed {
+			allowed, err = permissionService.CheckClientPermission(client.ClientID, "token_exchange:*", mode)
+		}
+		if err != nil || !allowed {
+			s.auditTokenExchange(req, client, subjectClaims.UserID, mode, "failure", "客户端无权交换该主体令牌",
+				map[string]interface{}{"subject_client_id": source})
+			return nil, errors.New("客户端无权交换该主体令牌")
+		}
+
+		// scope只能缩小
+		if scope == "" {
+			scope = subjectRecord.Scope
+		} else if !isScopeSubset(scope, subjectRecord.Scope) {
+			return nil, &InvalidScopeError{Description: "请求的scope超出主体令牌的授权范围"}
+		}
+
+		if err := database.DB.First(&user, subjectClaims.UserID).Error; err != nil {
+			return nil, errors.New("用户不存在")
+		}
+
+		// 行事方：提供了actor_token时为该令牌的用户，否则为请求交换的客户端
+		// actor_token必须签发给请求交换的客户端，客户端不能任意指定其他用户作为行事方
+		if req.ActorToken != "" {
+			actorClaims, actorRecord, err := verifyExchangeToken(req.ActorToken, req.Client)
+			if err != nil {
+				return nil, errors.New("无效的actor_token")
+			}
+			if !exchangeTokenIssuedTo(actorClaims, actorRecord, client) {
+				s.auditTokenExchange(req, client, subjectClaims.UserID, mode, "failure", "actor_token未签发给请求交换的客户端",
+					map[string]interface{}{"subject_client_id": source, "actor_user_id": actorClaims.UserID})
+				return nil, errors.New("actor_token未签发给请求交换的客户端")
+			}
+			var actor models.User
+			if err := database.DB.First(&actor, actorClaims.UserID).Error; err != nil {
+				return nil, errors.New("actor用户不存在")
+			}
+			actorUserID = actor.ID
+			act = &utils.ActorClaim{Sub: actor.UUID, ClientID: client.ClientID}
+		} else {
+			act = &utils.ActorClaim{Sub: client.ClientID, ClientID: client.ClientID}
+		}
+	}
+
+	if err := checkClientScope(client, scope); err != nil {
+		return nil, err
 	}
 
-	// 验证客户端
-	var client models.OAuth2Client
-	if err := database.DB.Where("client_id = ? AND status = ?", clientID, "active").First(&client).Error; err != nil {
-		return nil, errors.New("无效的客户端")
+	// 保留主体令牌中已有的委托链
+	act.Act = subjectClaims.Act
+
+	audience := append(append([]string{}, req.Audience...), req.Resource...)
+	if len(audience) == 0 {
+		audience = []string{client.ClientID}
 	}
 
-	// 验证客户端密钥
-	if client.ClientSecret != clientSecret {
-		return nil, errors.New("客户端密钥错误")
+	var auth *utils.AuthContext
+	if mode == "delegate" && subjectClaims.AuthTime != 0 {
+		auth = &utils.AuthContext{AuthTime: time.Unix(subjectClaims.AuthTime, 0), AMR: subjectClaims.AMR, SessionID: subjectClaims.SID}
 	}
 
-	// 验证重定向URI
-	var redirectURIs []string
-	if err := json.Unmarshal([]byte(client.RedirectURIs), &redirectURIs); err != nil {
-		return nil, errors.New("客户端配置错误")
+	expiresIn := ClientAccessTokenLifetime(client)
+	accessTokenString, err := utils.GenerateAccessTokenWithOptions(user.ID, user.Username, user.Email, &utils.AccessTokenOptions{
+		Subject:   user.UUID,
+		ClientID:  client.ClientID,
+		Scope:     scope,
+		Audience:  audience,
+		Auth:      auth,
+		Act:       act,
+		Cnf:       cnf,
+		ExpiresIn: expiresIn,
+		Issuer:    req.Client.Issuer,
+	})
+	if err != nil {
+		return nil, &ServerError{Description: "生成访问令牌失败"}
 	}
 
-	redirectURIMatch := false
-	for _, uri := range redirectURIs {
-		if uri == redirectURI {
-			redirectURIMatch = true
-			break
-		}
+	accessToken := &models.AccessToken{
+		Token:          accessTokenString,
+		TokenHash:      utils.HashToken(accessTokenString),
+		OAuth2ClientID: client.ID,
+		ClientID:       client.ClientID,
+		UserID:         &user.ID,
+		Scope:          scope,
+		Audience:       strings.Join(audience, " "),
+		JKT:            confirmationJKT(cnf),
+		X5tS256:        confirmationX5tS256(cnf),
+		ExpiresAt:      time.Now().Add(expiresIn),
 	}
-	if !redirectURIMatch {
-		return nil, errors.New("重定向URI不匹配")
+	if err := database.DB.Create(accessToken).Error; err != nil {
+		return nil, &ServerError{Description: "保存访问令牌失败"}
 	}
 
-	// 验证PKCE（如果使用）
-	if authCode.CodeChallenge != "" {
-		if codeVerifier == "" {
-			return nil, errors.New("需要提供code_verifier")
-		}
-		// 这里应该验证code_verifier，简化处理
-	}
+	s.auditTokenExchange(req, client, subjectClaims.UserID, mode, "success", "令牌交换成功", map[string]interface{}{
+		"subject_client_id": source,
+		"target_user_id":    user.ID,
+		"actor":             act.Sub,
+		"actor_user_id":     actorUserID,
+		"audience":          audience,
+		"scope":             scope,
+	})
 
-	// 标记授权码为已使用
-	authCode.Used = true
-	database.DB.Save(&authCode)
+	return &TokenResponse{
+		AccessToken:     accessTokenString,
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType:       tokenTypeFor(cnf),
+		ExpiresIn:       int(expiresIn.Seconds()),
+		Scope:           scope,
+	}, nil
+}
 
-	// 获取用户信息
-	var user models.User
-	if err := database.DB.First(&user, authCode.UserID).Error; err != nil {
-		return nil, errors.New("用户不存在")
+// verifyExchangeToken 验证参与交换的访问令牌，若为OAuth2签发的令牌则同时返回其记录
+// 令牌绑定了DPoP密钥或客户端证书（cnf）时，令牌请求必须使用同一密钥的DPoP证明或同一证书的双向TLS连接，
+// 防止窃取的发送方约束令牌经交换变为不受约束的令牌
+func verifyExchangeToken(tokenString string, auth *ClientAuthentication) (*utils.JWTClaims, *models.AccessToken, error) {
+	claims, err := utils.ParseToken(tokenString)
+	if err != nil || claims.UserID == 0 {
+		return nil, nil, errors.New("无效的令牌")
 	}
-
-	// 生成访问令牌
-	accessTokenString, err := utils.GenerateAccessToken(authCode.UserID, user.Username, user.Email)
-	if err != nil {
-		return nil, errors.New("生成访问令牌失败")
+	if claims.Cnf != nil {
+		if claims.Cnf.JKT != "" && claims.Cnf.JKT != auth.DPoPKeyThumbprint {
+			return nil, nil, errors.New("令牌绑定的DPoP密钥与令牌请求不一致")
+		}
+		if claims.Cnf.X5tS256 != "" && claims.Cnf.X5tS256 != auth.certificateThumbprint() {
+			return nil, nil, errors.New("令牌绑定的客户端证书与令牌请求不一致")
+		}
 	}
 
-	// 生成刷新令牌
-	refreshTokenString, err := utils.GenerateRefreshToken(authCode.UserID)
-	if err != nil {
-		return nil, errors.New("生成刷新令牌失败")
+	var record models.AccessToken
+	if err := database.DB.Where("token_hash = ?", utils.HashToken(tokenString)).First(&record).Error; err != nil {
+		// 非OAuth2签发的令牌（如登录令牌）没有记录
+		return claims, nil, nil
 	}
-
-	// 生成ID Token（如果scope包含openid）
-	var idTokenString string
-	if containsScope(authCode.Scope, "openid") {
-		issuer := config.Cfg.App.URL
-		idTokenString, err = utils.GenerateIDToken(
-			user.ID,
-			user.Username,
-			user.Email,
-			user.Nickname,
-			user.EmailVerified,
-			"", // nonce应该从授权请求中获取
-			issuer,
-			clientID,
-		)
-		if err != nil {
-			return nil, errors.New("生成ID Token失败")
-		}
+	if record.Revoked || time.Now().After(record.ExpiresAt) {
+		return nil, nil, errors.New("令牌已失效")
 	}
 
-	// 保存访问令牌
-	accessToken := &models.AccessToken{
-		Token:          accessTokenString,
-		OAuth2ClientID: client.ID, // 外键
-		ClientID:       clientID,  // OAuth2 标准中的 client_id
-		UserID:         &authCode.UserID,
-		Scope:          authCode.Scope,
-		ExpiresAt:      time.Now().Add(config.Cfg.OAuth2.AccessTokenExpire),
+	return claims, &record, nil
+}
+
+// exchangeTokenIssuedTo 参与交换的令牌是否为本服务签发给该客户端、或以该客户端为受众的OAuth2访问令牌
+func exchangeTokenIssuedTo(claims *utils.JWTClaims, record *models.AccessToken, client *models.OAuth2Client) bool {
+	if record == nil {
+		return false
 	}
-	database.DB.Create(accessToken)
+	return record.ClientID == client.ClientID || claims.HasAudience(client.ClientID)
+}
 
-	// 保存刷新令牌
-	refreshToken := &models.RefreshToken{
-		UserID:    authCode.UserID,
-		Token:     refreshTokenString,
-		ClientID:  clientID,
-		ExpiresAt: time.Now().Add(config.Cfg.OAuth2.RefreshTokenExpire),
+// auditTokenExchange 记录令牌交换审计日志
+func (s *OAuth2Service) auditTokenExchange(req *TokenExchangeRequest, client *models.OAuth2Client, userID uint, mode, status, message string, metadata map[string]interface{}) {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata["mode"] = mode
+	if req.RequestedSubject != "" {
+		metadata["requested_subject"] = req.RequestedSubject
 	}
-	database.DB.Create(refreshToken)
 
-	return &TokenResponse{
-		AccessToken:  accessTokenString,
-		TokenType:    "Bearer",
-		ExpiresIn:    int(config.Cfg.OAuth2.AccessTokenExpire.Seconds()),
-		RefreshToken: refreshTokenString,
-		IDToken:      idTokenString,
-		Scope:        authCode.Scope,
-	}, nil
+	if err := NewAuditService().CreateAuditLog(&userID, "token_exchange", "oauth2_client", client.ClientID,
+		message, status, req.IP, req.UserAgent, metadata); err != nil {
+		utils.Warn("记录令牌交换审计日志失败: %v", err)
+	}
 }
 
 // containsScope 检查scope字符串是否包含指定的scope
@@ -287,12 +1466,19 @@ func (s *OAuth2Service) GetUserInfo(accessToken string) (map[string]interface{},
 	if err != nil {
 		return nil, errors.New("无效的访问令牌")
 	}
+	// 用户信息端点只接受受众包含用户信息端点的令牌（RFC 8707）
+	if !claims.HasAudience(utils.ClientAccessTokenAudience()) {
+		return nil, errors.New("访问令牌的受众不包含用户信息端点")
+	}
 
 	// 验证令牌是否被撤销
 	var token models.AccessToken
-	if err := database.DB.Where("token = ? AND revoked = ?", accessToken, false).First(&token).Error; err != nil {
+	if err := database.DB.Where("token_hash = ? AND revoked = ?", utils.HashToken(accessToken), false).First(&token).Error; err != nil {
 		return nil, errors.New("访问令牌已撤销")
 	}
+	if !clientIsActive(token.ClientID) {
+		return nil, errors.New("客户端已被暂停或撤销")
+	}
 
 	// 获取用户信息
 	var user models.User
@@ -300,57 +1486,487 @@ func (s *OAuth2Service) GetUserInfo(accessToken string) (map[string]interface{},
 		return nil, errors.New("用户不存在")
 	}
 
-	return map[string]interface{}{
-		"sub":                user.UUID,
-		"name":               user.Nickname,
-		"preferred_username": user.Username,
-		"email":              user.Email,
-		"email_verified":     user.EmailVerified,
-	}, nil
+	// 返回的声明由令牌的scope和授权时claims请求参数的userinfo成员决定
+	return NewScopeService().UserClaims(&user, token.Scope, DecodeClaimsRequest(token.Claims).UserInfoClaims()), nil
 }
 
-// CreateClient 创建OAuth2客户端
-func (s *OAuth2Service) CreateClient(userID uint, clientName, clientURI, logoURI string, redirectURIs []string) (*models.OAuth2Client, error) {
-	// 生成客户端ID和密钥
-	clientIDBytes := make([]byte, 16)
-	if _, err := rand.Read(clientIDBytes); err != nil {
-		return nil, errors.New("生成客户端ID失败")
+// supportedGrantTypes 客户端可注册的授权类型
+var supportedGrantTypes = map[string]bool{
+	"authorization_code":   true,
+	"refresh_token":        true,
+	"client_credentials":   true,
+	GrantTypeDeviceCode:    true,
+	GrantTypeTokenExchange: true,
+}
+
+// ClientRegistration 客户端注册元数据
+type ClientRegistration struct {
+	ClientName                        string
+	ClientURI                         string
+	LogoURI                           string
+	RedirectURIs                      []string
+	RequestURIs                       []string // 预先注册的请求对象地址（RFC 9101），必须使用HTTPS
+	BackchannelLogoutURI              string   // 后端通道登出通知地址，必须为不含片段的绝对地址
+	BackchannelLogoutSessionRequired  bool     // 要求登出令牌包含sid
+	FrontchannelLogoutURI             string   // 前端通道登出地址，来源必须与某个重定向URI一致
+	FrontchannelLogoutSessionRequired bool     // 要求前端通道登出地址携带iss和sid
+	ClientType                        string   // confidential（默认）或 public
+	TokenEndpointAuthMethod           string
+	RequirePKCE                       bool
+	RequirePAR                        bool                  // 强制要求通过PAR提交授权请求
+	RequireDPoP                       bool                  // 强制要求令牌绑定DPoP密钥
+	RequireMTLSBinding                bool                  // 令牌绑定双向TLS的客户端证书
+	GrantTypes                        []string              // 为空时默认为 authorization_code 和 refresh_token
+	JWKS                              string                // private_key_jwt、self_signed_tls_client_auth 使用的内联JWKS（JSON）
+	JWKSURI                           string                // private_key_jwt、self_signed_tls_client_auth 使用的JWKS地址
+	Scope                             string                // 客户端可申请的scope，空格分隔
+	TLSClientAuth                     TLSClientAuthIdentity // tls_client_auth 期望的证书身份
+	TokenLifetimes                    ClientTokenLifetimes  // 覆盖全局配置的令牌有效期
+}
+
+// ClientTokenLifetimes 客户端覆盖的令牌有效期（秒），0表示使用全局配置
+type ClientTokenLifetimes struct {
+	AccessToken          int `json:"access_token_lifetime,omitempty"`
+	IDToken              int `json:"id_token_lifetime,omitempty"`
+	RefreshTokenIdle     int `json:"refresh_token_idle_timeout,omitempty"`
+	RefreshTokenAbsolute int `json:"refresh_token_absolute_lifetime,omitempty"`
+}
+
+// validate 校验有效期：访问令牌和ID Token不能超过签名密钥的轮换重叠期，否则密钥退役后令牌无法验证
+func (l *ClientTokenLifetimes) validate() error {
+	if l.AccessToken < 0 || l.IDToken < 0 || l.RefreshTokenIdle < 0 || l.RefreshTokenAbsolute < 0 {
+		return errors.New("令牌有效期不能为负数")
 	}
-	clientID := base64.URLEncoding.EncodeToString(clientIDBytes)
+	overlap := config.Cfg.JWT.KeyRotationOverlap
+	if time.Duration(l.AccessToken)*time.Second > overlap || time.Duration(l.IDToken)*time.Second > overlap {
+		return errors.New("访问令牌和ID Token有效期不能超过签名密钥轮换重叠期")
+	}
+	if l.RefreshTokenIdle > 0 && l.RefreshTokenAbsolute > 0 && l.RefreshTokenIdle > l.RefreshTokenAbsolute {
+		return errors.New("刷新令牌闲置过期时间不能超过绝对有效期")
+	}
+	return nil
+}
+
+// ClientTokenLifetimesOf 客户端当前覆盖的令牌有效期
+func ClientTokenLifetimesOf(client *models.OAuth2Client) ClientTokenLifetimes {
+	return ClientTokenLifetimes{
+		AccessToken:          client.AccessTokenLifetime,
+		IDToken:              client.IDTokenLifetime,
+		RefreshTokenIdle:     client.RefreshTokenIdleTimeout,
+		RefreshTokenAbsolute: client.RefreshTokenAbsoluteLifetime,
+	}
+}
+
+// setClientTokenLifetimes 保存客户端覆盖的令牌有效期
+func setClientTokenLifetimes(client *models.OAuth2Client, lifetimes ClientTokenLifetimes) {
+	client.AccessTokenLifetime = lifetimes.AccessToken
+	client.IDTokenLifetime = lifetimes.IDToken
+	client.RefreshTokenIdleTimeout = lifetimes.RefreshTokenIdle
+	client.RefreshTokenAbsoluteLifetime = lifetimes.RefreshTokenAbsolute
+}
+
+// normalizeClientRegistration 校验客户端元数据并填充默认值
+// 公共客户端不签发密钥，认证方式固定为 none 且强制使用PKCE
+func normalizeClientRegistration(reg *ClientRegistration) error {
+	if reg.ClientType == "" {
+		reg.ClientType = "confidential"
+	}
+
+	switch reg.ClientType {
+	case "public":
+		if reg.TokenEndpointAuthMethod == "" {
+			reg.TokenEndpointAuthMethod = ClientAuthNone
+		}
+		if reg.TokenEndpointAuthMethod != ClientAuthNone {
+			return errors.New("公共客户端的token_endpoint_auth_method必须为none")
+		}
+		reg.RequirePKCE = true
+	case "confidential":
+		if reg.TokenEndpointAuthMethod == "" {
+			reg.TokenEndpointAuthMethod = ClientAuthSecretBasic
+		}
+		switch reg.TokenEndpointAuthMethod {
+		case ClientAuthSecretBasic, ClientAuthSecretPost, ClientAuthSecretJWT:
+		case ClientAuthPrivateKey, ClientAuthSelfSigned:
+			if err := validateClientJWKS(reg.JWKS, reg.JWKSURI); err != nil {
+				return err
+			}
+		case ClientAuthTLS:
+			if err := validateTLSClientAuthIdentity(&reg.TLSClientAuth); err != nil {
+				return err
+			}
+		default:
+			return errors.New("不支持的token_endpoint_auth_method")
+		}
+	default:
+		return errors.New("不支持的client_type")
+	}
+
+	for _, uri := range reg.RequestURIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || parsed.Host == "" {
+			return errors.New("request_uris格式错误")
+		}
+		if parsed.Scheme != "https" && !(parsed.Scheme == "http" && config.Cfg.Server.Mode == "debug") {
+			return errors.New("request_uris必须使用HTTPS")
+		}
+	}
+
+	if reg.BackchannelLogoutURI != "" {
+		if _, err := parseLogoutURI("backchannel_logout_uri", reg.BackchannelLogoutURI); err != nil {
+			return err
+		}
+	}
+	if reg.FrontchannelLogoutURI != "" {
+		parsed, err := parseLogoutURI("frontchannel_logout_uri", reg.FrontchannelLogoutURI)
+		if err != nil {
+			return err
+		}
+		sameOrigin := false
+		for _, uri := range reg.RedirectURIs {
+			if redirect, err := url.Parse(uri); err == nil && redirect.Scheme == parsed.Scheme && redirect.Host == parsed.Host {
+				sameOrigin = true
+				break
+			}
+		}
+		if !sameOrigin {
+			return errors.New("frontchannel_logout_uri的来源必须与某个redirect_uri一致")
+		}
+	}
+
+	// 校验授权类型
+	if len(reg.GrantTypes) == 0 {
+		reg.GrantTypes = []string{"authorization_code", "refresh_token"}
+	}
+	for _, gt := range reg.GrantTypes {
+		if !supportedGrantTypes[gt] {
+			return errors.New("不支持的授权类型: " + gt)
+		}
+		if (gt == "client_credentials" || gt == GrantTypeTokenExchange) && reg.ClientType == "public" {
+			return errors.New("公共客户端不支持" + gt + "授权类型")
+		}
+	}
+
+	return reg.TokenLifetimes.validate()
+}
+
+// parseLogoutURI 校验登出通知地址：不含片段的绝对地址，调试模式外必须使用HTTPS
+func parseLogoutURI(name, uri string) (*url.URL, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host == "" || parsed.Fragment != "" {
+		return nil, errors.New(name + "必须为不含片段的绝对地址")
+	}
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && config.Cfg.Server.Mode == "debug") {
+		return nil, errors.New(name + "必须使用HTTPS")
+	}
+	return parsed, nil
+}
+
+// validateClientJWKS 校验客户端注册的JWKS：jwks与jwks_uri二选一，jwks_uri必须使用HTTPS（调试模式下允许HTTP）
+func validateClientJWKS(jwks, jwksURI string) error {
+	if jwks == "" && jwksURI == "" {
+		return errors.New("该认证方式需要提供jwks或jwks_uri")
+	}
+	if jwks != "" && jwksURI != "" {
+		return errors.New("jwks与jwks_uri不能同时提供")
+	}
+	if jwks != "" {
+		if _, err := utils.ParseJWKSet([]byte(jwks)); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	parsed, err := url.Parse(jwksURI)
+	if err != nil || parsed.Host == "" {
+		return errors.New("jwks_uri格式错误")
+	}
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && config.Cfg.Server.Mode == "debug") {
+		return errors.New("jwks_uri必须使用HTTPS")
+	}
+	return nil
+}
+
+// responseTypesFor 根据授权类型推导响应类型：仅注册了授权码模式的客户端才使用code
+func responseTypesFor(grantTypes []string) []string {
+	for _, gt := range grantTypes {
+		if gt == "authorization_code" {
+			return []string{"code"}
+		}
+	}
+	return []string{}
+}
+
+// clientNeedsSecret 客户端的认证方式是否需要密钥
+func clientNeedsSecret(reg *ClientRegistration) bool {
+	switch reg.TokenEndpointAuthMethod {
+	case ClientAuthPrivateKey, ClientAuthTLS, ClientAuthSelfSigned:
+		return false
+	}
+	return reg.ClientType == "confidential"
+}
 
+// generateClientSecret 生成客户端密钥
+func generateClientSecret() (string, error) {
 	clientSecretBytes := make([]byte, 32)
 	if _, err := rand.Read(clientSecretBytes); err != nil {
-		return nil, errors.New("生成客户端密钥失败")
+		return "", errors.New("生成客户端密钥失败")
+	}
+	return base64.URLEncoding.EncodeToString(clientSecretBytes), nil
+}
+
+// issueClientSecret 为客户端签发新密钥并记录签发和过期时间，返回仅显示一次的明文
+// 只保存摘要；client_secret_jwt需要原文计算HMAC，额外加密保存
+func issueClientSecret(client *models.OAuth2Client) (string, error) {
+	secret, err := generateClientSecret()
+	if err != nil {
+		return "", err
+	}
+
+	encrypted := ""
+	if client.TokenEndpointAuthMethod == ClientAuthSecretJWT {
+		if encrypted, err = utils.EncryptSecret(secret); err != nil {
+			return "", errors.New("加密客户端密钥失败")
+		}
+	}
+
+	now := time.Now()
+	client.ClientSecretHash = utils.HashToken(secret)
+	client.ClientSecretEncrypted = encrypted
+	client.ClientSecretIssuedAt = &now
+	client.ClientSecretExpiresAt = nil
+	if lifetime := config.Cfg.OAuth2.ClientSecretLifetime; lifetime > 0 {
+		expiresAt := now.Add(lifetime)
+		client.ClientSecretExpiresAt = &expiresAt
+	}
+	return secret, nil
+}
+
+// clearClientSecret 清除客户端的当前密钥和轮换前的旧密钥
+func clearClientSecret(client *models.OAuth2Client) {
+	client.ClientSecretHash = ""
+	client.ClientSecretEncrypted = ""
+	client.ClientSecretIssuedAt = nil
+	client.ClientSecretExpiresAt = nil
+	client.PreviousSecretHash = ""
+	client.PreviousSecretEncrypted = ""
+	client.PreviousSecretExpiresAt = nil
+}
+
+// clientSecretActive 当前密钥是否存在且未过期
+func clientSecretActive(client *models.OAuth2Client, now time.Time) bool {
+	return client.ClientSecretHash != "" && (client.ClientSecretExpiresAt == nil || now.Before(*client.ClientSecretExpiresAt))
+}
+
+// previousSecretActive 轮换前的旧密钥是否仍在宽限期内
+func previousSecretActive(client *models.OAuth2Client, now time.Time) bool {
+	return client.PreviousSecretHash != "" && client.PreviousSecretExpiresAt != nil && now.Before(*client.PreviousSecretExpiresAt)
+}
+
+// verifyClientSecret 校验客户端密钥：匹配未过期的当前密钥，或宽限期内的旧密钥
+func verifyClientSecret(client *models.OAuth2Client, secret string) error {
+	if secret == "" {
+		return errors.New("客户端密钥错误")
+	}
+
+	now := time.Now()
+	hash := []byte(utils.HashToken(secret))
+	if client.ClientSecretHash != "" && subtle.ConstantTimeCompare(hash, []byte(client.ClientSecretHash)) == 1 {
+		if !clientSecretActive(client, now) {
+			return errors.New("客户端密钥已过期")
+		}
+		return nil
+	}
+	if previousSecretActive(client, now) && subtle.ConstantTimeCompare(hash, []byte(client.PreviousSecretHash)) == 1 {
+		return nil
+	}
+	return errors.New("客户端密钥错误")
+}
+
+// clientSecretKeys 以客户端密钥为HMAC密钥的验签候选（client_secret_jwt断言、HS*请求对象）
+// 包括未过期的当前密钥和宽限期内的旧密钥，未加密保存原文的客户端返回空
+func clientSecretKeys(client *models.OAuth2Client) []interface{} {
+	now := time.Now()
+	var keys []interface{}
+	if clientSecretActive(client, now) && client.ClientSecretEncrypted != "" {
+		if secret, err := utils.DecryptToken(client.ClientSecretEncrypted); err == nil {
+			keys = append(keys, []byte(secret))
+		}
+	}
+	if previousSecretActive(client, now) && client.PreviousSecretEncrypted != "" {
+		if secret, err := utils.DecryptToken(client.PreviousSecretEncrypted); err == nil {
+			keys = append(keys, []byte(secret))
+		}
+	}
+	return keys
+}
+
+// CreateClient 创建OAuth2客户端，同时返回客户端密钥明文（仅此一次，不需要密钥时为空）
+func (s *OAuth2Service) CreateClient(userID uint, reg *ClientRegistration) (*models.OAuth2Client, string, error) {
+	if err := normalizeClientRegistration(reg); err != nil {
+		return nil, "", err
+	}
+
+	// 生成客户端ID
+	clientIDBytes := make([]byte, 16)
+	if _, err := rand.Read(clientIDBytes); err != nil {
+		return nil, "", errors.New("生成客户端ID失败")
 	}
-	clientSecret := base64.URLEncoding.EncodeToString(clientSecretBytes)
+	clientID := base64.URLEncoding.EncodeToString(clientIDBytes)
 
 	// 序列化重定向URI
-	redirectURIsJSON, _ := json.Marshal(redirectURIs)
+	redirectURIsJSON, _ := json.Marshal(reg.RedirectURIs)
+	requestURIsJSON, _ := json.Marshal(reg.RequestURIs)
 
-	// 默认授权类型和响应类型
-	grantTypes := []string{"authorization_code", "refresh_token"}
-	responseTypes := []string{"code"}
-	grantTypesJSON, _ := json.Marshal(grantTypes)
-	responseTypesJSON, _ := json.Marshal(responseTypes)
+	grantTypesJSON, _ := json.Marshal(reg.GrantTypes)
+	responseTypesJSON, _ := json.Marshal(responseTypesFor(reg.GrantTypes))
 
 	client := &models.OAuth2Client{
-		UserID:        userID,
-		ClientID:      clientID,
-		ClientSecret:  clientSecret,
-		ClientName:    clientName,
-		ClientURI:     clientURI,
-		LogoURI:       logoURI,
-		RedirectURIs:  string(redirectURIsJSON),
-		GrantTypes:    string(grantTypesJSON),
-		ResponseTypes: string(responseTypesJSON),
-		Status:        "active",
+		UserID:                            userID,
+		ClientID:                          clientID,
+		ClientType:                        reg.ClientType,
+		TokenEndpointAuthMethod:           reg.TokenEndpointAuthMethod,
+		JWKS:                              reg.JWKS,
+		JWKSURI:                           reg.JWKSURI,
+		ClientName:                        reg.ClientName,
+		ClientURI:                         reg.ClientURI,
+		LogoURI:                           reg.LogoURI,
+		RedirectURIs:                      string(redirectURIsJSON),
+		RequestURIs:                       string(requestURIsJSON),
+		BackchannelLogoutURI:              reg.BackchannelLogoutURI,
+		BackchannelLogoutSessionRequired:  reg.BackchannelLogoutSessionRequired,
+		FrontchannelLogoutURI:             reg.FrontchannelLogoutURI,
+		FrontchannelLogoutSessionRequired: reg.FrontchannelLogoutSessionRequired,
+		GrantTypes:                        string(grantTypesJSON),
+		ResponseTypes:                     string(responseTypesJSON),
+		RequirePKCE:                       reg.RequirePKCE,
+		RequirePAR:                        reg.RequirePAR,
+		RequireDPoP:                       reg.RequireDPoP,
+		RequireMTLSBinding:                reg.RequireMTLSBinding,
+		Scope:                             reg.Scope,
+		Status:                            "active",
+	}
+	setClientTLSIdentity(client, reg)
+	setClientTokenLifetimes(client, reg.TokenLifetimes)
+
+	// private_key_jwt 和双向TLS客户端使用公钥或证书认证，不需要密钥
+	clientSecret := ""
+	if clientNeedsSecret(reg) {
+		var err error
+		if clientSecret, err = issueClientSecret(client); err != nil {
+			return nil, "", err
+		}
 	}
 
 	if err := database.DB.Create(client).Error; err != nil {
-		return nil, errors.New("创建客户端失败")
+		return nil, "", errors.New("创建客户端失败")
 	}
 
-	return client, nil
+	return client, clientSecret, nil
+}
+
+// UpdateClientMetadata 用新的元数据替换客户端配置
+// 认证方式由密钥切换为私钥时清除密钥；需要密钥但尚无可用密钥时签发新密钥并返回明文
+func (s *OAuth2Service) UpdateClientMetadata(client *models.OAuth2Client, reg *ClientRegistration) (string, error) {
+	if err := normalizeClientRegistration(reg); err != nil {
+		return "", err
+	}
+
+	redirectURIsJSON, _ := json.Marshal(reg.RedirectURIs)
+	requestURIsJSON, _ := json.Marshal(reg.RequestURIs)
+	grantTypesJSON, _ := json.Marshal(reg.GrantTypes)
+	responseTypesJSON, _ := json.Marshal(responseTypesFor(reg.GrantTypes))
+
+	client.ClientName = reg.ClientName
+	client.ClientURI = reg.ClientURI
+	client.LogoURI = reg.LogoURI
+	client.RedirectURIs = string(redirectURIsJSON)
+	client.RequestURIs = string(requestURIsJSON)
+	client.BackchannelLogoutURI = reg.BackchannelLogoutURI
+	client.BackchannelLogoutSessionRequired = reg.BackchannelLogoutSessionRequired
+	client.FrontchannelLogoutURI = reg.FrontchannelLogoutURI
+	client.FrontchannelLogoutSessionRequired = reg.FrontchannelLogoutSessionRequired
+	client.GrantTypes = string(grantTypesJSON)
+	client.ResponseTypes = string(responseTypesJSON)
+	client.ClientType = reg.ClientType
+	client.TokenEndpointAuthMethod = reg.TokenEndpointAuthMethod
+	client.RequirePKCE = reg.RequirePKCE
+	client.RequirePAR = reg.RequirePAR
+	client.RequireDPoP = reg.RequireDPoP
+	client.RequireMTLSBinding = reg.RequireMTLSBinding
+	setClientTLSIdentity(client, reg)
+	client.JWKS = reg.JWKS
+	client.JWKSURI = reg.JWKSURI
+	client.Scope = reg.Scope
+	setClientTokenLifetimes(client, reg.TokenLifetimes)
+
+	// 已有密钥只保存了摘要，切换为client_secret_jwt时无法取得原文，需要签发新密钥
+	newSecret := ""
+	if !clientNeedsSecret(reg) {
+		clearClientSecret(client)
+	} else if client.ClientSecretHash == "" || (reg.TokenEndpointAuthMethod == ClientAuthSecretJWT && client.ClientSecretEncrypted == "") {
+		var err error
+		if newSecret, err = issueClientSecret(client); err != nil {
+			return "", err
+		}
+		client.PreviousSecretHash = ""
+		client.PreviousSecretEncrypted = ""
+		client.PreviousSecretExpiresAt = nil
+	} else if reg.TokenEndpointAuthMethod != ClientAuthSecretJWT {
+		client.ClientSecretEncrypted = ""
+		client.PreviousSecretEncrypted = ""
+	}
+
+	if err := database.DB.Save(client).Error; err != nil {
+		return "", errors.New("更新客户端失败")
+	}
+
+	return newSecret, nil
+}
+
+// setClientTLSIdentity 保存tls_client_auth的证书身份，其他认证方式清空
+func setClientTLSIdentity(client *models.OAuth2Client, reg *ClientRegistration) {
+	identity := TLSClientAuthIdentity{}
+	if reg.TokenEndpointAuthMethod == ClientAuthTLS {
+		identity = reg.TLSClientAuth
+	}
+	client.TLSClientAuthSubjectDN = identity.SubjectDN
+	client.TLSClientAuthSANDNS = identity.SANDNS
+	client.TLSClientAuthSANURI = identity.SANURI
+	client.TLSClientAuthSANIP = identity.SANIP
+	client.TLSClientAuthSANEmail = identity.SANEmail
+}
+
+// ClientRedirectURIs 获取客户端注册的重定向URI
+func ClientRedirectURIs(client *models.OAuth2Client) []string {
+	var redirectURIs []string
+	if err := json.Unmarshal([]byte(client.RedirectURIs), &redirectURIs); err != nil {
+		return []string{}
+	}
+	return redirectURIs
+}
+
+// IsRegisteredRedirectURI redirect_uri是否与客户端注册的地址完全一致
+func IsRegisteredRedirectURI(client *models.OAuth2Client, redirectURI string) bool {
+	return redirectURI != "" && containsString(ClientRedirectURIs(client), redirectURI)
+}
+
+// ClientRequestURIs 获取客户端预先注册的请求对象地址
+func ClientRequestURIs(client *models.OAuth2Client) []string {
+	var requestURIs []string
+	if err := json.Unmarshal([]byte(client.RequestURIs), &requestURIs); err != nil {
+		return []string{}
+	}
+	return requestURIs
+}
+
+// ClientResponseTypes 获取客户端注册的响应类型
+func ClientResponseTypes(client *models.OAuth2Client) []string {
+	var responseTypes []string
+	if err := json.Unmarshal([]byte(client.ResponseTypes), &responseTypes); err != nil {
+		return []string{}
+	}
+	return responseTypes
 }
 
 // GetUserClients 获取用户的所有OAuth2客户端
@@ -364,6 +1980,117 @@ func (s *OAuth2Service) GetUserClients(userID uint) ([]models.OAuth2Client, erro
 	return clients, nil
 }
 
+// UpdateClient 客户端所有者更新客户端配置，已撤销的客户端不能修改
+func (s *OAuth2Service) UpdateClient(clientID string, userID uint, reg *ClientRegistration, ip, userAgent string) (*models.OAuth2Client, string, error) {
+	var client models.OAuth2Client
+	if err := database.DB.Where("client_id = ? AND user_id = ? AND status != ?", clientID, userID, "revoked").First(&client).Error; err != nil {
+		return nil, "", errors.New("客户端不存在")
+	}
+
+	newSecret, err := s.UpdateClientMetadata(&client, reg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := NewAuditService().CreateAuditLog(&userID, "client_update", "oauth2_client", client.ClientID, "更新客户端配置", "success", ip, userAgent, map[string]interface{}{
+		"secret_reissued": newSecret != "",
+	}); err != nil {
+		utils.Warn("记录客户端更新审计日志失败: %v", err)
+	}
+
+	return &client, newSecret, nil
+}
+
+// ClientSecretRotation 轮换客户端密钥的结果，新密钥明文仅返回一次
+type ClientSecretRotation struct {
+	ClientID                string     `json:"client_id"`
+	ClientSecret            string     `json:"client_secret"`
+	ClientSecretIssuedAt    *time.Time `json:"client_secret_issued_at"`
+	ClientSecretExpiresAt   *time.Time `json:"client_secret_expires_at"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+}
+
+// RotateClientSecret 轮换客户端密钥：签发新密钥，旧密钥在配置的宽限期内仍可使用，便于客户端平滑切换
+// 再次轮换时宽限期内的更早密钥立即失效
+func (s *OAuth2Service) RotateClientSecret(clientID string, userID uint, ip, userAgent string) (*ClientSecretRotation, error) {
+	var client models.OAuth2Client
+	if err := database.DB.Where("client_id = ? AND user_id = ? AND status = ?", clientID, userID, "active").First(&client).Error; err != nil {
+		return nil, errors.New("客户端不存在")
+	}
+	if client.ClientSecretHash == "" {
+		return nil, errors.New("该客户端不使用客户端密钥")
+	}
+
+	now := time.Now()
+	client.PreviousSecretHash = ""
+	client.PreviousSecretEncrypted = ""
+	client.PreviousSecretExpiresAt = nil
+	if grace := config.Cfg.OAuth2.ClientSecretRotationGrace; grace > 0 && clientSecretActive(&client, now) {
+		expiresAt := now.Add(grace)
+		if client.ClientSecretExpiresAt != nil && client.ClientSecretExpiresAt.Before(expiresAt) {
+			expiresAt = *client.ClientSecretExpiresAt
+		}
+		client.PreviousSecretHash = client.ClientSecretHash
+		client.PreviousSecretEncrypted = client.ClientSecretEncrypted
+		client.PreviousSecretExpiresAt = &expiresAt
+	}
+
+	secret, err := issueClientSecret(&client)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.DB.Save(&client).Error; err != nil {
+		return nil, errors.New("轮换客户端密钥失败")
+	}
+
+	if err := NewAuditService().CreateAuditLog(&userID, "client_secret_rotate", "oauth2_client", client.ClientID, "轮换客户端密钥", "success", ip, userAgent, map[string]interface{}{
+		"previous_secret_expires_at": client.PreviousSecretExpiresAt,
+	}); err != nil {
+		utils.Warn("记录客户端密钥轮换审计日志失败: %v", err)
+	}
+
+	return &ClientSecretRotation{
+		ClientID:                client.ClientID,
+		ClientSecret:            secret,
+		ClientSecretIssuedAt:    client.ClientSecretIssuedAt,
+		ClientSecretExpiresAt:   client.ClientSecretExpiresAt,
+		PreviousSecretExpiresAt: client.PreviousSecretExpiresAt,
+	}, nil
+}
+
+// MigratePlaintextClientSecrets 将早期版本明文保存的客户端密钥转换为摘要，启动时执行
+// 摘要为64位十六进制，早期生成的密钥为44位base64，以长度区分
+func (s *OAuth2Service) MigratePlaintextClientSecrets() error {
+	var clients []models.OAuth2Client
+	if err := database.DB.Unscoped().Where("client_secret <> '' AND LENGTH(client_secret) <> 64").Find(&clients).Error; err != nil {
+		return err
+	}
+
+	for i := range clients {
+		client := &clients[i]
+		secret := client.ClientSecretHash
+		updates := map[string]interface{}{
+			"client_secret":           utils.HashToken(secret),
+			"client_secret_issued_at": client.CreatedAt,
+		}
+		if client.TokenEndpointAuthMethod == ClientAuthSecretJWT {
+			encrypted, err := utils.EncryptSecret(secret)
+			if err != nil {
+				return err
+			}
+			updates["client_secret_encrypted"] = encrypted
+		}
+		if err := database.DB.Unscoped().Model(client).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(clients) > 0 {
+		utils.Info("已将%d个客户端的明文密钥转换为摘要", len(clients))
+	}
+	return nil
+}
+
 // RevokeClient 撤销客户端
 func (s *OAuth2Service) RevokeClient(clientID string, userID uint) error {
 	var client models.OAuth2Client
@@ -378,4 +2105,3 @@ func (s *OAuth2Service) RevokeClient(clientID string, userID uint) error {
 
 	return nil
 }
-
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"astro-pass/internal/config"
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestReauthenticationReasonRejectsForgedLoginRequest(t *testing.T) {
+	if config.Cfg == nil {
+		config.Load()
+	}
+
+	const clientID, redirectURI = "client", "https://rp.example.com/callback"
+	user := &models.User{Username: "alice"}
+	// 一小时前登录的会话
+	lastLogin := &utils.AuthContext{AuthTime: time.Now().Add(-time.Hour)}
+
+	valid, err := utils.GenerateLoginRequestToken(clientID, redirectURI)
+	if err != nil {
+		t.Fatalf("GenerateLoginRequestToken() error = %v", err)
+	}
+	otherClient, _ := utils.GenerateLoginRequestToken("other", redirectURI)
+	otherRedirect, _ := utils.GenerateLoginRequestToken(clientID, "https://evil.example.com/callback")
+	refreshToken, _ := utils.GenerateRefreshToken(1)
+
+	forgedClaims := jwt.MapClaims{
+		"client_id":    clientID,
+		"redirect_uri": redirectURI,
+		"iat":          1,
+		"exp":          time.Now().Add(time.Hour).Unix(),
+	}
+	forgedToken := jwt.NewWithClaims(jwt.SigningMethodHS256, forgedClaims)
+	forgedToken.Header["typ"] = utils.LoginRequestTokenType
+	forged, _ := forgedToken.SignedString([]byte("attacker-chosen-secret-at-least-32-bytes"))
+
+	tests := []struct {
+		name         string
+		loginRequest string
+		auth         *utils.AuthContext
+	}{
+		{"未要求重新登录", "", lastLogin},
+		{"客户端伪造的时间戳", "1", lastLogin},
+		{"使用其他密钥签名的凭据", forged, lastLogin},
+		{"签发给其他客户端的凭据", otherClient, lastLogin},
+		{"绑定其他redirect_uri的凭据", otherRedirect, lastLogin},
+		{"刷新令牌冒充凭据", refreshToken, lastLogin},
+		{"凭据签发前的登录", valid, lastLogin},
+	}
+
+	for _, prompt := range []struct{ prompt, maxAge string }{{"login", ""}, {"", "0"}} {
+		requirements, err := ParseAuthenticationRequirements(prompt.prompt, prompt.maxAge, "", "")
+		if err != nil {
+			t.Fatalf("ParseAuthenticationRequirements() error = %v", err)
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				loginRequestedAt := LoginRequestedAt(tt.loginRequest, clientID, redirectURI)
+				if reason := requirements.ReauthenticationReason(user, tt.auth, loginRequestedAt, time.Now()); reason == "" {
+					t.Errorf("prompt=%q max_age=%q 应要求重新登录", prompt.prompt, prompt.maxAge)
+				}
+			})
+		}
+
+		// 在服务端签发凭据之后完成的登录满足要求
+		relogin := &utils.AuthContext{AuthTime: time.Now().Add(time.Second)}
+		loginRequestedAt := LoginRequestedAt(valid, clientID, redirectURI)
+		if reason := requirements.ReauthenticationReason(user, relogin, loginRequestedAt, time.Now()); reason != "" {
+			t.Errorf("prompt=%q max_age=%q 重新登录后不应再要求登录: %s", prompt.prompt, prompt.maxAge, reason)
+		}
+	}
+}
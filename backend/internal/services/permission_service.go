@@ -172,6 +172,10 @@ func seedDefaultPolicies(enforcer *casbin.Enforcer) error {
 		{"admin", "role", "write"},
 		{"admin", "permission", "read"},
 		{"admin", "permission", "write"},
+		{"admin", "user", "impersonate"},
+		{"admin", "oauth2_client", "manage"},
+		{"admin", "signing_key", "manage"},
+		{"admin", "oauth2_scope", "manage"},
 	}
 
 	for _, policy := range defaultPolicies {
@@ -337,3 +341,41 @@ func (s *PermissionService) DeletePermission(permissionID uint) error {
 	return nil
 }
 
+
+// clientSubject 客户端在Casbin策略中的主体名称
+func clientSubject(clientID string) string {
+	return "client:" + clientID
+}
+
+// CheckClientPermission 检查OAuth2客户端的权限（如令牌交换策略）
+func (s *PermissionService) CheckClientPermission(clientID, resource, action string) (bool, error) {
+	return s.enforcer.Enforce(clientSubject(clientID), resource, action)
+}
+
+// GrantClientPermission 为OAuth2客户端授予权限
+func (s *PermissionService) GrantClientPermission(clientID, resource, action string) error {
+	if _, err := s.enforcer.AddPolicy(clientSubject(clientID), resource, action); err != nil {
+		return fmt.Errorf("添加客户端策略失败: %w", err)
+	}
+	return nil
+}
+
+// RevokeClientPermission 撤销OAuth2客户端的权限
+func (s *PermissionService) RevokeClientPermission(clientID, resource, action string) error {
+	if _, err := s.enforcer.RemovePolicy(clientSubject(clientID), resource, action); err != nil {
+		return fmt.Errorf("删除客户端策略失败: %w", err)
+	}
+	return nil
+}
+
+// GetClientPermissions 获取OAuth2客户端的权限列表
+func (s *PermissionService) GetClientPermissions(clientID string) []string {
+	policies := s.enforcer.GetPermissionsForUser(clientSubject(clientID))
+	permissions := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		if len(policy) >= 3 {
+			permissions = append(permissions, fmt.Sprintf("%s:%s", policy[1], policy[2]))
+		}
+	}
+	return permissions
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"astro-pass/internal/config"
+	"astro-pass/internal/database"
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+)
+
+// RequestURIPrefix PAR签发的request_uri前缀（RFC 9126 2.2节）
+const RequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// AuthorizationRequestParams 授权请求参数，推送授权请求时整体保存
+type AuthorizationRequestParams struct {
+	ResponseType        string   `json:"response_type"`
+	ClientID            string   `json:"client_id"`
+	RedirectURI         string   `json:"redirect_uri"`
+	Scope               string   `json:"scope,omitempty"`
+	State               string   `json:"state,omitempty"`
+	Nonce               string   `json:"nonce,omitempty"`
+	CodeChallenge       string   `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string   `json:"code_challenge_method,omitempty"`
+	ResponseMode        string   `json:"response_mode,omitempty"`
+	Resource            []string `json:"resource,omitempty"` // 资源指示（RFC 8707）
+	Claims              string   `json:"claims,omitempty"`   // OIDC claims请求参数（JSON）
+	Prompt              string   `json:"prompt,omitempty"`
+	MaxAge              string   `json:"max_age,omitempty"`
+	LoginHint           string   `json:"login_hint,omitempty"`
+	ACRValues           string   `json:"acr_values,omitempty"`
+}
+
+// PushedAuthorizationResponse 推送授权请求响应
+type PushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+type PushedAuthorizationService struct {
+	oauth2Service *OAuth2Service
+}
+
+func NewPushedAuthorizationService() *PushedAuthorizationService {
+	return &PushedAuthorizationService{
+		oauth2Service: NewOAuth2Service(),
+	}
+}
+
+// PushAuthorizationRequest 校验并保存已认证客户端推送的授权请求，返回一次性的request_uri
+func (s *PushedAuthorizationService) PushAuthorizationRequest(client *models.OAuth2Client, params *AuthorizationRequestParams) (*PushedAuthorizationResponse, error) {
+	// 请求体中的client_id必须与认证的客户端一致（RFC 9126 2.1节）
+	if params.ClientID != "" && params.ClientID != client.ClientID {
+		return nil, errors.New("client_id与认证的客户端不一致")
+	}
+	params.ClientID = client.ClientID
+
+	if params.ResponseType != "code" {
+		return nil, errors.New("不支持的response_type")
+	}
+	if !IsSupportedResponseMode(params.ResponseMode) {
+		return nil, errors.New("不支持的response_mode")
+	}
+	if err := CheckClientGrantType(client, "authorization_code"); err != nil {
+		return nil, err
+	}
+	if params.RedirectURI == "" {
+		return nil, errors.New("缺少redirect_uri参数")
+	}
+	if !containsString(ClientRedirectURIs(client), params.RedirectURI) {
+		return nil, errors.New("redirect_uri未在客户端中注册")
+	}
+
+	codeChallengeMethod, err := s.oauth2Service.ValidatePKCEChallenge(client, params.CodeChallenge, params.CodeChallengeMethod)
+	if err != nil {
+		return nil, err
+	}
+	params.CodeChallengeMethod = codeChallengeMethod
+
+	if params.Scope, err = ResolveClientScope(client, params.Scope); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateResourceIndicators(params.Resource); err != nil {
+		return nil, err
+	}
+	if _, err := ParseClaimsRequest(params.Claims, params.Scope); err != nil {
+		return nil, err
+	}
+	if _, err := ParseAuthenticationRequirements(params.Prompt, params.MaxAge, params.LoginHint, params.ACRValues); err != nil {
+		return nil, err
+	}
+
+	requestID, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, errors.New("生成request_uri失败")
+	}
+
+	parameters, _ := json.Marshal(params)
+	pushed := &models.PushedAuthorizationRequest{
+		RequestURI:     RequestURIPrefix + requestID,
+		OAuth2ClientID: client.ID,
+		ClientID:       client.ClientID,
+		Parameters:     string(parameters),
+		ExpiresAt:      time.Now().Add(config.Cfg.OAuth2.PARExpire),
+	}
+	if err := database.DB.Create(pushed).Error; err != nil {
+		return nil, errors.New("保存授权请求失败")
+	}
+
+	return &PushedAuthorizationResponse{
+		RequestURI: pushed.RequestURI,
+		ExpiresIn:  int(config.Cfg.OAuth2.PARExpire.Seconds()),
+	}, nil
+}
+
+// ResolveAuthorizationRequest 根据request_uri取出推送的授权请求参数
+func (s *PushedAuthorizationService) ResolveAuthorizationRequest(clientID, requestURI string) (*AuthorizationRequestParams, error) {
+	var pushed models.PushedAuthorizationRequest
+	if err := database.DB.Where("request_uri = ? AND used = ?", requestURI, false).First(&pushed).Error; err != nil {
+		return nil, errors.New("无效的request_uri")
+	}
+	if pushed.ClientID != clientID {
+		return nil, errors.New("request_uri不属于该客户端")
+	}
+	if time.Now().After(pushed.ExpiresAt) {
+		return nil, errors.New("request_uri已过期")
+	}
+
+	var params AuthorizationRequestParams
+	if err := json.Unmarshal([]byte(pushed.Parameters), &params); err != nil {
+		return nil, errors.New("授权请求参数格式错误")
+	}
+
+	return &params, nil
+}
+
+// ConsumeRequestURI 签发授权码前将request_uri标记为已使用，防止重复使用
+func (s *PushedAuthorizationService) ConsumeRequestURI(requestURI string) error {
+	result := database.DB.Model(&models.PushedAuthorizationRequest{}).
+		Where("request_uri = ? AND used = ? AND expires_at > ?", requestURI, false, time.Now()).
+		Update("used", true)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return errors.New("request_uri已失效")
+	}
+	return nil
+}
+
+// CleanupExpiredRequests 清理已过期的推送授权请求
+func (s *PushedAuthorizationService) CleanupExpiredRequests() error {
+	return database.DB.Where("expires_at < ?", time.Now()).Delete(&models.PushedAuthorizationRequest{}).Error
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 授权响应模式（response_mode），jwt系列为JARM（JWT Secured Authorization Response Mode）
+const (
+	ResponseModeQuery       = "query"
+	ResponseModeJWT         = "jwt"
+	ResponseModeQueryJWT    = "query.jwt"
+	ResponseModeFormPostJWT = "form_post.jwt"
+)
+
+// IsSupportedResponseMode 检查授权码流程是否支持该response_mode
+func IsSupportedResponseMode(responseMode string) bool {
+	return responseMode == "" || containsString(supportedResponseModes, responseMode)
+}
+
+// supportedResponseModes 授权端点支持的response_mode
+var supportedResponseModes = []string{ResponseModeQuery, ResponseModeJWT, ResponseModeQueryJWT, ResponseModeFormPostJWT}
+
+// requestObjectMaxSize 通过request_uri获取的请求对象的最大长度
+const requestObjectMaxSize = 64 << 10
+
+// requestObjectClient 获取请求对象使用的HTTP客户端
+var requestObjectClient = &http.Client{Timeout: 5 * time.Second}
+
+// RequestObjectClaims 请求对象中的授权参数（RFC 9101 4节）
+type RequestObjectClaims struct {
+	jwt.RegisteredClaims
+	ResponseType        string           `json:"response_type"`
+	ClientID            string           `json:"client_id"`
+	RedirectURI         string           `json:"redirect_uri"`
+	Scope               string           `json:"scope"`
+	State               string           `json:"state"`
+	Nonce               string           `json:"nonce"`
+	CodeChallenge       string           `json:"code_challenge"`
+	CodeChallengeMethod string           `json:"code_challenge_method"`
+	ResponseMode        string           `json:"response_mode"`
+	Resource            jwt.ClaimStrings `json:"resource"` // 单个字符串或数组（RFC 8707）
+	Claims              *ClaimsRequest   `json:"claims"`   // OIDC claims请求参数，请求对象中为JSON对象（OIDC Core 6.1节）
+	Prompt              string           `json:"prompt"`
+	MaxAge              *int             `json:"max_age"` // 请求对象中为JSON数字
+	LoginHint           string           `json:"login_hint"`
+	ACRValues           string           `json:"acr_values"`
+}
+
+type RequestObjectService struct{}
+
+func NewRequestObjectService() *RequestObjectService {
+	return &RequestObjectService{}
+}
+
+// IsPushedRequestURI request_uri是否为PAR签发的引用（其余视为请求对象的地址）
+func IsPushedRequestURI(requestURI string) bool {
+	return strings.HasPrefix(requestURI, RequestURIPrefix)
+}
+
+// ResolveRequestObject 获取并验证授权请求中以值（request）或引用（request_uri）传递的请求对象
+func (s *RequestObjectService) ResolveRequestObject(client *models.OAuth2Client, request, requestURI string) (*AuthorizationRequestParams, error) {
+	if request != "" && requestURI != "" {
+		return nil, errors.New("request与request_uri不能同时使用")
+	}
+
+	if requestURI != "" {
+		var err error
+		if request, err = s.fetchRequestObject(client, requestURI); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.ParseRequestObject(client, request)
+}
+
+// ParseRequestObject 使用客户端注册的密钥验证签名后的请求对象，并取出其中的授权参数
+// 按RFC 9101 6.3节，授权参数只取自请求对象，查询参数中的同名参数被忽略
+func (s *RequestObjectService) ParseRequestObject(client *models.OAuth2Client, requestObject string) (*AuthorizationRequestParams, error) {
+	keyCandidates, allowedAlgs, err := requestObjectKeys(client, requestObject)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &RequestObjectClaims{}
+	var verified bool
+	for _, key := range keyCandidates {
+		k := key
+		_, err := jwt.ParseWithClaims(requestObject, claims, func(token *jwt.Token) (interface{}, error) {
+			return k, nil
+		}, jwt.WithValidMethods(allowedAlgs))
+		if err == nil {
+			verified = true
+			break
+		}
+		claims = &RequestObjectClaims{}
+	}
+	if !verified {
+		return nil, errors.New("请求对象签名无效或已过期")
+	}
+
+	// client_id和iss（若存在）必须与发起请求的客户端一致
+	if claims.ClientID != client.ClientID {
+		return nil, errors.New("请求对象的client_id不匹配")
+	}
+	if claims.Issuer != "" && claims.Issuer != client.ClientID {
+		return nil, errors.New("请求对象的iss无效")
+	}
+
+	// aud（若存在）必须为本授权服务器的签发者
+	if len(claims.Audience) > 0 {
+		audienceValid := false
+		for _, aud := range claims.Audience {
+			if utils.IsIssuer(aud) {
+				audienceValid = true
+				break
+			}
+		}
+		if !audienceValid {
+			return nil, errors.New("请求对象的aud无效")
+		}
+	}
+
+	maxAge := ""
+	if claims.MaxAge != nil {
+		maxAge = strconv.Itoa(*claims.MaxAge)
+	}
+
+	return &AuthorizationRequestParams{
+		ResponseType:        claims.ResponseType,
+		ClientID:            claims.ClientID,
+		RedirectURI:         claims.RedirectURI,
+		Scope:               claims.Scope,
+		State:               claims.State,
+		Nonce:               claims.Nonce,
+		CodeChallenge:       claims.CodeChallenge,
+		CodeChallengeMethod: claims.CodeChallengeMethod,
+		ResponseMode:        claims.ResponseMode,
+		Resource:            claims.Resource,
+		Claims:              claims.Claims.Encode(),
+		Prompt:              claims.Prompt,
+		MaxAge:              maxAge,
+		LoginHint:           claims.LoginHint,
+		ACRValues:           claims.ACRValues,
+	}, nil
+}
+
+// requestObjectKeys 获取请求对象的验签密钥：优先使用客户端注册的公钥，其次使用client_secret_jwt客户端的密钥（HMAC）
+func requestObjectKeys(client *models.OAuth2Client, requestObject string) ([]interface{}, []string, error) {
+	if client.JWKS != "" || client.JWKSURI != "" {
+		keys, err := clientPublicKeys(client, jwtKeyID(requestObject), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		return keys, clientKeySigningAlgs, nil
+	}
+
+	// 客户端密钥只保存摘要，仅client_secret_jwt客户端加密保存了可用于HMAC的原文
+	if keys := clientSecretKeys(client); len(keys) > 0 {
+		return keys, clientSecretSigningAlgs, nil
+	}
+
+	return nil, nil, errors.New("客户端未注册可用于验证请求对象的密钥")
+}
+
+// fetchRequestObject 从客户端预先注册的request_uri获取请求对象（RFC 9101 5.2节）
+func (s *RequestObjectService) fetchRequestObject(client *models.OAuth2Client, requestURI string) (string, error) {
+	// 仅允许获取客户端注册过的地址，避免授权服务器被用于请求任意URL
+	if !containsString(ClientRequestURIs(client), requestURI) {
+		return "", errors.New("request_uri未在客户端中注册")
+	}
+
+	resp, err := requestObjectClient.Get(requestURI)
+	if err != nil {
+		return "", fmt.Errorf("获取请求对象失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("获取请求对象失败: HTTP %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, requestObjectMaxSize))
+	if err != nil {
+		return "", fmt.Errorf("读取请求对象失败: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
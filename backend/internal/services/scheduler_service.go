@@ -10,6 +10,10 @@ type SchedulerService struct {
 	backupService *BackupService
 	configService *SystemConfigService
 	sloService    *SLOService
+	oauth2Service *OAuth2Service
+	parService    *PushedAuthorizationService
+	dpopService   *DPoPService
+	keyService    *SigningKeyService
 	stopChan      chan bool
 }
 
@@ -18,6 +22,10 @@ func NewSchedulerService() *SchedulerService {
 		backupService: NewBackupService(),
 		configService: NewSystemConfigService(),
 		sloService:    NewSLOService(),
+		oauth2Service: NewOAuth2Service(),
+		parService:    NewPushedAuthorizationService(),
+		dpopService:   NewDPoPService(),
+		keyService:    NewSigningKeyService(),
 		stopChan:      make(chan bool),
 	}
 }
@@ -34,6 +42,12 @@ func (s *SchedulerService) Start() {
 
 	// 启动SSO会话清理任务
 	go s.cleanExpiredSSOSessionsTask()
+
+	// 启动OAuth2过期记录清理任务
+	go s.cleanExpiredOAuth2RecordsTask()
+
+	// 启动签名密钥轮换任务
+	go s.rotateSigningKeysTask()
 }
 
 // Stop 停止调度服务
@@ -125,6 +139,48 @@ func (s *SchedulerService) cleanExpiredSSOSessionsTask() {
 	}
 }
 
+// cleanExpiredOAuth2RecordsTask 清理过期的OAuth2防重放记录任务
+func (s *SchedulerService) cleanExpiredOAuth2RecordsTask() {
+	ticker := time.NewTicker(1 * time.Hour) // 每小时清理一次
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.oauth2Service.CleanupExpiredClientAssertions(); err != nil {
+				utils.Error("清理过期客户端断言记录失败: %v", err)
+			}
+			if err := s.parService.CleanupExpiredRequests(); err != nil {
+				utils.Error("清理过期推送授权请求失败: %v", err)
+			}
+			if err := s.dpopService.CleanupExpiredProofs(); err != nil {
+				utils.Error("清理过期DPoP证明记录失败: %v", err)
+			}
+
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// rotateSigningKeysTask 签名密钥轮换任务
+func (s *SchedulerService) rotateSigningKeysTask() {
+	ticker := time.NewTicker(1 * time.Hour) // 每小时检查一次
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.keyService.RotateIfDue(); err != nil {
+				utils.Error("轮换签名密钥失败: %v", err)
+			}
+
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
 // RunOnce 立即执行一次所有任务（用于测试）
 func (s *SchedulerService) RunOnce() {
 	utils.Info("手动执行定时任务...")
@@ -150,4 +206,24 @@ func (s *SchedulerService) RunOnce() {
 	} else {
 		utils.Info("清理过期SSO会话成功")
 	}
+
+	// 清理过期客户端断言记录
+	if err := s.oauth2Service.CleanupExpiredClientAssertions(); err != nil {
+		utils.Error("清理过期客户端断言记录失败: %v", err)
+	}
+
+	// 清理过期推送授权请求
+	if err := s.parService.CleanupExpiredRequests(); err != nil {
+		utils.Error("清理过期推送授权请求失败: %v", err)
+	}
+
+	// 清理过期DPoP证明记录
+	if err := s.dpopService.CleanupExpiredProofs(); err != nil {
+		utils.Error("清理过期DPoP证明记录失败: %v", err)
+	}
+
+	// 轮换签名密钥
+	if err := s.keyService.RotateIfDue(); err != nil {
+		utils.Error("轮换签名密钥失败: %v", err)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,673 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"astro-pass/internal/database"
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+	"gorm.io/gorm"
+)
+
+// scope敏感级别，同意页面据此提示用户
+const (
+	ScopeSensitivityLow    = "low"
+	ScopeSensitivityMedium = "medium"
+	ScopeSensitivityHigh   = "high"
+)
+
+// ScopeDefinition 授权范围的定义
+type ScopeDefinition struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"display_name"`
+	Description string   `json:"description"`
+	Sensitivity string   `json:"sensitivity"`
+	Claims      []string `json:"claims"`
+	BuiltIn     bool     `json:"built_in"`
+}
+
+// builtinScopes 内置scope（OIDC Core 5.4节），启动时补齐缺失的定义，已有定义不会被覆盖
+var builtinScopes = []ScopeDefinition{
+	{Name: "openid", DisplayName: "身份标识", Description: "访问您的基本身份信息", Sensitivity: ScopeSensitivityLow, Claims: []string{}},
+	{Name: "profile", DisplayName: "个人资料", Description: "访问您的个人资料（昵称、头像等）", Sensitivity: ScopeSensitivityLow,
+		Claims: []string{"name", "nickname", "preferred_username", "picture", "updated_at"}},
+	{Name: "email", DisplayName: "邮箱地址", Description: "访问您的邮箱地址", Sensitivity: ScopeSensitivityMedium,
+		Claims: []string{"email", "email_verified"}},
+	{Name: "phone", DisplayName: "手机号码", Description: "访问您的手机号码", Sensitivity: ScopeSensitivityHigh,
+		Claims: []string{"phone_number", "phone_number_verified"}},
+	{Name: "address", DisplayName: "地址信息", Description: "访问您的地址信息", Sensitivity: ScopeSensitivityHigh,
+		Claims: []string{"address"}},
+}
+
+// userClaimResolvers 可由scope释放的用户声明及其取值，返回nil表示用户没有该声明
+var userClaimResolvers = map[string]func(user *models.User) interface{}{
+	"name": func(user *models.User) interface{} {
+		if user.Nickname != "" {
+			return user.Nickname
+		}
+		return user.Username
+	},
+	"nickname":           func(user *models.User) interface{} { return nonEmpty(user.Nickname) },
+	"preferred_username": func(user *models.User) interface{} { return user.Username },
+	"picture":            func(user *models.User) interface{} { return nonEmpty(user.Avatar) },
+	"updated_at":         func(user *models.User) interface{} { return user.UpdatedAt.Unix() },
+	"email":              func(user *models.User) interface{} { return user.Email },
+	"email_verified":     func(user *models.User) interface{} { return user.EmailVerified },
+	"phone_number":       func(user *models.User) interface{} { return nonEmpty(user.PhoneNumber) },
+	"phone_number_verified": func(user *models.User) interface{} {
+		if user.PhoneNumber == "" {
+			return nil
+		}
+		return user.PhoneNumberVerified
+	},
+	"address": func(user *models.User) interface{} {
+		if user.Address == "" {
+			return nil
+		}
+		return map[string]string{"formatted": user.Address}
+	},
+	"roles": func(user *models.User) interface{} {
+		var roles []models.Role
+		if err := database.DB.Model(user).Association("Roles").Find(&roles); err != nil {
+			return nil
+		}
+		names := make([]string, 0, len(roles))
+		for _, role := range roles {
+			names = append(names, role.Name)
+		}
+		return names
+	},
+}
+
+// nonEmpty 空字符串视为没有该声明
+func nonEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// reservedClaimNames JWT注册声明和ID Token、访问令牌使用的声明，不能作为自定义用户声明
+var reservedClaimNames = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	"nonce": true, "auth_time": true, "amr": true, "acr": true, "azp": true, "at_hash": true, "c_hash": true,
+	"sid": true, "cnf": true, "client_id": true, "scope": true, "act": true,
+}
+
+// standardClaims 内置取值方式的用户声明（不含始终返回的sub）
+func standardClaims() []string {
+	claims := make([]string, 0, len(userClaimResolvers))
+	for claim := range userClaimResolvers {
+		claims = append(claims, claim)
+	}
+	sort.Strings(claims)
+	return claims
+}
+
+// validateCustomClaimName 校验自定义声明名称：不能与注册声明或内置用户声明重名
+func validateCustomClaimName(name string) error {
+	if name == "" || len(name) > 100 {
+		return errors.New("声明名称不能为空且不超过100个字符")
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.' || c == ':') {
+			return errors.New("声明名称包含非法字符: " + name)
+		}
+	}
+	if reservedClaimNames[name] {
+		return errors.New("声明名称为保留名称: " + name)
+	}
+	if _, ok := userClaimResolvers[name]; ok {
+		return errors.New("内置声明不能作为自定义声明: " + name)
+	}
+	return nil
+}
+
+// ClaimRequest claims请求参数中单个声明的请求（OIDC Core 5.5.1节），声明的值为null时表示按默认方式请求
+type ClaimRequest struct {
+	Essential bool          `json:"essential,omitempty"`
+	Value     interface{}   `json:"value,omitempty"`
+	Values    []interface{} `json:"values,omitempty"`
+}
+
+// Matches 声明的实际取值是否满足请求中的value或values约束
+func (r *ClaimRequest) Matches(value interface{}) bool {
+	if r == nil {
+		return true
+	}
+	if r.Value != nil {
+		return claimValueEqual(value, r.Value)
+	}
+	if len(r.Values) == 0 {
+		return true
+	}
+	for _, expected := range r.Values {
+		if claimValueEqual(value, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// claimValueEqual 按JSON编码比较声明值，避免整数与JSON数字类型不同造成误判
+func claimValueEqual(a, b interface{}) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
+
+// ClaimsRequest claims请求参数（OIDC Core 5.5节），分别请求用户信息端点和ID Token返回的声明
+type ClaimsRequest struct {
+	UserInfo map[string]*ClaimRequest `json:"userinfo,omitempty"`
+	IDToken  map[string]*ClaimRequest `json:"id_token,omitempty"`
+}
+
+// ParseClaimsRequest 解析claims请求参数，参数为空时返回nil；claims参数只能用于OpenID Connect请求
+func ParseClaimsRequest(raw, scope string) (*ClaimsRequest, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	if !containsScope(scope, "openid") {
+		return nil, errors.New("claims参数仅适用于scope包含openid的请求")
+	}
+
+	var req ClaimsRequest
+	if err := json.Unmarshal([]byte(raw), &req); err != nil {
+		return nil, errors.New("claims参数不是有效的JSON对象")
+	}
+	for _, member := range []map[string]*ClaimRequest{req.UserInfo, req.IDToken} {
+		for name := range member {
+			if name == "" {
+				return nil, errors.New("claims参数包含空的声明名称")
+			}
+		}
+	}
+	return &req, nil
+}
+
+// DecodeClaimsRequest 解析随授权码和令牌保存的claims请求参数，无法解析时视为未请求
+func DecodeClaimsRequest(stored string) *ClaimsRequest {
+	if stored == "" {
+		return nil
+	}
+	var req ClaimsRequest
+	if err := json.Unmarshal([]byte(stored), &req); err != nil {
+		utils.Warn("解析已保存的claims请求参数失败: %v", err)
+		return nil
+	}
+	return &req
+}
+
+// Encode 编码为JSON以便随授权码和令牌保存，未请求时返回空字符串
+func (r *ClaimsRequest) Encode() string {
+	if r == nil || (len(r.UserInfo) == 0 && len(r.IDToken) == 0) {
+		return ""
+	}
+	encoded, err := json.Marshal(r)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// IDTokenClaims ID Token成员请求的声明
+func (r *ClaimsRequest) IDTokenClaims() map[string]*ClaimRequest {
+	if r == nil {
+		return nil
+	}
+	return r.IDToken
+}
+
+// UserInfoClaims 用户信息端点成员请求的声明
+func (r *ClaimsRequest) UserInfoClaims() map[string]*ClaimRequest {
+	if r == nil {
+		return nil
+	}
+	return r.UserInfo
+}
+
+// RequestedClaim 同意页面展示的通过claims参数请求的声明
+type RequestedClaim struct {
+	Name      string `json:"name"`
+	Essential bool   `json:"essential"`
+}
+
+// CheckSubject 请求中指定了sub的取值时，必须与当前用户一致（OIDC Core 5.5.1节）
+func (r *ClaimsRequest) CheckSubject(subject string) error {
+	if r == nil {
+		return nil
+	}
+	for _, member := range []map[string]*ClaimRequest{r.UserInfo, r.IDToken} {
+		if !member["sub"].Matches(subject) {
+			return errors.New("请求的sub与当前登录用户不一致")
+		}
+	}
+	return nil
+}
+
+type ScopeService struct{}
+
+func NewScopeService() *ScopeService {
+	return &ScopeService{}
+}
+
+// EnsureBuiltinScopes 补齐缺失的内置scope
+func (s *ScopeService) EnsureBuiltinScopes() error {
+	for _, def := range builtinScopes {
+		var count int64
+		if err := database.DB.Model(&models.OAuth2Scope{}).Where("name = ?", def.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		claims, _ := json.Marshal(def.Claims)
+		if err := database.DB.Create(&models.OAuth2Scope{
+			Name:        def.Name,
+			DisplayName: def.DisplayName,
+			Description: def.Description,
+			Sensitivity: def.Sensitivity,
+			Claims:      string(claims),
+			BuiltIn:     true,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListScopes 列出全部scope定义
+func (s *ScopeService) ListScopes() ([]ScopeDefinition, error) {
+	var scopes []models.OAuth2Scope
+	if err := database.DB.Order("built_in DESC, name ASC").Find(&scopes).Error; err != nil {
+		return nil, err
+	}
+	defs := make([]ScopeDefinition, 0, len(scopes))
+	for i := range scopes {
+		defs = append(defs, scopeDefinitionOf(&scopes[i]))
+	}
+	return defs, nil
+}
+
+// GetScope 获取scope定义
+func (s *ScopeService) GetScope(name string) (*ScopeDefinition, error) {
+	var scope models.OAuth2Scope
+	if err := database.DB.Where("name = ?", name).First(&scope).Error; err != nil {
+		return nil, errors.New("scope不存在")
+	}
+	def := scopeDefinitionOf(&scope)
+	return &def, nil
+}
+
+// CreateScope 创建自定义scope
+func (s *ScopeService) CreateScope(def *ScopeDefinition, operatorID uint, ip, userAgent string) (*ScopeDefinition, error) {
+	if err := validateScopeDefinition(def); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	database.DB.Model(&models.OAuth2Scope{}).Where("name = ?", def.Name).Count(&count)
+	if count > 0 {
+		return nil, errors.New("scope已存在")
+	}
+
+	claims, _ := json.Marshal(def.Claims)
+	scope := &models.OAuth2Scope{
+		Name:        def.Name,
+		DisplayName: def.DisplayName,
+		Description: def.Description,
+		Sensitivity: def.Sensitivity,
+		Claims:      string(claims),
+	}
+	if err := database.DB.Create(scope).Error; err != nil {
+		return nil, errors.New("创建scope失败")
+	}
+
+	s.audit(operatorID, "scope_create", scope.Name, "创建授权范围", ip, userAgent, map[string]interface{}{
+		"claims": def.Claims,
+	})
+	created := scopeDefinitionOf(scope)
+	return &created, nil
+}
+
+// UpdateScope 更新scope的展示信息、敏感级别和释放的声明，scope名称不能修改
+func (s *ScopeService) UpdateScope(name string, def *ScopeDefinition, operatorID uint, ip, userAgent string) (*ScopeDefinition, error) {
+	var scope models.OAuth2Scope
+	if err := database.DB.Where("name = ?", name).First(&scope).Error; err != nil {
+		return nil, errors.New("scope不存在")
+	}
+
+	def.Name = scope.Name
+	if err := validateScopeDefinition(def); err != nil {
+		return nil, err
+	}
+
+	claims, _ := json.Marshal(def.Claims)
+	scope.DisplayName = def.DisplayName
+	scope.Description = def.Description
+	scope.Sensitivity = def.Sensitivity
+	scope.Claims = string(claims)
+	if err := database.DB.Save(&scope).Error; err != nil {
+		return nil, errors.New("更新scope失败")
+	}
+
+	s.audit(operatorID, "scope_update", scope.Name, "更新授权范围", ip, userAgent, map[string]interface{}{
+		"claims": def.Claims,
+	})
+	updated := scopeDefinitionOf(&scope)
+	return &updated, nil
+}
+
+// DeleteScope 删除自定义scope，内置scope不能删除
+func (s *ScopeService) DeleteScope(name string, operatorID uint, ip, userAgent string) error {
+	var scope models.OAuth2Scope
+	if err := database.DB.Where("name = ?", name).First(&scope).Error; err != nil {
+		return errors.New("scope不存在")
+	}
+	if scope.BuiltIn {
+		return errors.New("内置scope不能删除")
+	}
+
+	if err := database.DB.Delete(&scope).Error; err != nil {
+		return errors.New("删除scope失败")
+	}
+
+	s.audit(operatorID, "scope_delete", scope.Name, "删除授权范围", ip, userAgent, nil)
+	return nil
+}
+
+// DescribeScopes 同意页面展示的scope信息，未定义的scope使用通用描述
+func (s *ScopeService) DescribeScopes(scopeString string) []ScopeDefinition {
+	names := splitScopes(scopeString)
+	defined := s.findScopes(names)
+
+	result := make([]ScopeDefinition, 0, len(names))
+	for _, name := range names {
+		if def, ok := defined[name]; ok {
+			result = append(result, def)
+			continue
+		}
+		result = append(result, ScopeDefinition{
+			Name:        name,
+			DisplayName: name,
+			Description: "访问 " + name + " 权限",
+			Sensitivity: ScopeSensitivityLow,
+			Claims:      []string{},
+		})
+	}
+	return result
+}
+
+// SupportedClaims 可释放的全部用户声明：内置声明以及scope定义中引用的自定义声明（不含始终返回的sub）
+func (s *ScopeService) SupportedClaims() []string {
+	supported := s.supportedClaimSet()
+	claims := make([]string, 0, len(supported))
+	for claim := range supported {
+		claims = append(claims, claim)
+	}
+	sort.Strings(claims)
+	return claims
+}
+
+// supportedClaimSet 可释放的全部用户声明集合
+func (s *ScopeService) supportedClaimSet() map[string]bool {
+	supported := make(map[string]bool, len(userClaimResolvers))
+	for claim := range userClaimResolvers {
+		supported[claim] = true
+	}
+
+	var scopes []models.OAuth2Scope
+	if err := database.DB.Find(&scopes).Error; err != nil {
+		utils.Warn("查询scope定义失败: %v", err)
+		return supported
+	}
+	for i := range scopes {
+		for _, claim := range scopeDefinitionOf(&scopes[i]).Claims {
+			supported[claim] = true
+		}
+	}
+	return supported
+}
+
+// UserClaims 按scope和claims请求参数释放用户声明，sub始终返回（OIDC Core 5.3.2节）
+// requested 为claims请求参数中对应ID Token或用户信息端点的成员：其中可释放的声明一并返回，
+// 带有value或values约束的声明只在用户的实际取值满足约束时返回（OIDC Core 5.5.1节）
+func (s *ScopeService) UserClaims(user *models.User, scopeString string, requested map[string]*ClaimRequest) map[string]interface{} {
+	var names []string
+	seen := make(map[string]bool)
+	for _, def := range s.findScopes(splitScopes(scopeString)) {
+		for _, claim := range def.Claims {
+			if !seen[claim] {
+				seen[claim] = true
+				names = append(names, claim)
+			}
+		}
+	}
+	if len(requested) > 0 {
+		supported := s.supportedClaimSet()
+		for claim := range requested {
+			if supported[claim] && !seen[claim] {
+				seen[claim] = true
+				names = append(names, claim)
+			}
+		}
+	}
+
+	claims := resolveUserClaims(user, names)
+	for claim, req := range requested {
+		if value, ok := claims[claim]; ok && !req.Matches(value) {
+			delete(claims, claim)
+		}
+	}
+	claims["sub"] = user.UUID
+	return claims
+}
+
+// RequestedClaims claims请求参数中可释放的声明（不含sub），按名称排序，任一成员标记为必需即视为必需；
+// 同意页面据此向用户展示，用户同意的声明名称随授权同意记录保存
+func (s *ScopeService) RequestedClaims(req *ClaimsRequest) []RequestedClaim {
+	result := []RequestedClaim{}
+	if req == nil {
+		return result
+	}
+
+	supported := s.supportedClaimSet()
+	essential := make(map[string]bool)
+	for _, member := range []map[string]*ClaimRequest{req.UserInfo, req.IDToken} {
+		for name, claim := range member {
+			if !supported[name] {
+				continue
+			}
+			essential[name] = essential[name] || (claim != nil && claim.Essential)
+		}
+	}
+	for name, isEssential := range essential {
+		result = append(result, RequestedClaim{Name: name, Essential: isEssential})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// RequestedClaimNames claims请求参数中可释放的声明名称
+func (s *ScopeService) RequestedClaimNames(req *ClaimsRequest) []string {
+	claims := s.RequestedClaims(req)
+	names := make([]string, 0, len(claims))
+	for _, claim := range claims {
+		names = append(names, claim.Name)
+	}
+	return names
+}
+
+// resolveUserClaims 取出用户的声明值，内置声明取自用户资料，其余取自用户的自定义声明
+func resolveUserClaims(user *models.User, names []string) map[string]interface{} {
+	claims := make(map[string]interface{}, len(names))
+	var custom []string
+	for _, claim := range names {
+		resolve, ok := userClaimResolvers[claim]
+		if !ok {
+			custom = append(custom, claim)
+			continue
+		}
+		if value := resolve(user); value != nil {
+			claims[claim] = value
+		}
+	}
+	if len(custom) == 0 {
+		return claims
+	}
+
+	var records []models.UserClaim
+	if err := database.DB.Where("user_id = ? AND name IN ?", user.ID, custom).Find(&records).Error; err != nil {
+		utils.Warn("查询用户自定义声明失败: %v", err)
+		return claims
+	}
+	for _, record := range records {
+		var value interface{}
+		if err := json.Unmarshal([]byte(record.Value), &value); err == nil && value != nil {
+			claims[record.Name] = value
+		}
+	}
+	return claims
+}
+
+// GetUserCustomClaims 获取用户的全部自定义声明
+func (s *ScopeService) GetUserCustomClaims(userID uint) (map[string]interface{}, error) {
+	var records []models.UserClaim
+	if err := database.DB.Where("user_id = ?", userID).Order("name ASC").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	claims := make(map[string]interface{}, len(records))
+	for _, record := range records {
+		var value interface{}
+		if err := json.Unmarshal([]byte(record.Value), &value); err == nil {
+			claims[record.Name] = value
+		}
+	}
+	return claims, nil
+}
+
+// SetUserCustomClaims 以claims整体替换用户的自定义声明，值为null的声明被删除
+func (s *ScopeService) SetUserCustomClaims(userID uint, claims map[string]interface{}, operatorID uint, ip, userAgent string) (map[string]interface{}, error) {
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return nil, errors.New("用户不存在")
+	}
+
+	records := make([]models.UserClaim, 0, len(claims))
+	for name, value := range claims {
+		if err := validateCustomClaimName(name); err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, errors.New("声明值无法编码: " + name)
+		}
+		records = append(records, models.UserClaim{UserID: user.ID, Name: name, Value: string(encoded)})
+	}
+
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.UserClaim{}).Error; err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		return tx.Create(&records).Error
+	}); err != nil {
+		return nil, errors.New("保存用户声明失败")
+	}
+
+	names := make([]string, 0, len(records))
+	for _, record := range records {
+		names = append(names, record.Name)
+	}
+	sort.Strings(names)
+	if err := NewAuditService().CreateAuditLog(&operatorID, "user_claims_update", "user", user.UUID, "更新用户自定义声明", "success", ip, userAgent, map[string]interface{}{
+		"claims": names,
+	}); err != nil {
+		utils.Warn("记录用户声明审计日志失败: %v", err)
+	}
+	return s.GetUserCustomClaims(user.ID)
+}
+
+// findScopes 按名称查找已定义的scope
+func (s *ScopeService) findScopes(names []string) map[string]ScopeDefinition {
+	result := make(map[string]ScopeDefinition)
+	if len(names) == 0 {
+		return result
+	}
+
+	var scopes []models.OAuth2Scope
+	if err := database.DB.Where("name IN ?", names).Find(&scopes).Error; err != nil {
+		utils.Warn("查询scope定义失败: %v", err)
+		return result
+	}
+	for i := range scopes {
+		result[scopes[i].Name] = scopeDefinitionOf(&scopes[i])
+	}
+	return result
+}
+
+// audit 记录scope管理的审计日志
+func (s *ScopeService) audit(userID uint, action, name, message, ip, userAgent string, metadata map[string]interface{}) {
+	if err := NewAuditService().CreateAuditLog(&userID, action, "oauth2_scope", name, message, "success", ip, userAgent, metadata); err != nil {
+		utils.Warn("记录授权范围审计日志失败: %v", err)
+	}
+}
+
+// scopeDefinitionOf 将scope记录转换为定义
+func scopeDefinitionOf(scope *models.OAuth2Scope) ScopeDefinition {
+	claims := []string{}
+	if scope.Claims != "" {
+		_ = json.Unmarshal([]byte(scope.Claims), &claims)
+	}
+	return ScopeDefinition{
+		Name:        scope.Name,
+		DisplayName: scope.DisplayName,
+		Description: scope.Description,
+		Sensitivity: scope.Sensitivity,
+		Claims:      claims,
+		BuiltIn:     scope.BuiltIn,
+	}
+}
+
+// validateScopeDefinition 校验scope定义：名称必须符合scope-token语法（RFC 6749 3.3节），
+// 声明为内置用户声明或合法的自定义声明名称
+func validateScopeDefinition(def *ScopeDefinition) error {
+	if def.Name == "" {
+		return errors.New("scope名称不能为空")
+	}
+	for _, c := range def.Name {
+		if c < 0x21 || c > 0x7e || c == '"' || c == '\\' {
+			return errors.New("scope名称包含非法字符")
+		}
+	}
+
+	if def.Sensitivity == "" {
+		def.Sensitivity = ScopeSensitivityLow
+	}
+	switch def.Sensitivity {
+	case ScopeSensitivityLow, ScopeSensitivityMedium, ScopeSensitivityHigh:
+	default:
+		return errors.New("不支持的敏感级别")
+	}
+
+	if def.Claims == nil {
+		def.Claims = []string{}
+	}
+	for _, claim := range def.Claims {
+		if _, ok := userClaimResolvers[claim]; ok {
+			continue
+		}
+		if err := validateCustomClaimName(claim); err != nil {
+			return err
+		}
+	}
+	return nil
+}
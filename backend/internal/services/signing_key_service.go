@@ -0,0 +1,321 @@
+package services
+
+import (
+	"crypto"
+	"errors"
+	"os"
+	"time"
+
+	"astro-pass/internal/config"
+	"astro-pass/internal/database"
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+	"gorm.io/gorm"
+)
+
+// 签名密钥状态
+const (
+	SigningKeyStatusPending  = "pending"  // 已在JWKS中发布，到启用时间后开始签名
+	SigningKeyStatusActive   = "active"   // 当前签名密钥
+	SigningKeyStatusRetiring = "retiring" // 不再签名，保留到已签发的令牌过期
+	SigningKeyStatusRetired  = "retired"  // 已退役，不再发布和验签
+	SigningKeyStatusRevoked  = "revoked"  // 已撤销（如私钥泄露），立即停止验签
+)
+
+// legacyPrivateKeyFile 早期版本在工作目录生成的RSA私钥文件
+const legacyPrivateKeyFile = "private_key.pem"
+
+type SigningKeyService struct{}
+
+func NewSigningKeyService() *SigningKeyService {
+	return &SigningKeyService{}
+}
+
+// Init 启动时初始化签名密钥：密钥表为空时导入旧版密钥文件，确保存在可用密钥并加载密钥环
+func (s *SigningKeyService) Init() error {
+	var count int64
+	if err := database.DB.Model(&models.SigningKey{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		if err := s.importLegacyKey(); err != nil {
+			return err
+		}
+	}
+
+	utils.SetSigningKeyReloader(s.Reload)
+	if err := s.RotateIfDue(); err != nil {
+		return err
+	}
+
+	if _, err := utils.CurrentSigningKey(); err != nil {
+		// 已保存的密钥均无法使用（通常是JWT_SECRET被修改），立即启用新密钥
+		utils.Warn("没有可用的签名密钥，将生成新密钥")
+		now := time.Now()
+		key, err := s.createKey(config.Cfg.JWT.SigningAlg, SigningKeyStatusPending, now)
+		if err != nil {
+			return err
+		}
+		if err := s.activate(key, now); err != nil {
+			return err
+		}
+		return s.Reload()
+	}
+	return nil
+}
+
+// importLegacyKey 导入旧版private_key.pem，沿用原kid使已签发的令牌继续有效
+func (s *SigningKeyService) importLegacyKey() error {
+	data, err := os.ReadFile(legacyPrivateKeyFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	key, err := utils.ParsePrivateKeyPEM(data)
+	if err != nil {
+		return err
+	}
+	alg, err := utils.SigningKeyAlgorithm(key)
+	if err != nil {
+		return err
+	}
+	if _, err := s.saveKey(utils.LegacyRSAKeyID, alg, key, SigningKeyStatusActive, time.Now()); err != nil {
+		return err
+	}
+	utils.Info("已将%s导入签名密钥表，确认后可删除该文件", legacyPrivateKeyFile)
+	return nil
+}
+
+// createKey 生成并保存新的签名密钥，kid为公钥的JWK指纹
+func (s *SigningKeyService) createKey(alg, status string, activatesAt time.Time) (*models.SigningKey, error) {
+	key, err := utils.GenerateSigningKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	jwk, err := utils.NewPublicJWK(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	kid, err := jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	return s.saveKey(kid, alg, key, status, activatesAt)
+}
+
+// saveKey 加密私钥后保存签名密钥
+func (s *SigningKeyService) saveKey(kid, alg string, key crypto.Signer, status string, activatesAt time.Time) (*models.SigningKey, error) {
+	privatePEM, err := utils.MarshalPrivateKeyPEM(key)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := utils.EncryptSecret(privatePEM)
+	if err != nil {
+		return nil, errors.New("加密签名私钥失败")
+	}
+	publicPEM, err := utils.MarshalPublicKeyPEM(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	record := &models.SigningKey{
+		KID:         kid,
+		Algorithm:   alg,
+		PrivateKey:  encrypted,
+		PublicKey:   publicPEM,
+		Status:      status,
+		ActivatesAt: activatesAt,
+	}
+	if err := database.DB.Create(record).Error; err != nil {
+		return nil, errors.New("保存签名密钥失败")
+	}
+	return record, nil
+}
+
+// Reload 从数据库加载待启用、当前和退役中的密钥到内存密钥环
+func (s *SigningKeyService) Reload() error {
+	var records []models.SigningKey
+	if err := database.DB.Where("status IN ?", []string{SigningKeyStatusPending, SigningKeyStatusActive, SigningKeyStatusRetiring}).
+		Order("activates_at ASC").Find(&records).Error; err != nil {
+		return err
+	}
+
+	keys := make([]*utils.SigningKey, 0, len(records))
+	for _, record := range records {
+		privatePEM, err := utils.DecryptToken(record.PrivateKey)
+		if err != nil {
+			// 通常是JWT_SECRET被修改，无法解密已保存的私钥
+			utils.Error("解密签名密钥%s失败: %v", record.KID, err)
+			continue
+		}
+		key, err := utils.ParsePrivateKeyPEM([]byte(privatePEM))
+		if err != nil {
+			utils.Error("解析签名密钥%s失败: %v", record.KID, err)
+			continue
+		}
+		keys = append(keys, &utils.SigningKey{
+			KID:         record.KID,
+			Algorithm:   record.Algorithm,
+			PrivateKey:  key,
+			PublicKey:   key.Public(),
+			ActivatesAt: record.ActivatesAt,
+			RetireAt:    record.RetireAt,
+		})
+	}
+
+	utils.SetSigningKeys(keys)
+	return nil
+}
+
+// RotateIfDue 按计划轮换签名密钥，由定时任务每小时调用：
+// 1. 退役中的密钥超过保留期后标记为已退役；
+// 2. 到启用时间的待启用密钥成为当前密钥，原密钥进入退役期；
+// 3. 当前密钥临近轮换周期（或算法与配置不一致）时生成待启用密钥，提前一个重叠期在JWKS中发布，便于依赖方缓存
+func (s *SigningKeyService) RotateIfDue() error {
+	now := time.Now()
+	overlap := config.Cfg.JWT.KeyRotationOverlap
+
+	if err := database.DB.Model(&models.SigningKey{}).
+		Where("status = ? AND retire_at <= ?", SigningKeyStatusRetiring, now).
+		Update("status", SigningKeyStatusRetired).Error; err != nil {
+		return err
+	}
+
+	var pending models.SigningKey
+	err := database.DB.Where("status = ? AND activates_at <= ?", SigningKeyStatusPending, now).
+		Order("activates_at DESC").First(&pending).Error
+	if err == nil {
+		if err := s.activate(&pending, now); err != nil {
+			return err
+		}
+		utils.Info("签名密钥已轮换，当前kid: %s", pending.KID)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	var active models.SigningKey
+	err = database.DB.Where("status = ?", SigningKeyStatusActive).Order("activates_at DESC").First(&active).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 首次启动，立即启用新密钥
+		key, err := s.createKey(config.Cfg.JWT.SigningAlg, SigningKeyStatusActive, now)
+		if err != nil {
+			return err
+		}
+		utils.Info("已生成签名密钥，kid: %s", key.KID)
+		return s.Reload()
+	} else if err != nil {
+		return err
+	}
+
+	var pendingCount int64
+	if err := database.DB.Model(&models.SigningKey{}).Where("status = ?", SigningKeyStatusPending).Count(&pendingCount).Error; err != nil {
+		return err
+	}
+	due := active.ActivatesAt.Add(config.Cfg.JWT.KeyRotationInterval - overlap)
+	if pendingCount == 0 && (!now.Before(due) || active.Algorithm != config.Cfg.JWT.SigningAlg) {
+		key, err := s.createKey(config.Cfg.JWT.SigningAlg, SigningKeyStatusPending, now.Add(overlap))
+		if err != nil {
+			return err
+		}
+		utils.Info("已发布待启用的签名密钥，kid: %s，启用时间: %s", key.KID, key.ActivatesAt.Format(time.RFC3339))
+	}
+
+	return s.Reload()
+}
+
+// activate 将密钥设为当前签名密钥，原当前密钥进入退役期，保留到用它签发的令牌全部过期
+func (s *SigningKeyService) activate(key *models.SigningKey, now time.Time) error {
+	retireAt := now.Add(config.Cfg.JWT.KeyRotationOverlap)
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SigningKey{}).
+			Where("status = ? AND id <> ?", SigningKeyStatusActive, key.ID).
+			Updates(map[string]interface{}{"status": SigningKeyStatusRetiring, "retire_at": retireAt}).Error; err != nil {
+			return err
+		}
+		key.Status = SigningKeyStatusActive
+		key.ActivatesAt = now
+		return tx.Model(key).Updates(map[string]interface{}{"status": key.Status, "activates_at": key.ActivatesAt}).Error
+	})
+}
+
+// ForceRotate 立即轮换签名密钥：已有待启用密钥时提前启用，否则生成新密钥并立即启用
+// 立即启用的新密钥可能尚未被依赖方缓存，依赖方需在遇到未知kid时重新获取JWKS
+func (s *SigningKeyService) ForceRotate(operatorID uint, ip, userAgent string) (*models.SigningKey, error) {
+	now := time.Now()
+
+	var key models.SigningKey
+	err := database.DB.Where("status = ?", SigningKeyStatusPending).Order("activates_at ASC").First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		created, err := s.createKey(config.Cfg.JWT.SigningAlg, SigningKeyStatusPending, now)
+		if err != nil {
+			return nil, err
+		}
+		key = *created
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := s.activate(&key, now); err != nil {
+		return nil, errors.New("启用签名密钥失败")
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	s.audit(operatorID, "signing_key_rotate", key.KID, "手动轮换签名密钥", ip, userAgent, nil)
+	return &key, nil
+}
+
+// RevokeKey 撤销签名密钥（如私钥泄露），用它签发的令牌在本实例立即无法通过验证，
+// 其他实例在内存密钥环过期（30秒）重新加载后同样拒绝
+// 撤销当前签名密钥时立即启用新密钥
+func (s *SigningKeyService) RevokeKey(kid, reason string, operatorID uint, ip, userAgent string) error {
+	var key models.SigningKey
+	if err := database.DB.Where("kid = ?", kid).First(&key).Error; err != nil {
+		return errors.New("签名密钥不存在")
+	}
+	if key.Status == SigningKeyStatusRevoked {
+		return errors.New("签名密钥已撤销")
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&key).Updates(map[string]interface{}{
+		"status":         SigningKeyStatusRevoked,
+		"revoked_at":     now,
+		"revoked_reason": reason,
+	}).Error; err != nil {
+		return errors.New("撤销签名密钥失败")
+	}
+
+	if key.Status == SigningKeyStatusActive {
+		if _, err := s.ForceRotate(operatorID, ip, userAgent); err != nil {
+			return err
+		}
+	} else if err := s.Reload(); err != nil {
+		return err
+	}
+
+	s.audit(operatorID, "signing_key_revoke", kid, "撤销签名密钥", ip, userAgent, map[string]interface{}{
+		"reason": reason,
+	})
+	return nil
+}
+
+// ListKeys 列出全部签名密钥（不含私钥）
+func (s *SigningKeyService) ListKeys() ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	if err := database.DB.Order("activates_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// audit 记录签名密钥管理的审计日志
+func (s *SigningKeyService) audit(userID uint, action, kid, message, ip, userAgent string, metadata map[string]interface{}) {
+	if err := NewAuditService().CreateAuditLog(&userID, action, "signing_key", kid, message, "success", ip, userAgent, metadata); err != nil {
+		utils.Warn("记录签名密钥审计日志失败: %v", err)
+	}
+}
@@ -1,16 +1,17 @@
 package services
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"astro-pass/internal/database"
 	"astro-pass/internal/models"
 	"astro-pass/internal/utils"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type SLOService struct{}
@@ -50,6 +51,34 @@ func (s *SLOService) GetUserActiveSessions(userID uint) ([]models.SSOSession, er
 	return sessions, nil
 }
 
+// TrackClientSession 记录客户端参与的登录会话（sid），用户登出时据此向客户端发送登出通知
+// 同一登录会话内再次授权时只更新访问令牌和登出地址
+func (s *SLOService) TrackClientSession(userID uint, client *models.OAuth2Client, sid, accessToken string) error {
+	var session models.SSOSession
+	err := database.DB.Where("sid = ? AND client_id = ? AND status = ?", sid, client.ClientID, "active").
+		First(&session).Error
+	if err == nil {
+		return database.DB.Model(&session).Updates(map[string]interface{}{
+			"access_token": accessToken,
+			"logout_url":   client.BackchannelLogoutURI,
+		}).Error
+	}
+
+	session = models.SSOSession{
+		SessionID:   uuid.New().String(),
+		SID:         sid,
+		UserID:      userID,
+		ClientID:    client.ClientID,
+		AccessToken: accessToken,
+		LogoutURL:   client.BackchannelLogoutURI,
+		Status:      "active",
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return fmt.Errorf("创建SSO会话失败: %v", err)
+	}
+	return nil
+}
+
 // InitiateLogout 发起登出请求
 func (s *SLOService) InitiateLogout(sessionID, initiatorType string, initiatorID uint) (*models.LogoutRequest, error) {
 	// 获取会话信息
@@ -65,36 +94,152 @@ func (s *SLOService) InitiateLogout(sessionID, initiatorType string, initiatorID
 		return nil, fmt.Errorf("获取用户会话失败: %v", err)
 	}
 
-	// 创建登出请求
+	return s.startLogout(sessionID, session.UserID, sessions, initiatorType, initiatorID)
+}
+
+// LogoutSession 结束用户的一个登录会话（RP发起登出），sid为空时结束用户的全部会话
+// 除通知参与该会话的客户端外，同时撤销该次登录签发的刷新令牌；返回被结束的客户端会话，供登出页面发送前端通道通知
+func (s *SLOService) LogoutSession(userID uint, sid, initiatorType string, initiatorID uint) ([]models.SSOSession, error) {
+	if sid == "" {
+		sessions, err := s.GetUserActiveSessions(userID)
+		if err != nil || len(sessions) == 0 {
+			return nil, err
+		}
+		_, err = s.startLogout(sessions[0].SessionID, userID, sessions, initiatorType, initiatorID)
+		return sessions, err
+	}
+
+	var refreshTokens []string
+	database.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND session_id = ? AND client_id = ? AND revoked = ?", userID, sid, "", false).
+		Pluck("token", &refreshTokens)
+	if len(refreshTokens) > 0 {
+		database.DB.Model(&models.RefreshToken{}).Where("token IN ?", refreshTokens).Update("revoked", true)
+		database.DB.Model(&models.UserSession{}).Where("token IN ?", refreshTokens).Update("revoked", true)
+	}
+
+	var sessions []models.SSOSession
+	if err := database.DB.Where("user_id = ? AND sid = ? AND status = ?", userID, sid, "active").
+		Preload("Client").
+		Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("获取用户会话失败: %v", err)
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+
+	_, err := s.startLogout(sessions[0].SessionID, userID, sessions, initiatorType, initiatorID)
+	return sessions, err
+}
+
+// FrontchannelLogoutURLs 登出页面需要以iframe加载的客户端前端通道登出地址（OIDC Front-Channel Logout 3节）
+// 地址携带签发者iss和登录会话标识sid，客户端据此判断应结束的会话
+func (s *SLOService) FrontchannelLogoutURLs(sessions []models.SSOSession) []string {
+	issuer := utils.PrimaryIssuer()
+	seen := map[string]bool{}
+	urls := make([]string, 0, len(sessions))
+	for _, sess := range sessions {
+		logoutURI := sess.Client.FrontchannelLogoutURI
+		if logoutURI == "" {
+			continue
+		}
+		parsed, err := url.Parse(logoutURI)
+		if err != nil {
+			continue
+		}
+		if sess.SID != "" {
+			query := parsed.Query()
+			query.Set("iss", issuer)
+			query.Set("sid", sess.SID)
+			parsed.RawQuery = query.Encode()
+		}
+		if logoutURL := parsed.String(); !seen[logoutURL] {
+			seen[logoutURL] = true
+			urls = append(urls, logoutURL)
+		}
+	}
+	return urls
+}
+
+// SessionState 计算授权响应中的session_state（OIDC Session Management），浏览器状态为登录会话标识
+// 仅在请求openid scope且令牌携带登录会话标识时返回，否则为空
+func (s *SLOService) SessionState(clientID, redirectURI, scope, sid string) string {
+	if sid == "" || !containsScope(scope, "openid") {
+		return ""
+	}
+	sessionState, err := utils.SessionState(clientID, redirectURI, sid)
+	if err != nil {
+		return ""
+	}
+	return sessionState
+}
+
+// startLogout 创建登出请求：会话立即标记为已登出，
+// 注册了后端通道登出地址的客户端各收到一个登出令牌（OIDC Back-Channel Logout 2.5节），通知异步发送
+func (s *SLOService) startLogout(sessionID string, userID uint, sessions []models.SSOSession, initiatorType string, initiatorID uint) (*models.LogoutRequest, error) {
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("用户不存在")
+	}
+
 	requestID := uuid.New().String()
+	issuer := utils.PrimaryIssuer()
+	sessionIDs := make([]uint, 0, len(sessions))
+	notifications := make([]models.LogoutNotification, 0, len(sessions))
+	for _, sess := range sessions {
+		sessionIDs = append(sessionIDs, sess.ID)
+		if sess.Client.BackchannelLogoutURI == "" {
+			continue
+		}
+
+		logoutToken, err := utils.GenerateLogoutToken(issuer, user.UUID, sess.SID, sess.ClientID)
+		if err != nil {
+			utils.Error("生成登出令牌失败: %v", err)
+			continue
+		}
+		notifications = append(notifications, models.LogoutNotification{
+			RequestID:   requestID,
+			ClientID:    sess.ClientID,
+			LogoutURL:   sess.Client.BackchannelLogoutURI,
+			LogoutToken: logoutToken,
+			Status:      "pending",
+		})
+	}
+
 	logoutRequest := &models.LogoutRequest{
 		RequestID:     requestID,
 		SessionID:     sessionID,
 		InitiatorType: initiatorType,
 		InitiatorID:   initiatorID,
 		Status:        "pending",
-		TotalClients:  len(sessions),
+		TotalClients:  len(notifications),
 	}
-
-	if err := database.DB.Create(logoutRequest).Error; err != nil {
-		return nil, fmt.Errorf("创建登出请求失败: %v", err)
+	if len(notifications) == 0 {
+		logoutRequest.Status = "completed"
 	}
 
-	// 创建登出通知
-	for _, sess := range sessions {
-		if sess.LogoutURL != "" {
-			notification := &models.LogoutNotification{
-				RequestID: requestID,
-				ClientID:  sess.ClientID,
-				LogoutURL: sess.LogoutURL,
-				Status:    "pending",
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(logoutRequest).Error; err != nil {
+			return err
+		}
+		if len(notifications) > 0 {
+			if err := tx.Create(&notifications).Error; err != nil {
+				return err
 			}
-			database.DB.Create(notification)
 		}
+		if len(sessionIDs) > 0 {
+			return tx.Model(&models.SSOSession{}).Where("id IN ?", sessionIDs).Update("status", "logged_out").Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建登出请求失败: %v", err)
 	}
 
 	// 异步处理登出通知
-	go s.processLogoutNotifications(requestID)
+	if len(notifications) > 0 {
+		go s.processLogoutNotifications(requestID)
+	}
 
 	return logoutRequest, nil
 }
@@ -136,40 +281,25 @@ func (s *SLOService) processLogoutNotifications(requestID string) {
 			"completed_clients": completedCount,
 			"failed_clients":    failedCount,
 		})
-
-	// 标记所有相关会话为已登出
-	var logoutRequest models.LogoutRequest
-	if err := database.DB.Where("request_id = ?", requestID).First(&logoutRequest).Error; err == nil {
-		var session models.SSOSession
-		if err := database.DB.Where("session_id = ?", logoutRequest.SessionID).First(&session).Error; err == nil {
-			// 标记用户的所有会话为已登出
-			database.DB.Model(&models.SSOSession{}).
-				Where("user_id = ? AND status = ?", session.UserID, "active").
-				Update("status", "logged_out")
-		}
-	}
 }
 
-// sendLogoutNotification 发送登出通知
+// sendLogoutNotification 以表单参数logout_token向客户端的后端通道登出地址发送登出令牌（OIDC Back-Channel Logout 2.5节）
+// 客户端返回2xx视为成功，失败时按次数退避重试
 func (s *SLOService) sendLogoutNotification(notification *models.LogoutNotification) bool {
 	maxAttempts := 3
 	client := &http.Client{
 		Timeout: 10 * time.Second,
+		// 登出令牌只发送到注册的地址，不跟随重定向
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
 	}
+	form := url.Values{"logout_token": {notification.LogoutToken}}
 
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		// 准备请求数据
-		logoutData := map[string]interface{}{
-			"logout_request_id": notification.RequestID,
-			"client_id":         notification.ClientID,
-			"timestamp":         time.Now().Unix(),
-		}
-
-		jsonData, _ := json.Marshal(logoutData)
-		
 		// 发送POST请求
-		resp, err := client.Post(notification.LogoutURL, "application/json", bytes.NewBuffer(jsonData))
-		
+		resp, err := client.PostForm(notification.LogoutURL, form)
+
 		now := time.Now()
 		notification.LastAttemptAt = &now
 		notification.AttemptCount = attempt
@@ -187,11 +317,10 @@ func (s *SLOService) sendLogoutNotification(notification *models.LogoutNotificat
 		}
 
 		notification.ResponseCode = resp.StatusCode
-		
-		// 读取响应
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(resp.Body)
-		notification.ResponseBody = buf.String()
+
+		// 读取响应（只保留开头部分）
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		notification.ResponseBody = string(body)
 		resp.Body.Close()
 
 		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
@@ -206,7 +335,7 @@ func (s *SLOService) sendLogoutNotification(notification *models.LogoutNotificat
 			database.DB.Save(notification)
 			return false
 		}
-		
+
 		time.Sleep(time.Duration(attempt) * time.Second)
 	}
 
@@ -242,7 +371,7 @@ func (s *SLOService) CleanupExpiredSessions() error {
 	return nil
 }
 
-// RevokeUserSessions 撤销用户的所有会话
+// RevokeUserSessions 撤销用户的所有会话，参与任一会话的客户端都会收到登出通知
 func (s *SLOService) RevokeUserSessions(userID uint, initiatorType string, initiatorID uint) error {
 	// 获取用户的活跃会话
 	sessions, err := s.GetUserActiveSessions(userID)
@@ -254,13 +383,6 @@ func (s *SLOService) RevokeUserSessions(userID uint, initiatorType string, initi
 		return nil // 没有活跃会话
 	}
 
-	// 为每个会话发起登出
-	for _, session := range sessions {
-		_, err := s.InitiateLogout(session.SessionID, initiatorType, initiatorID)
-		if err != nil {
-			utils.Error("发起会话登出失败: %v", err)
-		}
-	}
-
-	return nil
-}
\ No newline at end of file
+	_, err = s.startLogout(sessions[0].SessionID, userID, sessions, initiatorType, initiatorID)
+	return err
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"testing"
+
+	"astro-pass/internal/config"
+	"astro-pass/internal/database"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB 使用内存SQLite数据库替换database.DB，并迁移测试用到的表
+func setupTestDB(t *testing.T, tables ...interface{}) {
+	t.Helper()
+
+	if config.Cfg == nil {
+		config.Load()
+	}
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("打开测试数据库失败: %v", err)
+	}
+	// 内存数据库每个连接相互独立，限制为单个连接
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("获取数据库连接失败: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatalf("迁移测试数据库失败: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		sqlDB.Close()
+	})
+}
@@ -1,11 +1,15 @@
 package services
 
 import (
+	"astro-pass/internal/config"
 	"astro-pass/internal/database"
 	"astro-pass/internal/models"
 	"astro-pass/internal/utils"
 	"errors"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type TokenService struct{}
@@ -19,9 +23,17 @@ func (s *TokenService) RefreshAccessToken(refreshTokenString string) (string, st
 	// 查找刷新令牌
 	var refreshToken models.RefreshToken
 	if err := database.DB.Where("token = ? AND revoked = ?", refreshTokenString, false).First(&refreshToken).Error; err != nil {
+		if s.DetectRefreshTokenReuse(refreshTokenString) {
+			return "", "", ErrRefreshTokenReused
+		}
 		return "", "", errors.New("无效的刷新令牌")
 	}
 
+	// OAuth2客户端的刷新令牌必须经过客户端认证，只能通过令牌端点刷新
+	if refreshToken.ClientID != "" {
+		return "", "", errors.New("该刷新令牌属于OAuth2客户端，请使用令牌端点刷新")
+	}
+
 	// 检查是否过期
 	if time.Now().After(refreshToken.ExpiresAt) {
 		return "", "", errors.New("刷新令牌已过期")
@@ -33,8 +45,9 @@ func (s *TokenService) RefreshAccessToken(refreshTokenString string) (string, st
 		return "", "", errors.New("用户不存在")
 	}
 
-	// 生成新的访问令牌
-	newAccessToken, err := utils.GenerateAccessToken(user.ID, user.Username, user.Email)
+	// 生成新的访问令牌（沿用原始认证上下文）
+	newAccessToken, err := utils.GenerateAccessTokenWithAuth(user.ID, user.UUID, user.Username, user.Email,
+		authContextOf(refreshToken.AuthTime, refreshToken.AuthMethods, refreshToken.SessionID))
 	if err != nil {
 		return "", "", errors.New("生成访问令牌失败")
 	}
@@ -45,34 +58,158 @@ func (s *TokenService) RefreshAccessToken(refreshTokenString string) (string, st
 		return "", "", errors.New("生成刷新令牌失败")
 	}
 
-	// 撤销旧的刷新令牌（令牌轮换）
-	refreshToken.Revoked = true
-	database.DB.Save(&refreshToken)
-
-	// 保存新的刷新令牌
-	newRefreshTokenModel := &models.RefreshToken{
-		UserID:    user.ID,
-		Token:     newRefreshToken,
-		ClientID:  refreshToken.ClientID,
-		ExpiresAt: time.Now().Add(7 * 24 * time.Hour),
+	// 令牌轮换
+	if err := s.RotateRefreshToken(&refreshToken, newRefreshToken, config.Cfg.JWT.RefreshTokenExpire); err != nil {
+		return "", "", err
 	}
-	database.DB.Create(newRefreshTokenModel)
 
 	return newAccessToken, newRefreshToken, nil
 }
 
-// RevokeToken 撤销令牌（RFC 7009）
-func (s *TokenService) RevokeToken(token string, tokenTypeHint string) error {
+// authContextOf 根据持久化的认证时间、认证方式和登录会话标识还原认证上下文
+func authContextOf(authTime *time.Time, authMethods, sessionID string) *utils.AuthContext {
+	if authTime == nil {
+		return nil
+	}
+	return &utils.AuthContext{
+		AuthTime:  *authTime,
+		AMR:       strings.Fields(authMethods),
+		SessionID: sessionID,
+	}
+}
+
+// ErrRefreshTokenReused 已轮换的刷新令牌被再次使用
+var ErrRefreshTokenReused = errors.New("检测到刷新令牌被重复使用，相关会话已全部撤销")
+
+// RotateRefreshToken 轮换刷新令牌：旧令牌标记为已轮换，新令牌继承令牌家族、客户端和授权范围
+// expire 为新令牌的闲置有效期，不会超过令牌家族的绝对过期时间
+func (s *TokenService) RotateRefreshToken(oldToken *models.RefreshToken, newTokenString string, expire time.Duration) error {
+	// 旧版本签发的令牌没有家族ID，从本次轮换开始建立家族
+	if oldToken.FamilyID == "" {
+		oldToken.FamilyID = utils.GenerateUUID()
+	}
+
+	// 仅在旧令牌仍未撤销时标记为已轮换：并发使用同一令牌时只有一个请求能完成轮换，其余视为重放
+	// 标记与创建新令牌在同一事务中完成，重放请求等到新令牌写入后再撤销令牌家族，新令牌不会漏撤
+	now := time.Now()
+	newToken := &models.RefreshToken{
+		UserID:            oldToken.UserID,
+		Token:             newTokenString,
+		ClientID:          oldToken.ClientID,
+		Scope:             oldToken.Scope,
+		FamilyID:          oldToken.FamilyID,
+		AuthTime:          oldToken.AuthTime,
+		AuthMethods:       oldToken.AuthMethods,
+		SessionID:         oldToken.SessionID,
+		Claims:            oldToken.Claims,
+		Resource:          oldToken.Resource,
+		JKT:               oldToken.JKT,
+		X5tS256:           oldToken.X5tS256,
+		ExpiresAt:         capExpiry(now.Add(expire), oldToken.AbsoluteExpiresAt),
+		AbsoluteExpiresAt: oldToken.AbsoluteExpiresAt,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked = ?", oldToken.ID, false).
+			Updates(map[string]interface{}{
+				"revoked":    true,
+				"rotated_at": now,
+				"family_id":  oldToken.FamilyID,
+			})
+		if result.Error != nil {
+			return errors.New("撤销旧刷新令牌失败")
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+		if err := tx.Create(newToken).Error; err != nil {
+			return errors.New("保存刷新令牌失败")
+		}
+		return nil
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if !s.DetectRefreshTokenReuse(oldToken.Token) {
+			if err := s.RevokeTokenFamily(oldToken); err != nil {
+				utils.Error("撤销刷新令牌家族失败: %v", err)
+			}
+		}
+		return ErrRefreshTokenReused
+	}
+	if err != nil {
+		return err
+	}
+	oldToken.Revoked = true
+	oldToken.RotatedAt = &now
+
+	// 会话跟随最新的刷新令牌
+	database.DB.Model(&models.UserSession{}).
+		Where("token = ? AND revoked = ?", oldToken.Token, false).
+		Update("token", newTokenString)
+
+	return nil
+}
+
+// DetectRefreshTokenReuse 检测已轮换的刷新令牌是否被重放
+// 发现重放时撤销整个令牌家族及关联会话，并向用户发送安全通知
+func (s *TokenService) DetectRefreshTokenReuse(refreshTokenString string) bool {
+	var refreshToken models.RefreshToken
+	if err := database.DB.Where("token = ? AND rotated_at IS NOT NULL", refreshTokenString).First(&refreshToken).Error; err != nil {
+		return false
+	}
+
+	if err := s.RevokeTokenFamily(&refreshToken); err != nil {
+		utils.Error("撤销刷新令牌家族失败: %v", err)
+	}
+
+	utils.Warn("检测到刷新令牌重放: user_id=%d family_id=%s", refreshToken.UserID, refreshToken.FamilyID)
+
+	NewNotificationService().NotifySecurityEvent(
+		refreshToken.UserID,
+		"refresh_token_reuse",
+		"检测到已失效的登录凭证被再次使用，相关会话已被强制下线。如非本人操作，请立即修改密码。",
+	)
+
+	userID := refreshToken.UserID
+	_ = NewAuditService().CreateAuditLog(&userID, "token_reuse", "refresh_token", refreshToken.FamilyID,
+		"检测到刷新令牌重放，已撤销令牌家族", "failed", "", "", map[string]interface{}{
+			"client_id": refreshToken.ClientID,
+			"family_id": refreshToken.FamilyID,
+		})
+
+	return true
+}
+
+// RevokeTokenFamily 撤销令牌家族中的所有刷新令牌及关联的用户会话
+func (s *TokenService) RevokeTokenFamily(refreshToken *models.RefreshToken) error {
+	if refreshToken.FamilyID == "" {
+		database.DB.Model(&models.UserSession{}).Where("token = ?", refreshToken.Token).Update("revoked", true)
+		return database.DB.Model(&models.RefreshToken{}).Where("id = ?", refreshToken.ID).Update("revoked", true).Error
+	}
+
+	familyTokens := database.DB.Model(&models.RefreshToken{}).Select("token").Where("family_id = ?", refreshToken.FamilyID)
+	if err := database.DB.Model(&models.UserSession{}).
+		Where("token IN (?)", familyTokens).
+		Update("revoked", true).Error; err != nil {
+		return err
+	}
+
+	return database.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ?", refreshToken.FamilyID).
+		Update("revoked", true).Error
+}
+
+// RevokeToken 撤销令牌（RFC 7009），只能撤销签发给clientID的令牌
+func (s *TokenService) RevokeToken(token string, tokenTypeHint string, clientID string) error {
 	if tokenTypeHint == "refresh_token" || tokenTypeHint == "" {
 		// 尝试撤销刷新令牌
 		var refreshToken models.RefreshToken
-		if err := database.DB.Where("token = ?", token).First(&refreshToken).Error; err == nil {
+		if err := database.DB.Where("token = ? AND client_id = ?", token, clientID).First(&refreshToken).Error; err == nil {
 			refreshToken.Revoked = true
 			database.DB.Save(&refreshToken)
 			
 			// 同时撤销相关的会话
 			database.DB.Model(&models.UserSession{}).
-				Where("refresh_token = ?", token).
+				Where("token = ?", token).
 				Update("revoked", true)
 			
 			return nil
@@ -82,7 +219,7 @@ func (s *TokenService) RevokeToken(token string, tokenTypeHint string) error {
 	if tokenTypeHint == "access_token" || tokenTypeHint == "" {
 		// 尝试撤销访问令牌
 		var accessToken models.AccessToken
-		if err := database.DB.Where("token = ?", token).First(&accessToken).Error; err == nil {
+		if err := database.DB.Where("token_hash = ? AND client_id = ?", utils.HashToken(token), clientID).First(&accessToken).Error; err == nil {
 			accessToken.Revoked = true
 			database.DB.Save(&accessToken)
 			return nil
@@ -99,20 +236,20 @@ func (s *TokenService) IntrospectToken(token string) (map[string]interface{}, er
 	if err == nil {
 		// 检查令牌是否被撤销
 		var accessToken models.AccessToken
-		if err := database.DB.Where("token = ? AND revoked = ?", token, false).First(&accessToken).Error; err != nil {
+		if err := database.DB.Where("token_hash = ? AND revoked = ?", utils.HashToken(token), false).First(&accessToken).Error; err != nil {
 			return map[string]interface{}{
 				"active": false,
 			}, nil
 		}
 
-		// 检查是否过期
-		if time.Now().After(accessToken.ExpiresAt) {
+		// 检查是否过期，以及签发令牌的客户端是否已被暂停或撤销
+		if time.Now().After(accessToken.ExpiresAt) || !clientIsActive(accessToken.ClientID) {
 			return map[string]interface{}{
 				"active": false,
 			}, nil
 		}
 
-		return map[string]interface{}{
+		result := map[string]interface{}{
 			"active":    true,
 			"scope":     accessToken.Scope,
 			"client_id": accessToken.ClientID,
@@ -120,8 +257,21 @@ func (s *TokenService) IntrospectToken(token string) (map[string]interface{}, er
 			"token_type": "Bearer",
 			"exp":       accessToken.ExpiresAt.Unix(),
 			"iat":       accessToken.CreatedAt.Unix(),
-			"sub":       claims.Username,
-		}, nil
+			"sub":       claims.Subject,
+			"iss":       claims.Issuer,
+			"jti":       claims.ID,
+		}
+		if audience := strings.Fields(accessToken.Audience); len(audience) > 0 {
+			result["aud"] = audience
+		}
+		// 发送方约束的令牌返回cnf，资源服务器据此校验持有证明（RFC 9449 6.2节、RFC 8705 3.2节）
+		if accessToken.JKT != "" {
+			result["token_type"] = "DPoP"
+		}
+		if cnf := introspectionConfirmation(accessToken.JKT, accessToken.X5tS256); cnf != nil {
+			result["cnf"] = cnf
+		}
+		return result, nil
 	}
 
 	// 尝试作为刷新令牌
@@ -132,8 +282,8 @@ func (s *TokenService) IntrospectToken(token string) (map[string]interface{}, er
 		}, nil
 	}
 
-	// 检查是否过期
-	if time.Now().After(refreshToken.ExpiresAt) {
+	// 检查是否过期，以及签发令牌的客户端是否已被暂停或撤销
+	if time.Now().After(refreshToken.ExpiresAt) || !clientIsActive(refreshToken.ClientID) {
 		return map[string]interface{}{
 			"active": false,
 		}, nil
@@ -147,13 +297,32 @@ func (s *TokenService) IntrospectToken(token string) (map[string]interface{}, er
 		}, nil
 	}
 
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"active":     true,
 		"client_id":  refreshToken.ClientID,
 		"username":   user.Username,
 		"token_type": "refresh_token",
 		"exp":        refreshToken.ExpiresAt.Unix(),
 		"iat":        refreshToken.CreatedAt.Unix(),
-		"sub":        user.Username,
-	}, nil
+		"sub":        user.UUID, // 与访问令牌一致，使用用户UUID作为主体标识
+	}
+	if cnf := introspectionConfirmation(refreshToken.JKT, refreshToken.X5tS256); cnf != nil {
+		result["cnf"] = cnf
+	}
+	return result, nil
+}
+
+// introspectionConfirmation 组装内省响应中的cnf声明，令牌未绑定任何密钥时返回nil
+func introspectionConfirmation(jkt, x5tS256 string) map[string]interface{} {
+	cnf := map[string]interface{}{}
+	if jkt != "" {
+		cnf["jkt"] = jkt
+	}
+	if x5tS256 != "" {
+		cnf["x5t#S256"] = x5tS256
+	}
+	if len(cnf) == 0 {
+		return nil
+	}
+	return cnf
 }
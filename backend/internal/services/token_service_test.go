@@ -0,0 +1,255 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"astro-pass/internal/database"
+	"astro-pass/internal/models"
+	"astro-pass/internal/utils"
+)
+
+// setupRefreshTokenTest 创建用户、刷新令牌及其会话
+func setupRefreshTokenTest(t *testing.T) *models.RefreshToken {
+	t.Helper()
+	setupTestDB(t, &models.User{}, &models.RefreshToken{}, &models.UserSession{}, &models.Notification{}, &models.AuditLog{})
+
+	user := &models.User{UUID: utils.GenerateUUID(), Username: "alice", Email: "alice@example.com", PasswordHash: "x"}
+	if err := database.DB.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+
+	refreshToken := &models.RefreshToken{
+		UserID:    user.ID,
+		Token:     "refresh-old",
+		ClientID:  "client",
+		Scope:     "openid profile",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := database.DB.Create(refreshToken).Error; err != nil {
+		t.Fatalf("创建刷新令牌失败: %v", err)
+	}
+	session := &models.UserSession{
+		UserID:       user.ID,
+		Token:        refreshToken.Token,
+		LastActivity: time.Now(),
+		ExpiresAt:    refreshToken.ExpiresAt,
+	}
+	if err := database.DB.Create(session).Error; err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	return refreshToken
+}
+
+// loadRefreshToken 按令牌值重新读取刷新令牌
+func loadRefreshToken(t *testing.T, token string) *models.RefreshToken {
+	t.Helper()
+	var refreshToken models.RefreshToken
+	if err := database.DB.Where("token = ?", token).First(&refreshToken).Error; err != nil {
+		t.Fatalf("查询刷新令牌%s失败: %v", token, err)
+	}
+	return &refreshToken
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	oldToken := setupRefreshTokenTest(t)
+	service := NewTokenService()
+
+	if err := service.RotateRefreshToken(oldToken, "refresh-new", time.Hour); err != nil {
+		t.Fatalf("RotateRefreshToken() error = %v", err)
+	}
+
+	old := loadRefreshToken(t, "refresh-old")
+	if !old.Revoked || old.RotatedAt == nil {
+		t.Errorf("旧令牌应标记为已轮换: revoked=%v rotated_at=%v", old.Revoked, old.RotatedAt)
+	}
+	newToken := loadRefreshToken(t, "refresh-new")
+	if newToken.Revoked {
+		t.Error("新令牌不应被撤销")
+	}
+	if newToken.FamilyID == "" || newToken.FamilyID != old.FamilyID {
+		t.Errorf("新令牌应继承令牌家族: old=%q new=%q", old.FamilyID, newToken.FamilyID)
+	}
+	if newToken.ClientID != old.ClientID || newToken.Scope != old.Scope || newToken.UserID != old.UserID {
+		t.Error("新令牌应继承客户端、授权范围和用户")
+	}
+
+	var session models.UserSession
+	if err := database.DB.Where("user_id = ?", old.UserID).First(&session).Error; err != nil {
+		t.Fatalf("查询会话失败: %v", err)
+	}
+	if session.Token != "refresh-new" {
+		t.Errorf("会话应跟随最新的刷新令牌: %s", session.Token)
+	}
+}
+
+func TestRotateRefreshTokenReuse(t *testing.T) {
+	oldToken := setupRefreshTokenTest(t)
+	service := NewTokenService()
+
+	// 重放前读取的旧令牌副本，模拟攻击者持有的已轮换令牌
+	stale := *oldToken
+	if err := service.RotateRefreshToken(oldToken, "refresh-new", time.Hour); err != nil {
+		t.Fatalf("RotateRefreshToken() error = %v", err)
+	}
+
+	if err := service.RotateRefreshToken(&stale, "refresh-replayed", time.Hour); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("重放已轮换的令牌应返回ErrRefreshTokenReused, got %v", err)
+	}
+
+	// 整个令牌家族及关联会话被撤销，重放不应产生新令牌
+	if newToken := loadRefreshToken(t, "refresh-new"); !newToken.Revoked {
+		t.Error("检测到重放后应撤销令牌家族中的最新令牌")
+	}
+	var count int64
+	database.DB.Model(&models.RefreshToken{}).Where("token = ?", "refresh-replayed").Count(&count)
+	if count != 0 {
+		t.Error("重放不应签发新的刷新令牌")
+	}
+	var session models.UserSession
+	if err := database.DB.Where("user_id = ?", oldToken.UserID).First(&session).Error; err != nil {
+		t.Fatalf("查询会话失败: %v", err)
+	}
+	if !session.Revoked {
+		t.Error("检测到重放后应撤销关联会话")
+	}
+
+	var notifications int64
+	database.DB.Model(&models.Notification{}).Where("user_id = ?", oldToken.UserID).Count(&notifications)
+	if notifications == 0 {
+		t.Error("检测到重放后应通知用户")
+	}
+}
+
+func TestRotateRefreshTokenConcurrent(t *testing.T) {
+	oldToken := setupRefreshTokenTest(t)
+	service := NewTokenService()
+
+	// 两个请求在轮换前读取到同一个未撤销的令牌，只能有一个完成轮换
+	const requests = 2
+	var wg sync.WaitGroup
+	errs := make([]error, requests)
+	for i := 0; i < requests; i++ {
+		copied := *oldToken
+		wg.Add(1)
+		go func(i int, token *models.RefreshToken) {
+			defer wg.Done()
+			errs[i] = service.RotateRefreshToken(token, []string{"refresh-a", "refresh-b"}[i], time.Hour)
+		}(i, &copied)
+	}
+	wg.Wait()
+
+	succeeded, reused := 0, 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrRefreshTokenReused):
+			reused++
+		default:
+			t.Fatalf("RotateRefreshToken() unexpected error = %v", err)
+		}
+	}
+	if succeeded != 1 || reused != 1 {
+		t.Fatalf("并发轮换应恰有一个成功、一个视为重放: succeeded=%d reused=%d", succeeded, reused)
+	}
+
+	var active int64
+	database.DB.Model(&models.RefreshToken{}).Where("revoked = ?", false).Count(&active)
+	if active != 0 {
+		t.Errorf("检测到重放后令牌家族应全部撤销, 仍有%d个有效令牌", active)
+	}
+}
+
+func TestDetectRefreshTokenReuse(t *testing.T) {
+	oldToken := setupRefreshTokenTest(t)
+	service := NewTokenService()
+
+	if service.DetectRefreshTokenReuse(oldToken.Token) {
+		t.Error("未轮换的令牌不应视为重放")
+	}
+	if service.DetectRefreshTokenReuse("unknown") {
+		t.Error("不存在的令牌不应视为重放")
+	}
+
+	if err := service.RotateRefreshToken(oldToken, "refresh-new", time.Hour); err != nil {
+		t.Fatalf("RotateRefreshToken() error = %v", err)
+	}
+	if !service.DetectRefreshTokenReuse(oldToken.Token) {
+		t.Error("已轮换的令牌再次使用应视为重放")
+	}
+	if newToken := loadRefreshToken(t, "refresh-new"); !newToken.Revoked {
+		t.Error("检测到重放后应撤销令牌家族")
+	}
+}
+
+func TestIntrospectPersistedAccessToken(t *testing.T) {
+	setupTestDB(t, &models.User{}, &models.OAuth2Client{}, &models.AccessToken{}, &models.SigningKey{}, &models.AuditLog{})
+	if err := NewSigningKeyService().Init(); err != nil {
+		t.Fatalf("初始化签名密钥失败: %v", err)
+	}
+
+	secret, _ := utils.GenerateRandomToken(32)
+	client := &models.OAuth2Client{
+		ClientID:                "service",
+		ClientSecretHash:        utils.HashToken(secret),
+		ClientName:              "service",
+		RedirectURIs:            "[]",
+		GrantTypes:              `["client_credentials"]`,
+		ResponseTypes:           "[]",
+		TokenEndpointAuthMethod: ClientAuthSecretBasic,
+		Scope:                   "read write",
+		Status:                  "active",
+	}
+	if err := database.DB.Create(client).Error; err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+
+	// 通过令牌端点的客户端凭证模式签发并保存访问令牌
+	accessToken, err := NewOAuth2Service().ClientCredentialsGrant(&ClientAuthentication{
+		ClientID:     client.ClientID,
+		ClientSecret: secret,
+	}, "read", nil)
+	if err != nil {
+		t.Fatalf("ClientCredentialsGrant() error = %v", err)
+	}
+
+	// 保存的是完整的JWT原文，按摘要可以找回
+	var stored models.AccessToken
+	if err := database.DB.Where("token_hash = ?", utils.HashToken(accessToken.Token)).First(&stored).Error; err != nil {
+		t.Fatalf("按摘要查询访问令牌失败: %v", err)
+	}
+	if stored.Token != accessToken.Token {
+		t.Errorf("保存的访问令牌被截断: 长度%d, 期望%d", len(stored.Token), len(accessToken.Token))
+	}
+
+	service := NewTokenService()
+	result, err := service.IntrospectToken(accessToken.Token)
+	if err != nil {
+		t.Fatalf("IntrospectToken() error = %v", err)
+	}
+	if result["active"] != true {
+		t.Fatalf("刚签发的访问令牌应为有效: %v", result)
+	}
+	if result["client_id"] != client.ClientID || result["scope"] != "read" || result["sub"] != client.ClientID {
+		t.Errorf("内省结果与签发的令牌不一致: %v", result)
+	}
+	// 未指定resource时受众为用户信息端点，不能用于调用本服务自身的API
+	if audience, _ := result["aud"].([]string); len(audience) != 1 || audience[0] != utils.ClientAccessTokenAudience() {
+		t.Errorf("客户端访问令牌的默认受众应为用户信息端点: %v", result["aud"])
+	}
+
+	// 撤销后内省返回无效
+	if err := service.RevokeToken(accessToken.Token, "access_token", client.ClientID); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	result, err = service.IntrospectToken(accessToken.Token)
+	if err != nil {
+		t.Fatalf("IntrospectToken() error = %v", err)
+	}
+	if result["active"] != false {
+		t.Errorf("已撤销的访问令牌应为无效: %v", result)
+	}
+}
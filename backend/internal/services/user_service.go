@@ -14,14 +14,22 @@ func NewUserService() *UserService {
 	return &UserService{}
 }
 
-// UpdateProfile 更新用户资料
-func (s *UserService) UpdateProfile(userID uint, nickname string) (*models.User, error) {
+// UpdateProfile 更新用户资料，phoneNumber、address 为nil时不修改
+// 手机号码变更后需重新验证
+func (s *UserService) UpdateProfile(userID uint, nickname string, phoneNumber, address *string) (*models.User, error) {
 	var user models.User
 	if err := database.DB.First(&user, userID).Error; err != nil {
 		return nil, errors.New("用户不存在")
 	}
 
 	user.Nickname = nickname
+	if phoneNumber != nil && *phoneNumber != user.PhoneNumber {
+		user.PhoneNumber = *phoneNumber
+		user.PhoneNumberVerified = false
+	}
+	if address != nil {
+		user.Address = *address
+	}
 	if err := database.DB.Save(&user).Error; err != nil {
 		return nil, errors.New("更新资料失败")
 	}
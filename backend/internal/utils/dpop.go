@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"astro-pass/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DPoPProofType DPoP证明JWT的typ头部（RFC 9449 4.2节）
+const DPoPProofType = "dpop+jwt"
+
+// DPoPSigningAlgs DPoP证明允许的签名算法（仅非对称算法）
+var DPoPSigningAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// dpopClockSkew 允许的时钟偏差
+const dpopClockSkew = time.Minute
+
+// DPoPProof 已验证签名的DPoP证明
+type DPoPProof struct {
+	JKT      string // 证明公钥的JWK指纹（RFC 7638）
+	JTI      string
+	Nonce    string
+	IssuedAt time.Time
+}
+
+// DPoPProofClaims DPoP证明的声明
+type DPoPProofClaims struct {
+	jwt.RegisteredClaims
+	HTM   string `json:"htm"`
+	HTU   string `json:"htu"`
+	ATH   string `json:"ath,omitempty"`
+	Nonce string `json:"nonce,omitempty"`
+}
+
+// ParseDPoPProof 验证DPoP证明（RFC 9449 4.3节）：签名、typ、htm、htu、iat，以及携带访问令牌时的ath
+// 不检查nonce和jti重放，由调用方结合服务端状态完成
+func ParseDPoPProof(proof, method, htu, accessToken string, maxAge time.Duration) (*DPoPProof, error) {
+	var jwk JWK
+	claims := &DPoPProofClaims{}
+	_, err := jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != DPoPProofType {
+			return nil, errors.New("DPoP证明的typ无效")
+		}
+
+		// 公钥通过jwk头部携带，且不能包含私钥参数
+		rawJWK, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("DPoP证明缺少jwk头部")
+		}
+		if _, hasPrivate := rawJWK["d"]; hasPrivate {
+			return nil, errors.New("DPoP证明的jwk包含私钥")
+		}
+		data, _ := json.Marshal(rawJWK)
+		if err := json.Unmarshal(data, &jwk); err != nil {
+			return nil, errors.New("DPoP证明的jwk格式错误")
+		}
+		return jwk.PublicKey()
+	}, jwt.WithValidMethods(DPoPSigningAlgs))
+	if err != nil {
+		return nil, errors.New("DPoP证明签名无效")
+	}
+
+	if claims.ID == "" {
+		return nil, errors.New("DPoP证明缺少jti")
+	}
+	if claims.IssuedAt == nil {
+		return nil, errors.New("DPoP证明缺少iat")
+	}
+	issuedAt := claims.IssuedAt.Time
+	if time.Since(issuedAt) > maxAge || issuedAt.After(time.Now().Add(dpopClockSkew)) {
+		return nil, errors.New("DPoP证明已过期")
+	}
+
+	if !strings.EqualFold(claims.HTM, method) {
+		return nil, errors.New("DPoP证明的htm不匹配")
+	}
+	if !dpopURIMatches(claims.HTU, htu) {
+		return nil, errors.New("DPoP证明的htu不匹配")
+	}
+
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		if claims.ATH != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return nil, errors.New("DPoP证明的ath不匹配")
+		}
+	}
+
+	jkt, err := jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+
+	return &DPoPProof{
+		JKT:      jkt,
+		JTI:      claims.ID,
+		Nonce:    claims.Nonce,
+		IssuedAt: issuedAt,
+	}, nil
+}
+
+// dpopURIMatches 比较htu与请求地址，忽略查询参数和片段（RFC 9449 4.3节）
+func dpopURIMatches(htu, expected string) bool {
+	parsed, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	return strings.TrimRight(parsed.String(), "/") == strings.TrimRight(expected, "/")
+}
+
+// GenerateDPoPNonce 生成服务端DPoP nonce：签发时间加HMAC，无需保存状态
+func GenerateDPoPNonce() string {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	return timestamp + "." + dpopNonceMAC(timestamp)
+}
+
+// ValidateDPoPNonce 校验nonce是否由本服务签发且未超过有效期
+func ValidateDPoPNonce(nonce string, lifetime time.Duration) bool {
+	parts := strings.SplitN(nonce, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(dpopNonceMAC(parts[0]))) {
+		return false
+	}
+
+	issuedAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return false
+	}
+	age := time.Since(time.Unix(issuedAt, 0))
+	return age >= -dpopClockSkew && age <= lifetime
+}
+
+func dpopNonceMAC(timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(config.Cfg.JWT.Secret))
+	mac.Write([]byte("dpop-nonce:" + timestamp))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DPoP错误码（RFC 9449 7.1节、8节）
+const (
+	DPoPErrorInvalidProof = "invalid_dpop_proof"
+	DPoPErrorUseNonce     = "use_dpop_nonce"
+	DPoPErrorInvalidToken = "invalid_token"
+)
+
+// DPoPError DPoP校验错误
+type DPoPError struct {
+	Code        string
+	Description string
+}
+
+func (e *DPoPError) Error() string {
+	return e.Description
+}
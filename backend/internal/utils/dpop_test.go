@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"astro-pass/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testDPoPURI = "https://auth.example.com/api/oauth2/token"
+
+// newDPoPKey 生成DPoP证明使用的ES256密钥及其公钥JWK（作为头部的map）
+func newDPoPKey(t *testing.T) (crypto.Signer, map[string]interface{}) {
+	t.Helper()
+	key, err := GenerateSigningKey("ES256")
+	if err != nil {
+		t.Fatalf("生成DPoP密钥失败: %v", err)
+	}
+	jwk, err := NewPublicJWK(key.Public())
+	if err != nil {
+		t.Fatalf("生成JWK失败: %v", err)
+	}
+	data, _ := json.Marshal(jwk)
+	header := map[string]interface{}{}
+	_ = json.Unmarshal(data, &header)
+	return key, header
+}
+
+// signDPoPProof 签名DPoP证明
+func signDPoPProof(t *testing.T, key crypto.Signer, jwk map[string]interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = DPoPProofType
+	token.Header["jwk"] = jwk
+	proof, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("签名DPoP证明失败: %v", err)
+	}
+	return proof
+}
+
+// dpopClaims DPoP证明的声明，各测试用例在此基础上修改
+func dpopClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"jti": GenerateUUID(),
+		"htm": "POST",
+		"htu": testDPoPURI,
+		"iat": time.Now().Unix(),
+	}
+}
+
+// accessTokenHash 访问令牌的ath
+func accessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestParseDPoPProof(t *testing.T) {
+	key, jwk := newDPoPKey(t)
+	const accessToken = "access-token"
+
+	tests := []struct {
+		name        string
+		modify      func(claims jwt.MapClaims)
+		method      string
+		htu         string
+		accessToken string
+		wantErr     bool
+	}{
+		{name: "有效证明", method: "POST", htu: testDPoPURI},
+		{name: "htm大小写不敏感", method: "post", htu: testDPoPURI},
+		{name: "htu忽略查询参数和片段", modify: func(c jwt.MapClaims) { c["htu"] = testDPoPURI + "?a=1#f" }, method: "POST", htu: testDPoPURI},
+		{name: "htm不匹配", method: "GET", htu: testDPoPURI, wantErr: true},
+		{name: "htu不匹配", method: "POST", htu: "https://auth.example.com/api/oauth2/userinfo", wantErr: true},
+		{name: "htu主机不匹配", modify: func(c jwt.MapClaims) { c["htu"] = "https://evil.example.com/api/oauth2/token" }, method: "POST", htu: testDPoPURI, wantErr: true},
+		{name: "iat过旧", modify: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(-10 * time.Minute).Unix() }, method: "POST", htu: testDPoPURI, wantErr: true},
+		{name: "iat超出时钟偏差", modify: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(10 * time.Minute).Unix() }, method: "POST", htu: testDPoPURI, wantErr: true},
+		{name: "缺少iat", modify: func(c jwt.MapClaims) { delete(c, "iat") }, method: "POST", htu: testDPoPURI, wantErr: true},
+		{name: "缺少jti", modify: func(c jwt.MapClaims) { delete(c, "jti") }, method: "POST", htu: testDPoPURI, wantErr: true},
+		{name: "ath匹配", modify: func(c jwt.MapClaims) { c["ath"] = accessTokenHash(accessToken) }, method: "POST", htu: testDPoPURI, accessToken: accessToken},
+		{name: "ath不匹配", modify: func(c jwt.MapClaims) { c["ath"] = accessTokenHash("other-token") }, method: "POST", htu: testDPoPURI, accessToken: accessToken, wantErr: true},
+		{name: "缺少ath", method: "POST", htu: testDPoPURI, accessToken: accessToken, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := dpopClaims()
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			proof := signDPoPProof(t, key, jwk, claims)
+			_, err := ParseDPoPProof(proof, tt.method, tt.htu, tt.accessToken, 5*time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDPoPProof() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseDPoPProofHeader(t *testing.T) {
+	key, jwk := newDPoPKey(t)
+	_, otherJWK := newDPoPKey(t)
+
+	sign := func(typ string, jwk interface{}) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, dpopClaims())
+		token.Header["typ"] = typ
+		if jwk != nil {
+			token.Header["jwk"] = jwk
+		}
+		proof, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("签名DPoP证明失败: %v", err)
+		}
+		return proof
+	}
+
+	withPrivate := map[string]interface{}{"d": "private"}
+	for k, v := range jwk {
+		withPrivate[k] = v
+	}
+
+	tests := []struct {
+		name  string
+		proof string
+	}{
+		{"typ不是dpop+jwt", sign("JWT", jwk)},
+		{"缺少jwk头部", sign(DPoPProofType, nil)},
+		{"jwk包含私钥", sign(DPoPProofType, withPrivate)},
+		{"jwk与签名密钥不一致", sign(DPoPProofType, otherJWK)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseDPoPProof(tt.proof, "POST", testDPoPURI, "", 5*time.Minute); err == nil {
+				t.Error("ParseDPoPProof() 应返回错误")
+			}
+		})
+	}
+
+	// 返回的jkt为证明公钥的指纹
+	proof, err := ParseDPoPProof(sign(DPoPProofType, jwk), "POST", testDPoPURI, "", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("ParseDPoPProof() error = %v", err)
+	}
+	publicJWK, _ := NewPublicJWK(key.Public())
+	if jkt, _ := publicJWK.Thumbprint(); proof.JKT != jkt {
+		t.Errorf("jkt = %s, want %s", proof.JKT, jkt)
+	}
+}
+
+func TestValidateDPoPNonce(t *testing.T) {
+	if config.Cfg == nil {
+		config.Load()
+	}
+
+	nonce := GenerateDPoPNonce()
+	if !ValidateDPoPNonce(nonce, time.Minute) {
+		t.Error("本服务签发的nonce应有效")
+	}
+
+	stale := "1." + dpopNonceMAC("1")
+	if ValidateDPoPNonce(stale, time.Minute) {
+		t.Error("过期的nonce应无效")
+	}
+	if ValidateDPoPNonce(nonce+"x", time.Minute) {
+		t.Error("被篡改的nonce应无效")
+	}
+	if ValidateDPoPNonce("invalid", time.Minute) {
+		t.Error("格式错误的nonce应无效")
+	}
+}
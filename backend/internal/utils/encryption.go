@@ -13,8 +13,17 @@ import (
 
 // EncryptToken 加密令牌
 func EncryptToken(plaintext string) string {
+	ciphertext, err := EncryptSecret(plaintext)
+	if err != nil {
+		return plaintext // 如果加密失败，返回原文（不推荐，但为了兼容性）
+	}
+	return ciphertext
+}
+
+// EncryptSecret 使用AES-GCM加密敏感数据，失败时返回错误而不是原文
+func EncryptSecret(plaintext string) (string, error) {
 	if plaintext == "" {
-		return ""
+		return "", nil
 	}
 
 	key := []byte(config.Cfg.JWT.Secret)
@@ -29,21 +38,21 @@ func EncryptToken(plaintext string) string {
 
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return plaintext // 如果加密失败，返回原文（不推荐，但为了兼容性）
+		return "", err
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return plaintext
+		return "", err
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
 	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return plaintext
+		return "", err
 	}
 
 	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.URLEncoding.EncodeToString(ciphertext)
+	return base64.URLEncoding.EncodeToString(ciphertext), nil
 }
 
 // DecryptToken 解密令牌
@@ -3,6 +3,8 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,15 +13,42 @@ import (
 // IDTokenClaims ID Token的声明
 type IDTokenClaims struct {
 	jwt.RegisteredClaims
-	Name              string `json:"name,omitempty"`
-	PreferredUsername string `json:"preferred_username,omitempty"`
-	Email             string `json:"email,omitempty"`
-	EmailVerified     bool   `json:"email_verified,omitempty"`
-	Nonce             string `json:"nonce,omitempty"`
+	Nonce    string   `json:"nonce,omitempty"`
+	AuthTime int64    `json:"auth_time,omitempty"` // 用户完成认证的时间
+	AMR      []string `json:"amr,omitempty"`       // 认证方式
+	ACR      string   `json:"acr,omitempty"`       // 认证上下文类
+	SID      string   `json:"sid,omitempty"`       // 用户登录会话标识（OIDC Back-Channel Logout 2.1节）
+
+	// UserClaims 按scope释放的用户声明，序列化时与上述声明合并
+	UserClaims map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON 合并用户声明，同名时以注册声明和认证声明为准
+func (c IDTokenClaims) MarshalJSON() ([]byte, error) {
+	type plain IDTokenClaims
+	data, err := json.Marshal(plain(c))
+	if err != nil || len(c.UserClaims) == 0 {
+		return data, err
+	}
+
+	merged := make(map[string]interface{}, len(c.UserClaims))
+	for name, value := range c.UserClaims {
+		merged[name] = value
+	}
+	var base map[string]interface{}
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, err
+	}
+	for name, value := range base {
+		merged[name] = value
+	}
+	return json.Marshal(merged)
 }
 
-// GenerateIDToken 生成ID Token（使用RS256签名）
-func GenerateIDToken(userID uint, username, email, nickname string, emailVerified bool, nonce string, issuer string, audience string) (string, error) {
+// GenerateIDToken 生成ID Token（使用当前签名密钥签名）
+// subject 为用户的UUID，与用户信息端点的sub一致；userClaims 为按scope释放的用户声明
+// auth 为用户的认证上下文，用于填充 auth_time、amr、acr 和 sid；expiresIn 为有效期
+func GenerateIDToken(subject string, userClaims map[string]interface{}, nonce string, issuer string, audience string, auth *AuthContext, expiresIn time.Duration) (string, error) {
 	// 生成唯一的JTI
 	jtiBytes := make([]byte, 16)
 	if _, err := rand.Read(jtiBytes); err != nil {
@@ -31,40 +60,30 @@ func GenerateIDToken(userID uint, username, email, nickname string, emailVerifie
 	claims := IDTokenClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    issuer,
-			Subject:   username,
+			Subject:   subject,
 			Audience:  jwt.ClaimStrings{audience},
-			ExpiresAt: jwt.NewNumericDate(now.Add(15 * time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 			ID:        jti,
 		},
-		Name:              nickname,
-		PreferredUsername: username,
-		Email:             email,
-		EmailVerified:     emailVerified,
-		Nonce:             nonce,
+		Nonce:      nonce,
+		UserClaims: userClaims,
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	
-	// 使用RSA私钥签名
-	privateKey := GetPrivateKey()
-	if privateKey == nil {
-		return "", jwt.ErrInvalidKey
+	if auth != nil {
+		claims.AuthTime = auth.AuthTime.Unix()
+		claims.AMR = auth.AMR
+		claims.ACR = auth.ACR()
+		claims.SID = auth.SessionID
 	}
 
-	return token.SignedString(privateKey)
+	// 使用当前签名密钥签名
+	return SignJWT(claims, "")
 }
 
 // ParseIDToken 解析ID Token
 func ParseIDToken(tokenString string) (*IDTokenClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &IDTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// 验证签名算法
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, jwt.ErrSignatureInvalid
-		}
-		return GetPublicKey(), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &IDTokenClaims{}, SigningKeyfunc, jwt.WithValidMethods(SigningAlgorithms))
 
 	if err != nil {
 		return nil, err
@@ -76,3 +95,22 @@ func ParseIDToken(tokenString string) (*IDTokenClaims, error) {
 
 	return nil, jwt.ErrTokenInvalidClaims
 }
+
+// ParseIDTokenHint 解析登出请求中的id_token_hint：只验证签名和签发者，不检查有效期
+// OIDC RP-Initiated Logout 允许使用已过期的ID Token作为提示
+func ParseIDTokenHint(tokenString string) (*IDTokenClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &IDTokenClaims{}, SigningKeyfunc,
+		jwt.WithValidMethods(SigningAlgorithms), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*IDTokenClaims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	if !IsIssuer(claims.Issuer) {
+		return nil, errors.New("ID Token签发者无效")
+	}
+	return claims, nil
+}
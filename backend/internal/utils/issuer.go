@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+
+	"astro-pass/internal/config"
+)
+
+// PrimaryIssuer 主签发者标识，即服务对外地址APP_URL
+func PrimaryIssuer() string {
+	return strings.TrimRight(config.Cfg.App.URL, "/")
+}
+
+// Issuers 全部签发者标识：主签发者在前，其后为OAUTH2_ISSUERS中配置的签发者
+func Issuers() []string {
+	issuers := []string{PrimaryIssuer()}
+	seen := map[string]bool{issuers[0]: true}
+	for _, issuer := range config.Cfg.OAuth2.Issuers {
+		issuer = strings.TrimRight(issuer, "/")
+		if issuer != "" && !seen[issuer] {
+			seen[issuer] = true
+			issuers = append(issuers, issuer)
+		}
+	}
+	return issuers
+}
+
+// IsIssuer 是否为本服务的签发者标识
+func IsIssuer(issuer string) bool {
+	issuer = strings.TrimRight(issuer, "/")
+	if issuer == PrimaryIssuer() {
+		return true
+	}
+	for _, configured := range config.Cfg.OAuth2.Issuers {
+		if strings.TrimRight(configured, "/") == issuer {
+			return true
+		}
+	}
+	return false
+}
+
+// IssuerPaths 签发者标识中非空的路径部分（去重），协议端点和元数据需要在这些路径下注册
+func IssuerPaths() []string {
+	var paths []string
+	seen := map[string]bool{"": true}
+	for _, issuer := range Issuers() {
+		path := issuerPath(issuer)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// ResolveIssuer 按请求的Host和签发者路径确定签发者：优先匹配Host，
+// 没有Host匹配时取该路径下的第一个签发者；路径下没有签发者时返回空
+func ResolveIssuer(host, path string) string {
+	var fallback string
+	for _, issuer := range Issuers() {
+		u, err := url.Parse(issuer)
+		if err != nil || issuerPath(issuer) != path {
+			continue
+		}
+		if strings.EqualFold(u.Host, host) {
+			return issuer
+		}
+		if fallback == "" {
+			fallback = issuer
+		}
+	}
+	return fallback
+}
+
+// IssuerOrigin 签发者标识的源（scheme://host），为空时使用主签发者
+func IssuerOrigin(issuer string) string {
+	if issuer == "" {
+		issuer = PrimaryIssuer()
+	}
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return issuer
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// issuerPath 签发者标识的路径部分，不含末尾的/
+func issuerPath(issuer string) string {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(u.Path, "/")
+}
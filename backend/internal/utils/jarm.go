@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jarmResponseLifetime JARM授权响应JWT的有效期（规范建议不超过10分钟）
+const jarmResponseLifetime = 10 * time.Minute
+
+// GenerateAuthorizationResponseJWT 生成JARM授权响应（使用当前签名密钥签名）
+// params 为授权响应参数（code、state 或 error、error_description 等）
+func GenerateAuthorizationResponseJWT(issuer, clientID string, params map[string]string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"aud": clientID,
+		"iat": now.Unix(),
+		"exp": now.Add(jarmResponseLifetime).Unix(),
+	}
+	for key, value := range params {
+		if value != "" {
+			claims[key] = value
+		}
+	}
+
+	return SignJWT(claims, "")
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWK JSON Web Key（RFC 7517），仅包含公钥参数
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC / OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// ParseJWKSet 解析JWKS文档
+func ParseJWKSet(data []byte) (*JWKSet, error) {
+	var set JWKSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errors.New("JWKS格式错误")
+	}
+	if len(set.Keys) == 0 {
+		return nil, errors.New("JWKS中没有密钥")
+	}
+	for i := range set.Keys {
+		if _, err := set.Keys[i].PublicKey(); err != nil {
+			return nil, err
+		}
+	}
+	return &set, nil
+}
+
+// PublicKey 将JWK转换为Go公钥（*rsa.PublicKey、*ecdsa.PublicKey 或 ed25519.PublicKey）
+func (k *JWK) PublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil || len(n) == 0 {
+			return nil, errors.New("RSA密钥参数n无效")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 {
+			return nil, errors.New("RSA密钥参数e无效")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("不支持的EC曲线: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, errors.New("EC密钥参数x无效")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, errors.New("EC密钥参数y无效")
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("EC公钥不在曲线上")
+		}
+		return key, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("不支持的OKP曲线: %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("Ed25519公钥无效")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("不支持的密钥类型: %s", k.Kty)
+	}
+}
+
+// FindKeys 查找可用于验签的密钥：指定kid时按kid匹配，否则返回全部签名密钥
+func (s *JWKSet) FindKeys(kid string) []JWK {
+	var keys []JWK
+	for _, key := range s.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if kid != "" && key.Kid != kid {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// jwksCacheTTL 远程JWKS的缓存时间
+const jwksCacheTTL = 5 * time.Minute
+
+type cachedJWKS struct {
+	set       *JWKSet
+	fetchedAt time.Time
+}
+
+var (
+	jwksCache   = make(map[string]cachedJWKS)
+	jwksCacheMu sync.Mutex
+	jwksClient  = &http.Client{Timeout: 5 * time.Second}
+)
+
+// FetchJWKS 获取远程JWKS（带缓存），forceRefresh 用于kid未命中时重新拉取
+func FetchJWKS(uri string, forceRefresh bool) (*JWKSet, error) {
+	jwksCacheMu.Lock()
+	cached, ok := jwksCache[uri]
+	jwksCacheMu.Unlock()
+	if ok && !forceRefresh && time.Since(cached.fetchedAt) < jwksCacheTTL {
+		return cached.set, nil
+	}
+
+	resp, err := jwksClient.Get(uri)
+	if err != nil {
+		return nil, fmt.Errorf("获取JWKS失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取JWKS失败: HTTP %d", resp.StatusCode)
+	}
+
+	// 限制响应大小，防止恶意端点返回超大文档
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("读取JWKS失败: %w", err)
+	}
+
+	set, err := ParseJWKSet(data)
+	if err != nil {
+		return nil, err
+	}
+
+	jwksCacheMu.Lock()
+	jwksCache[uri] = cachedJWKS{set: set, fetchedAt: time.Now()}
+	jwksCacheMu.Unlock()
+
+	return set, nil
+}
+
+// Thumbprint 计算JWK指纹（RFC 7638，SHA-256），结果为base64url编码
+func (k *JWK) Thumbprint() (string, error) {
+	// 仅包含必需成员，并按字典序排列
+	var members string
+	switch k.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, k.Crv, k.X)
+	default:
+		return "", fmt.Errorf("不支持的密钥类型: %s", k.Kty)
+	}
+
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
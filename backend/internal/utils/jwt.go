@@ -2,35 +2,170 @@ package utils
 
 import (
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"astro-pass/internal/config"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AccessTokenType JWT访问令牌的typ头部（RFC 9068 2.1节）
+const AccessTokenType = "at+jwt"
+
+// JWTClaims 访问令牌的声明，遵循RFC 9068的JWT访问令牌格式
 type JWTClaims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	UserID   uint               `json:"user_id"`
+	Username string             `json:"username"`
+	Email    string             `json:"email"`
+	ClientID string             `json:"client_id,omitempty"` // 令牌签发给的客户端（RFC 9068 2.2节）
+	Scope    string             `json:"scope,omitempty"`     // 授权范围，空格分隔
+	AuthTime int64              `json:"auth_time,omitempty"` // 用户完成认证的时间
+	AMR      []string           `json:"amr,omitempty"`       // 认证方式（RFC 8176）
+	SID      string             `json:"sid,omitempty"`       // 用户登录会话标识，与ID Token的sid一致
+	Act      *ActorClaim        `json:"act,omitempty"`       // 代表用户行事的一方（RFC 8693 令牌交换）
+	Cnf      *ConfirmationClaim `json:"cnf,omitempty"`       // 令牌绑定的持有证明密钥（RFC 7800）
 	jwt.RegisteredClaims
 }
 
+// HasAudience 令牌的aud是否包含指定受众
+func (c *JWTClaims) HasAudience(audience string) bool {
+	audience = strings.TrimRight(audience, "/")
+	for _, aud := range c.Audience {
+		if strings.TrimRight(aud, "/") == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfirmationClaim cnf声明，记录发送方约束令牌绑定的密钥
+type ConfirmationClaim struct {
+	JKT     string `json:"jkt,omitempty"`      // DPoP公钥的JWK指纹（RFC 9449 6.1节）
+	X5tS256 string `json:"x5t#S256,omitempty"` // 客户端证书的SHA-256指纹（RFC 8705 3.1节）
+}
+
+// ActorClaim act声明（RFC 8693 4.1节），多次交换时嵌套记录委托链
+type ActorClaim struct {
+	Sub      string      `json:"sub"`
+	ClientID string      `json:"client_id,omitempty"`
+	Act      *ActorClaim `json:"act,omitempty"`
+}
+
+// 认证方式引用值（RFC 8176）
+const (
+	AMRPassword  = "pwd"
+	AMROTP       = "otp"
+	AMRMFA       = "mfa"
+	AMRHardware  = "hwk"
+	AMRFederated = "fed" // 通过外部身份提供方登录（非RFC 8176注册值）
+)
+
+// 认证上下文类引用值（acr）
+const (
+	ACRSingleFactor = "urn:astro-pass:acr:sf"
+	ACRMultiFactor  = "urn:astro-pass:acr:mfa"
+)
+
+// AuthContext 用户的认证上下文：何时、以何种方式完成认证
+type AuthContext struct {
+	AuthTime  time.Time
+	AMR       []string
+	SessionID string // 登录会话标识，写入sid声明，用于登出时定位会话
+}
+
+// ACR 根据认证方式推导认证上下文类
+func (a *AuthContext) ACR() string {
+	for _, method := range a.AMR {
+		if method == AMRMFA {
+			return ACRMultiFactor
+		}
+	}
+	return ACRSingleFactor
+}
+
+// DefaultAccessTokenAudience 第一方登录令牌的受众，即本服务自身的API
+func DefaultAccessTokenAudience() string {
+	return strings.TrimRight(config.Cfg.App.URL, "/")
+}
+
+// ClientAccessTokenAudience 签发给OAuth2客户端、未通过resource参数（RFC 8707）指定受众的访问令牌的受众，
+// 即用户信息端点；与本服务自身的API区分，客户端的令牌不能代表用户调用第一方API
+func ClientAccessTokenAudience() string {
+	return strings.TrimRight(config.Cfg.App.URL, "/") + "/api/oauth2/userinfo"
+}
+
+// AccessTokenOptions 访问令牌的附加声明
+type AccessTokenOptions struct {
+	Subject   string             // sub，用户为UUID，客户端凭证模式为client_id；为空时使用用户ID
+	ClientID  string             // 令牌签发给的客户端，登录令牌为空
+	Scope     string             // 授权范围
+	Audience  []string           // 受众，为空时为本服务自身的API（DefaultAccessTokenAudience）
+	Auth      *AuthContext       // 用户的认证上下文（auth_time、amr）
+	Act       *ActorClaim        // 令牌交换中的行事方
+	Cnf       *ConfirmationClaim // 绑定的持有证明密钥
+	ExpiresIn time.Duration      // 有效期，为0时使用JWT_ACCESS_TOKEN_EXPIRE
+	Issuer    string             // 签发者标识，为空时为主签发者（PrimaryIssuer）
+}
+
 // GenerateAccessToken 生成访问令牌
 func GenerateAccessToken(userID uint, username, email string) (string, error) {
+	return GenerateAccessTokenWithOptions(userID, username, email, &AccessTokenOptions{})
+}
+
+// GenerateAccessTokenWithAuth 生成登录使用的访问令牌，携带用户主体（sub）和认证上下文（auth_time、amr）
+func GenerateAccessTokenWithAuth(userID uint, subject, username, email string, auth *AuthContext) (string, error) {
+	return GenerateAccessTokenWithOptions(userID, username, email, &AccessTokenOptions{Subject: subject, Auth: auth})
+}
+
+// GenerateAccessTokenWithOptions 使用当前签名密钥生成JWT访问令牌（RFC 9068），资源服务器可通过JWKS验证
+func GenerateAccessTokenWithOptions(userID uint, username, email string, opts *AccessTokenOptions) (string, error) {
+	subject := opts.Subject
+	if subject == "" {
+		subject = strconv.FormatUint(uint64(userID), 10)
+	}
+	audience := opts.Audience
+	if len(audience) == 0 {
+		audience = []string{DefaultAccessTokenAudience()}
+	}
+
+	expiresIn := opts.ExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = config.Cfg.JWT.AccessTokenExpire
+	}
+
+	issuer := opts.Issuer
+	if issuer == "" {
+		issuer = PrimaryIssuer()
+	}
+
+	now := time.Now()
 	claims := JWTClaims{
 		UserID:   userID,
 		Username: username,
 		Email:    email,
+		ClientID: opts.ClientID,
+		Scope:    opts.Scope,
+		Act:      opts.Act,
+		Cnf:      opts.Cnf,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.Cfg.JWT.AccessTokenExpire)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    config.Cfg.App.Name,
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    issuer,
+			Subject:   subject,
+			Audience:  audience,
+			ID:        GenerateUUID(), // 保证同一秒内签发的令牌互不相同
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.Cfg.JWT.Secret))
+	if opts.Auth != nil {
+		claims.AuthTime = opts.Auth.AuthTime.Unix()
+		claims.AMR = opts.Auth.AMR
+		claims.SID = opts.Auth.SessionID
+	}
+
+	return SignJWT(claims, AccessTokenType)
 }
 
 // GenerateRefreshToken 生成刷新令牌
@@ -41,30 +176,49 @@ func GenerateRefreshToken(userID uint) (string, error) {
 		NotBefore: jwt.NewNumericDate(time.Now()),
 		Issuer:    config.Cfg.App.Name,
 		Subject:   string(rune(userID)),
+		ID:        GenerateUUID(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(config.Cfg.JWT.Secret))
 }
 
-// ParseToken 解析令牌
+// ParseToken 解析并验证JWT访问令牌：签名密钥由kid确定、typ为at+jwt且由本服务的签发者之一签发（RFC 9068 4节）
+// 不检查受众，作为资源服务器使用时由调用方通过 HasAudience 校验
 func ParseToken(tokenString string) (*JWTClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("无效的签名方法")
+		if typ, _ := token.Header["typ"].(string); !strings.EqualFold(typ, AccessTokenType) &&
+			!strings.EqualFold(typ, "application/"+AccessTokenType) {
+			return nil, errors.New("无效的令牌类型")
 		}
-		return []byte(config.Cfg.JWT.Secret), nil
-	})
+		return SigningKeyfunc(token)
+	}, jwt.WithValidMethods(SigningAlgorithms))
 
 	if err != nil {
 		return nil, err
 	}
 
 	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
+		if !IsIssuer(claims.Issuer) {
+			return nil, errors.New("令牌签发者无效")
+		}
 		return claims, nil
 	}
 
 	return nil, errors.New("无效的令牌")
 }
 
-
+// ParseRefreshToken 验证刷新令牌的签名和有效期
+func ParseRefreshToken(tokenString string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.Cfg.JWT.Secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("无效的令牌")
+	}
+	return claims, nil
+}
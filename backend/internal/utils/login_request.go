@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"astro-pass/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// LoginRequestTokenType 登录请求凭据的typ头部，与同样使用JWT_SECRET签名的刷新令牌区分
+const LoginRequestTokenType = "login-request+jwt"
+
+// loginRequestLifetime 登录请求凭据的有效期，用户需在此时间内完成登录并返回授权端点
+const loginRequestLifetime = 10 * time.Minute
+
+// loginRequestClaims 授权端点要求重新登录时签发的凭据，iat为要求重新登录的时间
+type loginRequestClaims struct {
+	ClientID    string `json:"client_id"`
+	RedirectURI string `json:"redirect_uri"`
+	jwt.RegisteredClaims
+}
+
+// GenerateLoginRequestToken 生成登录请求凭据（仅本服务验证，使用JWT_SECRET签名）
+// 凭据与授权请求的client_id和redirect_uri绑定，登录页面完成登录后携带它返回授权端点
+func GenerateLoginRequestToken(clientID, redirectURI string) (string, error) {
+	now := time.Now()
+	claims := loginRequestClaims{
+		ClientID:    clientID,
+		RedirectURI: redirectURI,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(loginRequestLifetime)),
+			ID:        GenerateUUID(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["typ"] = LoginRequestTokenType
+	return token.SignedString([]byte(config.Cfg.JWT.Secret))
+}
+
+// ParseLoginRequestToken 验证登录请求凭据的签名、有效期以及绑定的授权请求，返回要求重新登录的时间
+func ParseLoginRequestToken(tokenString, clientID, redirectURI string) (time.Time, error) {
+	claims := &loginRequestClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != LoginRequestTokenType {
+			return nil, errors.New("无效的令牌类型")
+		}
+		return []byte(config.Cfg.JWT.Secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuedAt(), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return time.Time{}, errors.New("无效的登录请求凭据")
+	}
+	if claims.ClientID != clientID || claims.RedirectURI != redirectURI || claims.IssuedAt == nil {
+		return time.Time{}, errors.New("登录请求凭据与授权请求不匹配")
+	}
+	return claims.IssuedAt.Time, nil
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// LogoutTokenType 登出令牌的typ头部（OIDC Back-Channel Logout 2.4节）
+	LogoutTokenType = "logout+jwt"
+	// BackchannelLogoutEvent 登出令牌events声明中的事件类型
+	BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+)
+
+// logoutTokenLifetime 登出令牌的有效期，规范建议不超过两分钟
+const logoutTokenLifetime = 2 * time.Minute
+
+// GenerateLogoutToken 生成后端通道登出令牌（使用当前签名密钥签名）
+// subject 为用户的UUID，sid 为登录会话标识，二者至少提供一个；登出令牌不得包含nonce
+func GenerateLogoutToken(issuer, subject, sid, audience string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(logoutTokenLifetime).Unix(),
+		"jti": GenerateUUID(),
+		"events": map[string]interface{}{
+			BackchannelLogoutEvent: map[string]interface{}{},
+		},
+	}
+	if subject != "" {
+		claims["sub"] = subject
+	}
+	if sid != "" {
+		claims["sid"] = sid
+	}
+
+	return SignJWT(claims, LogoutTokenType)
+}
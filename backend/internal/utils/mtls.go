@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// CertificateThumbprint 计算证书的SHA-256指纹（cnf中的x5t#S256，RFC 8705 3.1节）
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ParseCertificateHeader 解析反向代理转发的客户端证书
+// 支持URL编码的PEM（如Nginx的$ssl_client_escaped_cert）以及Base64编码的DER，证书链中第一张为客户端证书
+func ParseCertificateHeader(value string) ([]*x509.Certificate, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, errors.New("客户端证书为空")
+	}
+	if unescaped, err := url.QueryUnescape(value); err == nil {
+		value = unescaped
+	}
+
+	if !strings.Contains(value, "-----BEGIN") {
+		der, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errors.New("客户端证书格式错误")
+		}
+		return x509.ParseCertificates(der)
+	}
+
+	var certs []*x509.Certificate
+	rest := []byte(value)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.New("客户端证书格式错误")
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("客户端证书格式错误")
+	}
+	return certs, nil
+}
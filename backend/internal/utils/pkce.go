@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// PKCE code_challenge_method 取值（RFC 7636）
+const (
+	PKCEMethodPlain = "plain"
+	PKCEMethodS256  = "S256"
+)
+
+// pkceValueRegex code_verifier / code_challenge 允许的字符集与长度（43-128个unreserved字符）
+var pkceValueRegex = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// PKCEMethods 支持的code_challenge_method
+var PKCEMethods = []string{PKCEMethodS256, PKCEMethodPlain}
+
+// IsSupportedPKCEMethod 检查是否为支持的code_challenge_method
+func IsSupportedPKCEMethod(method string) bool {
+	for _, supported := range PKCEMethods {
+		if method == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePKCEValue 验证code_verifier或code_challenge的格式
+func ValidatePKCEValue(value string) bool {
+	return pkceValueRegex.MatchString(value)
+}
+
+// GeneratePKCEChallenge 根据code_verifier计算code_challenge
+func GeneratePKCEChallenge(codeVerifier, method string) string {
+	if method == PKCEMethodS256 {
+		sum := sha256.Sum256([]byte(codeVerifier))
+		return base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return codeVerifier
+}
+
+// VerifyPKCE 验证code_verifier是否与授权请求中的code_challenge匹配
+func VerifyPKCE(codeVerifier, codeChallenge, method string) bool {
+	if !IsSupportedPKCEMethod(method) || !ValidatePKCEValue(codeVerifier) {
+		return false
+	}
+	expected := GeneratePKCEChallenge(codeVerifier, method)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(codeChallenge)) == 1
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636 附录B的示例
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	s256Challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		method    string
+		want      bool
+	}{
+		{"S256匹配", verifier, s256Challenge, PKCEMethodS256, true},
+		{"S256不匹配", verifier, GeneratePKCEChallenge(strings.Repeat("a", 43), PKCEMethodS256), PKCEMethodS256, false},
+		{"S256误用plain的challenge", verifier, verifier, PKCEMethodS256, false},
+		{"plain匹配", verifier, verifier, PKCEMethodPlain, true},
+		{"plain不匹配", verifier, s256Challenge, PKCEMethodPlain, false},
+		{"不支持的方法", verifier, verifier, "S512", false},
+		{"空方法", verifier, verifier, "", false},
+		{"code_verifier过短", strings.Repeat("a", 42), strings.Repeat("a", 42), PKCEMethodPlain, false},
+		{"code_verifier最短长度", strings.Repeat("a", 43), strings.Repeat("a", 43), PKCEMethodPlain, true},
+		{"code_verifier最大长度", strings.Repeat("a", 128), strings.Repeat("a", 128), PKCEMethodPlain, true},
+		{"code_verifier过长", strings.Repeat("a", 129), strings.Repeat("a", 129), PKCEMethodPlain, false},
+		{"code_verifier包含非法字符", strings.Repeat("a", 42) + "+", strings.Repeat("a", 42) + "+", PKCEMethodPlain, false},
+		{"空code_verifier", "", "", PKCEMethodPlain, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, tt.challenge, tt.method); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGeneratePKCEChallenge(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	if got := GeneratePKCEChallenge(verifier, PKCEMethodS256); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("GeneratePKCEChallenge(S256) = %s", got)
+	}
+	if got := GeneratePKCEChallenge(verifier, PKCEMethodPlain); got != verifier {
+		t.Errorf("GeneratePKCEChallenge(plain) = %s", got)
+	}
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -62,3 +64,33 @@ func InternalError(c *gin.Context, message string) {
 	ErrorResponse(c, 500, message)
 }
 
+
+// DPoPUnauthorized 受保护资源的DPoP认证失败响应（RFC 9449 7.1节）
+// 需要nonce时通过DPoP-Nonce头下发新的nonce
+func DPoPUnauthorized(c *gin.Context, err *DPoPError) {
+	c.Header("WWW-Authenticate", `DPoP error="`+err.Code+`", algs="`+strings.Join(DPoPSigningAlgs, " ")+`"`)
+	if err.Code == DPoPErrorUseNonce {
+		c.Header("DPoP-Nonce", GenerateDPoPNonce())
+	}
+	ErrorResponse(c, 401, err.Description)
+}
+
+// OAuthError OAuth 2.0协议端点的错误响应（RFC 6749 5.2节），error为标准错误码
+func OAuthError(c *gin.Context, status int, code, description string) {
+	c.JSON(status, gin.H{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// BearerUnauthorized 受保护资源的Bearer令牌认证失败响应（RFC 6750 3节）
+// 未携带令牌时code为空，WWW-Authenticate头中只声明认证方案；error_description仅允许ASCII字符，因此只放在响应体中
+func BearerUnauthorized(c *gin.Context, code, description string) {
+	if code == "" {
+		c.Header("WWW-Authenticate", "Bearer")
+		ErrorResponse(c, 401, description)
+		return
+	}
+	c.Header("WWW-Authenticate", `Bearer error="`+code+`"`)
+	OAuthError(c, 401, code, description)
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+)
+
+// BrowserStateCookie 保存OP浏览器状态的Cookie，check_session_iframe 读取它计算会话状态，因此不能设置HttpOnly
+const BrowserStateCookie = "op_browser_state"
+
+// SessionState 计算授权响应中的session_state（OIDC Session Management 3节）
+// session_state = BASE64URL(SHA-256(client_id + " " + origin + " " + browser_state + " " + salt)) + "." + salt
+// origin 为redirect_uri的来源，browserState 为当前登录会话的浏览器状态
+func SessionState(clientID, redirectURI, browserState string) (string, error) {
+	origin, err := originOf(redirectURI)
+	if err != nil {
+		return "", err
+	}
+
+	saltBytes := make([]byte, 16)
+	if _, err := rand.Read(saltBytes); err != nil {
+		return "", err
+	}
+	salt := base64.RawURLEncoding.EncodeToString(saltBytes)
+
+	sum := sha256.Sum256([]byte(clientID + " " + origin + " " + browserState + " " + salt))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) + "." + salt, nil
+}
+
+// originOf 地址的来源（scheme://host[:port]），与浏览器postMessage事件的origin一致
+func originOf(rawURL string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return "", errors.New("无效的地址")
+	}
+	return parsed.Scheme + "://" + parsed.Host, nil
+}
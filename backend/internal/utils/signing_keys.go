@@ -0,0 +1,305 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningAlgorithms 本服务签发令牌支持的签名算法
+var SigningAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+// LegacyRSAKeyID 早期版本保存在private_key.pem中的RSA密钥使用的kid，导入后保持不变以免已签发的令牌失效
+const LegacyRSAKeyID = "rsa-key-1"
+
+// SigningKey 密钥环中的签名密钥
+type SigningKey struct {
+	KID         string
+	Algorithm   string
+	PrivateKey  crypto.Signer
+	PublicKey   crypto.PublicKey
+	ActivatesAt time.Time  // 开始用于签名的时间，此前仅发布公钥
+	RetireAt    *time.Time // 停止发布和验签的时间，为空表示一直有效
+}
+
+// usable 密钥是否仍可发布和验签
+func (k *SigningKey) usable(now time.Time) bool {
+	return k.RetireAt == nil || now.Before(*k.RetireAt)
+}
+
+const (
+	// signingKeyCacheTTL 内存密钥环的有效期，过期后在下次签名、验签或发布JWKS前从存储重新加载，
+	// 使其他实例撤销或轮换的密钥在此时间内对本实例生效
+	signingKeyCacheTTL = 30 * time.Second
+	// signingKeyReloadInterval 遇到未知kid时重新加载密钥环的最小间隔，防止伪造kid导致频繁查库
+	signingKeyReloadInterval = 5 * time.Second
+)
+
+var (
+	signingKeys          []*SigningKey
+	signingKeysMu        sync.RWMutex
+	signingKeyReloader   func() error
+	lastSigningKeyReload time.Time
+)
+
+// SetSigningKeys 替换内存中的密钥环
+func SetSigningKeys(keys []*SigningKey) {
+	signingKeysMu.Lock()
+	defer signingKeysMu.Unlock()
+	signingKeys = keys
+	lastSigningKeyReload = time.Now()
+}
+
+// SetSigningKeyReloader 设置从存储重新加载密钥环的函数，用于多实例部署时获取其他实例轮换或撤销的密钥
+func SetSigningKeyReloader(reload func() error) {
+	signingKeysMu.Lock()
+	defer signingKeysMu.Unlock()
+	signingKeyReloader = reload
+}
+
+// reloadSigningKeys 距上次加载超过minAge时重新加载密钥环，返回是否执行了加载
+// 加载前先记录加载时间，并发请求中只有一个会查询存储
+func reloadSigningKeys(minAge time.Duration) bool {
+	signingKeysMu.Lock()
+	reload := signingKeyReloader
+	due := time.Since(lastSigningKeyReload) >= minAge
+	if reload != nil && due {
+		lastSigningKeyReload = time.Now()
+	}
+	signingKeysMu.Unlock()
+	if reload == nil || !due {
+		return false
+	}
+	if err := reload(); err != nil {
+		Error("重新加载签名密钥失败: %v", err)
+		return false
+	}
+	return true
+}
+
+// CurrentSigningKey 获取当前用于签名的密钥：已到启用时间的密钥中启用最晚的一把
+func CurrentSigningKey() (*SigningKey, error) {
+	signingKeysMu.RLock()
+	defer signingKeysMu.RUnlock()
+
+	now := time.Now()
+	var current *SigningKey
+	for _, key := range signingKeys {
+		if key.ActivatesAt.After(now) || !key.usable(now) {
+			continue
+		}
+		if current == nil || key.ActivatesAt.After(current.ActivatesAt) {
+			current = key
+		}
+	}
+	if current == nil {
+		return nil, errors.New("没有可用的签名密钥")
+	}
+	return current, nil
+}
+
+// findSigningKey 按kid查找仍可验签的密钥
+func findSigningKey(kid string) *SigningKey {
+	signingKeysMu.RLock()
+	defer signingKeysMu.RUnlock()
+
+	now := time.Now()
+	for _, key := range signingKeys {
+		if key.KID == kid && key.usable(now) {
+			return key
+		}
+	}
+	return nil
+}
+
+// SignJWT 使用当前签名密钥签名JWT，头部携带kid，typ为空时不设置
+func SignJWT(claims jwt.Claims, typ string) (string, error) {
+	reloadSigningKeys(signingKeyCacheTTL)
+	key, err := CurrentSigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	if typ != "" {
+		token.Header["typ"] = typ
+	}
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.PrivateKey)
+}
+
+// SigningKeyfunc 验证本服务签发的JWT时按kid查找公钥，并要求头部算法与密钥算法一致
+func SigningKeyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("令牌缺少kid")
+	}
+
+	reloadSigningKeys(signingKeyCacheTTL)
+	key := findSigningKey(kid)
+	if key == nil && reloadSigningKeys(signingKeyReloadInterval) {
+		key = findSigningKey(kid)
+	}
+	if key == nil {
+		return nil, errors.New("未知的签名密钥")
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("签名算法与密钥不匹配")
+	}
+	return key.PublicKey, nil
+}
+
+// PublishedJWKS 需要发布的公钥集合：待启用、当前和退役中的密钥
+func PublishedJWKS() JWKSet {
+	reloadSigningKeys(signingKeyCacheTTL)
+
+	signingKeysMu.RLock()
+	defer signingKeysMu.RUnlock()
+
+	now := time.Now()
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range signingKeys {
+		if !key.usable(now) {
+			continue
+		}
+		jwk, err := NewPublicJWK(key.PublicKey)
+		if err != nil {
+			continue
+		}
+		jwk.Kid = key.KID
+		jwk.Use = "sig"
+		jwk.Alg = key.Algorithm
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// PublishedSigningAlgorithms 已发布密钥使用的签名算法（去重）
+func PublishedSigningAlgorithms() []string {
+	var algs []string
+	seen := make(map[string]bool)
+	for _, key := range PublishedJWKS().Keys {
+		if !seen[key.Alg] {
+			seen[key.Alg] = true
+			algs = append(algs, key.Alg)
+		}
+	}
+	return algs
+}
+
+// NewPublicJWK 将公钥转换为JWK（RSA、EC P-256 或 Ed25519）
+func NewPublicJWK(pub crypto.PublicKey) (JWK, error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return JWK{}, errors.New("仅支持P-256曲线")
+		}
+		// 坐标按曲线长度左侧补零（RFC 7518 6.2.1节）
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		key.X.FillBytes(x)
+		key.Y.FillBytes(y)
+		return JWK{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   base64.RawURLEncoding.EncodeToString(x),
+			Y:   base64.RawURLEncoding.EncodeToString(y),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	default:
+		return JWK{}, errors.New("不支持的公钥类型")
+	}
+}
+
+// GenerateSigningKey 为指定算法生成新的私钥
+func GenerateSigningKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case "RS256":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("不支持的签名算法: %s", alg)
+	}
+}
+
+// SigningKeyAlgorithm 根据私钥类型推断签名算法
+func SigningKeyAlgorithm(key crypto.Signer) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return "RS256", nil
+	case *ecdsa.PrivateKey:
+		if k.Curve == elliptic.P256() {
+			return "ES256", nil
+		}
+	case ed25519.PrivateKey:
+		return "EdDSA", nil
+	}
+	return "", errors.New("不支持的私钥类型")
+}
+
+// MarshalPrivateKeyPEM 将私钥编码为PKCS#8 PEM
+func MarshalPrivateKeyPEM(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// MarshalPublicKeyPEM 将公钥编码为PKIX PEM
+func MarshalPublicKeyPEM(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// ParsePrivateKeyPEM 解析PKCS#8或PKCS#1（旧版RSA密钥文件）格式的私钥
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("私钥PEM格式错误")
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("不支持的私钥类型")
+	}
+	return signer, nil
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"crypto/tls"
 	"log"
+	"net/http"
 
 	"astro-pass/internal/config"
 	"astro-pass/internal/database"
@@ -37,12 +39,24 @@ func main() {
 		utils.Info("Redis初始化完成")
 	}
 
-	// 初始化RSA密钥对（用于JWT签名）
-	if err := utils.InitRSAKeys(); err != nil {
-		utils.Error("RSA密钥初始化失败: %v", err)
-		log.Fatalf("RSA密钥初始化失败: %v", err)
+	// 将早期版本明文保存的客户端密钥转换为摘要
+	if err := services.NewOAuth2Service().MigratePlaintextClientSecrets(); err != nil {
+		utils.Error("迁移客户端密钥失败: %v", err)
+		log.Fatalf("迁移客户端密钥失败: %v", err)
+	}
+
+	// 初始化令牌签名密钥（保存在数据库中，按计划轮换）
+	if err := services.NewSigningKeyService().Init(); err != nil {
+		utils.Error("签名密钥初始化失败: %v", err)
+		log.Fatalf("签名密钥初始化失败: %v", err)
+	}
+	utils.Info("签名密钥初始化完成")
+
+	// 补齐内置的授权范围定义
+	if err := services.NewScopeService().EnsureBuiltinScopes(); err != nil {
+		utils.Error("初始化授权范围失败: %v", err)
+		log.Fatalf("初始化授权范围失败: %v", err)
 	}
-	utils.Info("RSA密钥初始化完成")
 
 	// 初始化权限服务（数据库初始化后）
 	// 注意：这里只是预初始化，实际使用时会延迟初始化
@@ -80,7 +94,23 @@ func main() {
 	addr := config.Cfg.Server.Host + ":" + config.Cfg.Server.Port
 	utils.Info("星穹通行证服务启动在 %s", addr)
 	log.Printf("星穹通行证服务启动在 %s", addr)
-	if err := router.Run(addr); err != nil {
+
+	var err error
+	if config.Cfg.Server.TLSCertFile != "" {
+		// 直接终止TLS时请求（但不强制）客户端证书，证书由双向TLS客户端认证按客户端配置校验（RFC 8705）
+		server := &http.Server{
+			Addr:    addr,
+			Handler: router,
+			TLSConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				ClientAuth: tls.RequestClientCert,
+			},
+		}
+		err = server.ListenAndServeTLS(config.Cfg.Server.TLSCertFile, config.Cfg.Server.TLSKeyFile)
+	} else {
+		err = router.Run(addr)
+	}
+	if err != nil {
 		utils.Error("服务器启动失败: %v", err)
 		log.Fatalf("服务器启动失败: %v", err)
 	}
@@ -97,6 +97,8 @@ func main() {
 		{Name: "config:manage", DisplayName: "配置管理", Resource: "config", Action: "manage", Description: "管理系统配置"},
 		{Name: "sso:manage", DisplayName: "SSO管理", Resource: "sso", Action: "manage", Description: "管理单点登录会话"},
 		{Name: "saml:manage", DisplayName: "SAML管理", Resource: "saml", Action: "manage", Description: "管理SAML配置"},
+		{Name: "signing_key:manage", DisplayName: "签名密钥管理", Resource: "signing_key", Action: "manage", Description: "轮换和撤销令牌签名密钥"},
+		{Name: "oauth2_scope:manage", DisplayName: "授权范围管理", Resource: "oauth2_scope", Action: "manage", Description: "管理scope定义及其释放的用户声明"},
 	}
 
 	fmt.Println("\n创建基础权限...")
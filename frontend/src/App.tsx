@@ -16,6 +16,7 @@ import OAuth2Clients from './pages/OAuth2Clients'
 import Notifications from './pages/Notifications'
 import EmailVerification from './pages/EmailVerification'
 import ConsentPage from './pages/ConsentPage'
+import DevicePage from './pages/DevicePage'
 import AuthorizedApps from './pages/AuthorizedApps'
 import SSOSessions from './pages/SSOSessions'
 import AdminLayout from './layouts/AdminLayout'
@@ -148,6 +149,14 @@ function App() {
           }
         />
         <Route path="/oauth2/consent" element={<ConsentPage />} />
+        <Route
+          path="/oauth2/device"
+          element={
+            <PrivateRoute>
+              <DevicePage />
+            </PrivateRoute>
+          }
+        />
         {/* 管理员后台路由 */}
         <Route
           path="/admin"
@@ -4,8 +4,15 @@ import api from '../utils/api';
 import './ConsentPage.css';
 
 interface ScopeInfo {
-  scope: string;
+  name: string;
+  display_name: string;
   description: string;
+  sensitivity: 'low' | 'medium' | 'high';
+}
+
+interface RequestedClaim {
+  name: string;
+  essential: boolean;
 }
 
 interface ClientInfo {
@@ -13,6 +20,10 @@ interface ClientInfo {
   client_uri: string;
   logo_uri: string;
   scopes: ScopeInfo[];
+  scope: string;
+  claims: RequestedClaim[];
+  redirect_uri: string;
+  state: string;
 }
 
 const ConsentPage: React.FC = () => {
@@ -24,24 +35,27 @@ const ConsentPage: React.FC = () => {
 
   const clientId = searchParams.get('client_id');
   const scope = searchParams.get('scope');
-  const redirectUri = searchParams.get('redirect_uri');
-  const state = searchParams.get('state');
   const responseType = searchParams.get('response_type');
+  // 推送授权请求（PAR）和请求对象（JAR）只携带request_uri或request，其余参数由后端解析
+  const requestUri = searchParams.get('request_uri');
+  const requestObject = searchParams.get('request');
+  // OIDC claims请求参数，请求单独的用户声明
+  const claims = searchParams.get('claims');
 
   useEffect(() => {
-    if (!clientId || !scope) {
+    if (!clientId || (!scope && !requestUri && !requestObject)) {
       setError('缺少必要参数');
       setLoading(false);
       return;
     }
 
     fetchClientInfo();
-  }, [clientId, scope]);
+  }, [clientId, scope, claims, requestUri, requestObject]);
 
   const fetchClientInfo = async () => {
     try {
       const response = await api.get('/oauth2/consent/info', {
-        params: { client_id: clientId, scope: scope }
+        params: { client_id: clientId, scope: scope, claims: claims, request_uri: requestUri, request: requestObject }
       });
       setClientInfo(response.data.data);
     } catch (err: any) {
@@ -54,21 +68,21 @@ const ConsentPage: React.FC = () => {
   const handleApprove = async () => {
     try {
       setLoading(true);
-      await api.post('/oauth2/consent/approve', {
+      const response = await api.post('/oauth2/consent/approve', {
         client_id: clientId,
-        scope: scope
+        redirect_uri: clientInfo?.redirect_uri || searchParams.get('redirect_uri'),
+        scope: scope || clientInfo?.scope,
+        claims: clientInfo?.claims.map((claim) => claim.name) || []
       });
 
-      // 重定向回授权端点继续流程
-      const params = new URLSearchParams({
-        response_type: responseType || 'code',
-        client_id: clientId || '',
-        redirect_uri: redirectUri || '',
-        scope: scope || '',
-        state: state || '',
-        consent: 'approved'
-      });
-      
+      // 重定向回授权端点继续流程（保留nonce、code_challenge或request_uri等原始授权参数）
+      const params = new URLSearchParams(searchParams);
+      if (!requestUri && !requestObject) {
+        params.set('response_type', responseType || 'code');
+      }
+      // 授权端点只认可本次批准签发的一次性凭据
+      params.set('consent_ticket', response.data.data.consent_ticket);
+
       window.location.href = `/api/oauth2/authorize?${params.toString()}`;
     } catch (err: any) {
       setError(err.response?.data?.message || '授权失败');
@@ -77,17 +91,14 @@ const ConsentPage: React.FC = () => {
   };
 
   const handleDeny = () => {
-    // 重定向回应用并带上错误信息
-    if (redirectUri) {
-      const params = new URLSearchParams({
-        error: 'access_denied',
-        error_description: '用户拒绝授权',
-        state: state || ''
-      });
-      window.location.href = `${redirectUri}?${params.toString()}`;
-    } else {
-      navigate('/dashboard');
+    // 交由授权端点将access_denied错误重定向回已校验的redirect_uri（按请求的response_mode返回）
+    const params = new URLSearchParams(searchParams);
+    if (!requestUri && !requestObject) {
+      params.set('response_type', responseType || 'code');
     }
+    params.set('consent', 'denied');
+
+    window.location.href = `/api/oauth2/authorize?${params.toString()}`;
   };
 
   if (loading) {
@@ -138,6 +149,18 @@ const ConsentPage: React.FC = () => {
                 <li key={index} className="permission-item">
                   <span className="permission-icon">✓</span>
                   <span className="permission-text">{scopeInfo.description}</span>
+                  {scopeInfo.sensitivity === 'high' && (
+                    <span className="permission-sensitive">敏感</span>
+                  )}
+                </li>
+              ))}
+              {clientInfo.claims.map((claim) => (
+                <li key={claim.name} className="permission-item">
+                  <span className="permission-icon">✓</span>
+                  <span className="permission-text">读取您的 {claim.name} 信息</span>
+                  {claim.essential && (
+                    <span className="permission-essential">必需</span>
+                  )}
                 </li>
               ))}
             </ul>
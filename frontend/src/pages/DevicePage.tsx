@@ -0,0 +1,178 @@
+import React, { useEffect, useState } from 'react';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+import api from '../utils/api';
+import './ConsentPage.css';
+import './DevicePage.css';
+
+interface ScopeInfo {
+  name: string;
+  display_name: string;
+  description: string;
+  sensitivity: 'low' | 'medium' | 'high';
+}
+
+interface DeviceInfo {
+  user_code: string;
+  client_name: string;
+  client_uri: string;
+  logo_uri: string;
+  scopes: ScopeInfo[];
+}
+
+const DevicePage: React.FC = () => {
+  const [searchParams] = useSearchParams();
+  const navigate = useNavigate();
+  const [userCode, setUserCode] = useState(searchParams.get('user_code') || '');
+  const [deviceInfo, setDeviceInfo] = useState<DeviceInfo | null>(null);
+  const [loading, setLoading] = useState(false);
+  const [error, setError] = useState('');
+  const [result, setResult] = useState('');
+
+  useEffect(() => {
+    // 通过verification_uri_complete进入时直接查询
+    if (searchParams.get('user_code')) {
+      fetchDeviceInfo(searchParams.get('user_code') || '');
+    }
+  }, []);
+
+  const fetchDeviceInfo = async (code: string) => {
+    try {
+      setLoading(true);
+      setError('');
+      const response = await api.get('/oauth2/device/verify', {
+        params: { user_code: code }
+      });
+      setDeviceInfo(response.data.data);
+    } catch (err: any) {
+      setError(err.response?.data?.message || '用户码无效');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleSubmit = (e: React.FormEvent) => {
+    e.preventDefault();
+    if (!userCode.trim()) {
+      setError('请输入设备上显示的代码');
+      return;
+    }
+    fetchDeviceInfo(userCode.trim());
+  };
+
+  const handleDecision = async (approve: boolean) => {
+    if (!deviceInfo) {
+      return;
+    }
+    try {
+      setLoading(true);
+      const response = await api.post('/oauth2/device/verify', {
+        user_code: deviceInfo.user_code,
+        approve
+      });
+      setResult(response.data.message);
+      setDeviceInfo(null);
+    } catch (err: any) {
+      setError(err.response?.data?.message || '操作失败');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  if (result) {
+    return (
+      <div className="consent-page">
+        <div className="consent-card">
+          <div className="consent-header">
+            <h2 className="consent-title">设备授权</h2>
+            <p className="consent-description">{result}</p>
+          </div>
+          <button onClick={() => navigate('/dashboard')} className="btn-secondary">
+            返回
+          </button>
+        </div>
+      </div>
+    );
+  }
+
+  if (deviceInfo) {
+    return (
+      <div className="consent-page">
+        <div className="consent-card">
+          <div className="consent-header">
+            {deviceInfo.logo_uri && (
+              <img src={deviceInfo.logo_uri} alt={deviceInfo.client_name} className="client-logo" />
+            )}
+            <h2 className="consent-title">设备授权请求</h2>
+            <p className="consent-description">
+              <strong>{deviceInfo.client_name}</strong> 请求访问您的账户
+            </p>
+            <p className="device-code-display">{deviceInfo.user_code}</p>
+          </div>
+
+          <div className="consent-body">
+            <div className="permissions-section">
+              <h3>该设备将能够：</h3>
+              <ul className="permissions-list">
+                {deviceInfo.scopes?.map((scopeInfo, index) => (
+                  <li key={index} className="permission-item">
+                    <span className="permission-icon">✓</span>
+                    <span className="permission-text">{scopeInfo.description}</span>
+                    {scopeInfo.sensitivity === 'high' && (
+                      <span className="permission-sensitive">敏感</span>
+                    )}
+                  </li>
+                ))}
+              </ul>
+            </div>
+
+            <div className="consent-info">
+              <p className="info-text">
+                请确认上方代码与设备上显示的一致。如果您没有发起此请求，请拒绝。
+              </p>
+            </div>
+          </div>
+
+          {error && <div className="error-message">{error}</div>}
+
+          <div className="consent-actions">
+            <button onClick={() => handleDecision(false)} className="btn-deny" disabled={loading}>
+              拒绝
+            </button>
+            <button onClick={() => handleDecision(true)} className="btn-approve" disabled={loading}>
+              {loading ? '授权中...' : '授权'}
+            </button>
+          </div>
+        </div>
+      </div>
+    );
+  }
+
+  return (
+    <div className="consent-page">
+      <div className="consent-card">
+        <div className="consent-header">
+          <h2 className="consent-title">连接设备</h2>
+          <p className="consent-description">请输入设备上显示的代码</p>
+        </div>
+
+        <form onSubmit={handleSubmit} className="device-form">
+          <input
+            type="text"
+            className="device-code-input"
+            value={userCode}
+            onChange={(e) => setUserCode(e.target.value.toUpperCase())}
+            placeholder="XXXX-XXXX"
+            maxLength={9}
+            autoFocus
+          />
+          {error && <div className="error-message">{error}</div>}
+          <button type="submit" className="btn-approve" disabled={loading}>
+            {loading ? '查询中...' : '继续'}
+          </button>
+        </form>
+      </div>
+    </div>
+  );
+};
+
+export default DevicePage;
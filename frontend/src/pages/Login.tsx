@@ -1,6 +1,6 @@
 import { useState } from 'react'
-import { useNavigate, Link } from 'react-router-dom'
-import { useAuthStore } from '../stores/authStore'
+import { useNavigate, useSearchParams, Link } from 'react-router-dom'
+import { useAuthStore, LoginError } from '../stores/authStore'
 import Button from '../components/Button'
 import Input from '../components/Input'
 import Card from '../components/Card'
@@ -8,15 +8,25 @@ import './Login.css'
 
 export default function Login() {
   const navigate = useNavigate()
+  const [searchParams] = useSearchParams()
   const { login, isAuthenticated } = useAuthStore()
 
-  const [username, setUsername] = useState('')
+  // 授权端点要求登录时携带的参数：完成后返回的授权请求、建议的账户（login_hint）和认证要求（acr_values）
+  const returnTo = searchParams.get('return_to')
+  const acrValues = searchParams.get('acr_values') || ''
+
+  const [username, setUsername] = useState(searchParams.get('login_hint') || '')
   const [password, setPassword] = useState('')
+  const [mfaCode, setMfaCode] = useState('')
+  const [mfaRequired, setMfaRequired] = useState(false)
   const [error, setError] = useState('')
   const [loading, setLoading] = useState(false)
 
-  // 如果已登录，重定向到仪表板
-  if (isAuthenticated) {
+  // 只允许返回本站的授权端点，避免开放重定向
+  const authorizeReturnTo = returnTo && returnTo.startsWith('/api/oauth2/authorize?') ? returnTo : null
+
+  // 如果已登录且不是授权端点要求的重新登录，重定向到仪表板
+  if (isAuthenticated && !authorizeReturnTo) {
     navigate('/dashboard')
     return null
   }
@@ -27,9 +37,16 @@ export default function Login() {
     setLoading(true)
 
     try {
-      await login(username, password)
+      await login(username, password, { mfaCode: mfaCode || undefined, acrValues: acrValues || undefined })
+      if (authorizeReturnTo) {
+        window.location.href = authorizeReturnTo
+        return
+      }
       navigate('/dashboard')
     } catch (err: any) {
+      if (err instanceof LoginError && err.mfaRequired) {
+        setMfaRequired(true)
+      }
       setError(err.message || '登录失败，请检查您的通行证信息哦~')
     } finally {
       setLoading(false)
@@ -66,6 +83,17 @@ export default function Login() {
               required
             />
 
+            {mfaRequired && (
+              <Input
+                label="MFA验证码"
+                type="text"
+                placeholder="请输入身份验证器中的6位验证码"
+                value={mfaCode}
+                onChange={(e) => setMfaCode(e.target.value)}
+                required
+              />
+            )}
+
             <Button type="submit" fullWidth disabled={loading}>
               {loading ? '登录中...' : '登录'}
             </Button>
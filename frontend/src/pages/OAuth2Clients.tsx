@@ -15,6 +15,9 @@ interface OAuth2Client {
   logo_uri?: string
   status: string
   created_at: string
+  client_secret_issued_at?: string
+  client_secret_expires_at?: string
+  previous_secret_expires_at?: string
 }
 
 export default function OAuth2Clients() {
@@ -31,6 +34,7 @@ export default function OAuth2Clients() {
     redirect_uris: '',
   })
   const [revoking, setRevoking] = useState<string | null>(null)
+  const [rotating, setRotating] = useState<string | null>(null)
 
   useEffect(() => {
     fetchClients()
@@ -91,6 +95,23 @@ export default function OAuth2Clients() {
     }
   }
 
+  const handleRotateSecret = async (clientId: string) => {
+    try {
+      setRotating(clientId)
+      const response = await axios.post(`/api/oauth2/clients/${clientId}/rotate-secret`)
+      const data = response.data.data
+      const grace = data.previous_secret_expires_at
+        ? `\n旧密钥将于 ${new Date(data.previous_secret_expires_at).toLocaleString()} 失效`
+        : ''
+      alert(`客户端密钥已轮换！\nClient ID: ${data.client_id}\nClient Secret: ${data.client_secret}${grace}\n\n请妥善保管Client Secret，它只会显示一次！`)
+      await fetchClients()
+    } catch (error: any) {
+      alert(error.response?.data?.message || '轮换失败')
+    } finally {
+      setRotating(null)
+    }
+  }
+
   if (loading) {
     return (
       <div className="oauth2-clients-page">
@@ -186,6 +207,13 @@ export default function OAuth2Clients() {
                         </a>
                       </div>
                     )}
+                    {client.client_secret_issued_at && (
+                      <div className="client-id">
+                        密钥签发于 {new Date(client.client_secret_issued_at).toLocaleString()}
+                        {client.client_secret_expires_at &&
+                          `，将于 ${new Date(client.client_secret_expires_at).toLocaleString()} 过期`}
+                      </div>
+                    )}
                     <div className="client-status">
                       <span className={`status-badge status-${client.status}`}>
                         {client.status}
@@ -193,6 +221,19 @@ export default function OAuth2Clients() {
                     </div>
                   </div>
                   <div className="client-actions">
+                    {client.client_secret_issued_at && client.status === 'active' && (
+                      <Button
+                        variant="outline"
+                        onClick={() => {
+                          if (confirm('确定要轮换客户端密钥吗？旧密钥将在宽限期后失效。')) {
+                            handleRotateSecret(client.client_id)
+                          }
+                        }}
+                        disabled={rotating === client.client_id}
+                      >
+                        {rotating === client.client_id ? '轮换中...' : '轮换密钥'}
+                      </Button>
+                    )}
                     <Button
                       variant="outline"
                       onClick={() => {
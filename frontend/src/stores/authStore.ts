@@ -14,12 +14,28 @@ interface User {
   roles?: Array<{ id: number; name: string; display_name: string }>
 }
 
+// 从授权请求跳转登录时的附加参数
+interface LoginOptions {
+  mfaCode?: string
+  acrValues?: string
+}
+
+// LoginError 登录失败，mfaRequired表示应用要求MFA验证
+export class LoginError extends Error {
+  mfaRequired: boolean
+
+  constructor(message: string, mfaRequired = false) {
+    super(message)
+    this.mfaRequired = mfaRequired
+  }
+}
+
 interface AuthState {
   user: User | null
   accessToken: string | null
   refreshToken: string | null
   isAuthenticated: boolean
-  login: (username: string, password: string) => Promise<void>
+  login: (username: string, password: string, options?: LoginOptions) => Promise<void>
   register: (username: string, email: string, password: string, nickname?: string) => Promise<void>
   logout: () => void
   refreshAccessToken: () => Promise<void>
@@ -68,11 +84,13 @@ export const useAuthStore = create<AuthState>()(
     return ({
       ...initialState,
 
-      login: async (username: string, password: string) => {
+      login: async (username: string, password: string, options?: LoginOptions) => {
         try {
           const response = await axios.post(`${API_BASE_URL}/auth/login`, {
             username,
             password,
+            mfa_code: options?.mfaCode,
+            acr_values: options?.acrValues,
           })
 
           const { data } = response.data
@@ -88,7 +106,7 @@ export const useAuthStore = create<AuthState>()(
           // 设置axios默认header
           axios.defaults.headers.common['Authorization'] = `Bearer ${data.access_token}`
         } catch (error: any) {
-          throw new Error(error.response?.data?.message || '登录失败')
+          throw new LoginError(error.response?.data?.message || '登录失败', !!error.response?.data?.mfa_required)
         }
       },
 